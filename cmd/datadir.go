@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/conductant/gohm/pkg/command"
+	gflag "github.com/conductant/gohm/pkg/flag"
+	"github.com/conductant/zk/pkg/datadir"
+	"github.com/conductant/zk/pkg/quorum"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type datadirCommand struct {
+	Dir    string `flag:"dir, ZooKeeper data directory"`
+	LogDir string `flag:"log_dir, ZooKeeper transaction log directory if not the data directory"`
+	Txns   bool   `flag:"txns, List the transactions"`
+	Path   string `flag:"path, Only list transactions on this znode or under it"`
+	Types  string `flag:"type, Only list transactions of these types such as create or setData.  Separate with commas"`
+	Since  string `flag:"since, Only list transactions at or after this RFC 3339 time or this long ago such as 1h"`
+	Until  string `flag:"until, Only list transactions at or before this RFC 3339 time or this long ago"`
+	Format string `flag:"format, Output format: table or json"`
+}
+
+func init() {
+	inspect := &datadirCommand{
+		Dir:    quorum.ZkLocalDataDirectory,
+		Format: "table",
+	}
+	command.RegisterFunc("datadir", inspect,
+		exitOnError(func(a []string, w io.Writer) error {
+			if len(a) == 0 || a[0] != "inspect" {
+				return fmt.Errorf("unknown subcommand %q.  Use datadir inspect", strings.Join(a, " "))
+			}
+			// Flags after the subcommand
+			flags := flag.NewFlagSet("datadir inspect", flag.ContinueOnError)
+			gflag.RegisterFlags("datadir inspect", inspect, flags)
+			if err := flags.Parse(a[1:]); err == flag.ErrHelp {
+				return nil
+			} else if err != nil {
+				return errBadFlags
+			}
+			if inspect.Format != "table" && inspect.Format != "json" {
+				return errBadFormat
+			}
+			filter, err := inspect.filter()
+			if err != nil {
+				return err
+			}
+			list := inspect.Txns || inspect.Path != "" || inspect.Types != "" || inspect.Since != "" || inspect.Until != ""
+
+			txns := []*datadir.Txn{}
+			var tw *tabwriter.Writer
+			if list && inspect.Format != "json" {
+				tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+				fmt.Fprintln(tw, "ZXID\tTIME\tSESSION\tTYPE\tPATH\tDETAIL")
+			}
+			summary, err := datadir.Inspect(inspect.Dir, inspect.LogDir, func(txn *datadir.Txn) {
+				switch {
+				case !list || !filter.Match(txn):
+				case tw != nil:
+					printTxn(tw, txn)
+				default:
+					txns = append(txns, txn)
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if inspect.Format == "json" {
+				m := map[string]interface{}{"summary": summary}
+				if list {
+					m["txns"] = txns
+				}
+				buff, err := json.MarshalIndent(m, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(buff))
+				return nil
+			}
+			if tw != nil {
+				tw.Flush()
+				fmt.Fprintln(w)
+			}
+			printSummary(w, summary)
+			return nil
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "datadir inspect: Reads the snapshots and transaction logs of a ZooKeeper data directory offline.")
+			fmt.Fprintln(w, "Prints the latest zxid, the epochs and sessions, and with -txns or a filter the transactions.")
+		})
+}
+
+func (this *datadirCommand) filter() (*datadir.Filter, error) {
+	filter := &datadir.Filter{Path: this.Path}
+	if this.Types != "" {
+		for _, name := range strings.Split(this.Types, ",") {
+			t, err := datadir.ParseTxnType(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("%v:%s", err, name)
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	var err error
+	if filter.Since, err = parseTime(this.Since); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = parseTime(this.Until); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// An RFC 3339 time, or a duration before now.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q.  Use RFC 3339 or a duration", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+func printTxn(tw io.Writer, txn *datadir.Txn) {
+	fmt.Fprintf(tw, "%v\t%s\t0x%x\t%v\t%s\t%s\n", txn.Zxid, txn.Time.Format(time.RFC3339), txn.Session,
+		txn.Type, txn.Path, txnDetail(txn))
+	for _, op := range txn.Ops {
+		fmt.Fprintf(tw, "\t\t\t  %v\t%s\t%s\n", op.Type, op.Path, txnDetail(op))
+	}
+}
+
+func txnDetail(txn *datadir.Txn) string {
+	switch txn.Type {
+	case datadir.TxnCreate, datadir.TxnCreate2, datadir.TxnCreateContainer, datadir.TxnCreateTTL:
+		detail := fmt.Sprintf("%d bytes", len(txn.Data))
+		if txn.Ephemeral {
+			detail += ", ephemeral"
+		}
+		if txn.TTL > 0 {
+			detail += fmt.Sprintf(", ttl %dms", txn.TTL)
+		}
+		return detail
+	case datadir.TxnSetData, datadir.TxnReconfig:
+		return fmt.Sprintf("%d bytes, version %d", len(txn.Data), txn.Version)
+	case datadir.TxnSetACL:
+		acl := []string{}
+		for _, entry := range txn.ACL {
+			acl = append(acl, fmt.Sprintf("%s:%s:%d", entry.Scheme, entry.Id, entry.Perms))
+		}
+		return fmt.Sprintf("%s, version %d", strings.Join(acl, " "), txn.Version)
+	case datadir.TxnCheck:
+		return fmt.Sprintf("version %d", txn.Version)
+	case datadir.TxnCreateSession:
+		return fmt.Sprintf("timeout %dms", txn.Timeout)
+	case datadir.TxnCloseSession:
+		if len(txn.Paths) > 0 {
+			return fmt.Sprintf("%d ephemerals", len(txn.Paths))
+		}
+	case datadir.TxnError:
+		return fmt.Sprintf("err %d", txn.Err)
+	}
+	return ""
+}
+
+func printSummary(w io.Writer, summary *datadir.Summary) {
+	number := func(n int64) string {
+		if n < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%d", n)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Data directory:\t%s\n", summary.Dir)
+	if summary.LogDir != summary.Dir {
+		fmt.Fprintf(tw, "Log directory:\t%s\n", summary.LogDir)
+	}
+	fmt.Fprintf(tw, "myid:\t%s\n", number(summary.MyId))
+	fmt.Fprintf(tw, "acceptedEpoch:\t%s\n", number(summary.AcceptedEpoch))
+	fmt.Fprintf(tw, "currentEpoch:\t%s\n", number(summary.CurrentEpoch))
+	fmt.Fprintf(tw, "Last zxid:\t%v (epoch %d, counter %d)\n",
+		summary.LastZxid, summary.LastZxid.Epoch(), summary.LastZxid.Counter())
+	fmt.Fprintf(tw, "Sessions:\t%d\n", summary.Sessions)
+	if s := summary.Snapshot; s != nil {
+		fmt.Fprintf(tw, "Snapshot:\t%s\t%d znodes, %d ephemeral, %d sessions\n",
+			filepath.Base(s.Path), s.Nodes, s.Ephemerals, s.Sessions)
+	} else {
+		fmt.Fprintf(tw, "Snapshot:\tnone of %d could be read\n", len(summary.Snapshots))
+	}
+	for i, log := range summary.Logs {
+		label := ""
+		if i == 0 {
+			label = "Logs:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v-%v, %d txns\t%s\n",
+			label, filepath.Base(log.Path), log.FirstZxid, log.LastZxid, log.Txns, log.Err)
+	}
+	tw.Flush()
+	if len(summary.Errors) > 0 {
+		fmt.Fprintln(w, "\nErrors:")
+		for _, err := range summary.Errors {
+			fmt.Fprintln(w, "  "+err)
+		}
+	}
+}
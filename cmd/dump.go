@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/gohm/pkg/command"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/dump"
+	"golang.org/x/net/context"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type exportCommand struct {
+	Hosts   string        `flag:"hosts, ZooKeeper servers of <host>[:<port>] separated by commas"`
+	Auth    string        `flag:"auth, user:password to read as with the digest scheme"`
+	Timeout time.Duration `flag:"timeout, Time to connect and read the whole subtree"`
+	Path    string        `flag:"path, Root of the subtree to export"`
+	Format  string        `flag:"format, Archive format: json or tar"`
+	Out     string        `flag:"out, File to write the archive to.  Standard output if empty"`
+}
+
+type importCommand struct {
+	Hosts   string        `flag:"hosts, ZooKeeper servers of <host>[:<port>] separated by commas"`
+	Auth    string        `flag:"auth, user:password to write as with the digest scheme"`
+	Timeout time.Duration `flag:"timeout, Time to connect and write the whole subtree"`
+	In      string        `flag:"in, File to read a json or tar archive from.  Standard input if empty"`
+	To      string        `flag:"to, Path to recreate the root of the archive at.  Its original path if empty"`
+	Policy  string        `flag:"policy, For znodes that exist with other data or ACL: skip or overwrite or fail"`
+	DryRun  bool          `flag:"dry_run, Only print the changes"`
+}
+
+func init() {
+	export := &exportCommand{
+		Hosts:   "localhost",
+		Timeout: 5 * time.Minute,
+		Path:    "/",
+		Format:  dump.FormatJSON,
+	}
+	command.RegisterFunc("export", export,
+		exitOnError(func(a []string, w io.Writer) error {
+			if err := dump.CheckFormat(export.Format); err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), export.Timeout)
+			defer cancel()
+			zk, err := connect(ctx, export.Hosts, export.Auth)
+			if err != nil {
+				return err
+			}
+			defer zk.Close()
+
+			archive, err := dump.Export(ctx, zk, export.Path)
+			if err != nil {
+				return err
+			}
+			if export.Out == "" {
+				err = archive.Write(w, export.Format)
+			} else {
+				err = writeFile(export.Out, archive, export.Format)
+			}
+			if err != nil {
+				return err
+			}
+			log.Info("Exported ", len(archive.Nodes), " znodes under ", archive.Root, ".")
+			return nil
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "Writes the znodes of a subtree, with their data, stat and ACL, to an archive.  Ephemeral znodes are skipped.")
+		})
+
+	imp := &importCommand{
+		Hosts:   "localhost",
+		Timeout: 5 * time.Minute,
+		Policy:  dump.PolicyFail,
+	}
+	command.RegisterFunc("import", imp,
+		exitOnError(func(a []string, w io.Writer) error {
+			in := io.Reader(os.Stdin)
+			if imp.In != "" {
+				f, err := os.Open(imp.In)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			archive, err := dump.ReadArchive(in)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), imp.Timeout)
+			defer cancel()
+			zk, err := connect(ctx, imp.Hosts, imp.Auth)
+			if err != nil {
+				return err
+			}
+			defer zk.Close()
+
+			changes, err := dump.Import(ctx, zk, archive, dump.ImportOptions{
+				To:     imp.To,
+				Policy: imp.Policy,
+				DryRun: imp.DryRun,
+			})
+			printChanges(w, changes, imp.DryRun)
+			return err
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "Recreates the znodes of an archive.  With -dry_run only prints what would change.")
+		})
+}
+
+// Connects to the servers and authenticates if auth is set.
+func connect(ctx context.Context, hosts, auth string) (*client.Client, error) {
+	zk, err := client.NewClient(hosts)
+	if err != nil {
+		return nil, err
+	}
+	if err := zk.Connect(ctx); err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		if err := zk.AddAuth(ctx, "digest", []byte(auth)); err != nil {
+			zk.Close()
+			return nil, err
+		}
+	}
+	return zk, nil
+}
+
+// Writes the archive to the file, which is closed before returning.
+func writeFile(path string, archive *dump.Archive, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := archive.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Lists the changes other than unchanged znodes, and counts them all.  In a dry run the old and
+// new data and ACL of updated and conflicting znodes are shown where they differ.
+func printChanges(w io.Writer, changes []dump.Change, dryRun bool) {
+	if len(changes) == 0 {
+		return
+	}
+	count := map[string]int{}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, change := range changes {
+		count[change.Action]++
+		if change.Action == dump.ActionUnchanged {
+			continue
+		}
+		differs := []string{}
+		if change.Data {
+			differs = append(differs, "data")
+		}
+		if change.ACL {
+			differs = append(differs, "acl")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", change.Action, change.Path, strings.Join(differs, ","))
+		if dryRun && (change.Action == dump.ActionUpdate || change.Action == dump.ActionConflict) {
+			printDiff(tw, change)
+		}
+	}
+	tw.Flush()
+
+	summary := []string{}
+	for _, action := range []string{dump.ActionCreate, dump.ActionUpdate, dump.ActionSkip, dump.ActionConflict, dump.ActionUnchanged} {
+		summary = append(summary, fmt.Sprintf("%d %s", count[action], action))
+	}
+	if dryRun {
+		fmt.Fprint(w, "Dry run: ")
+	}
+	fmt.Fprintln(w, strings.Join(summary, ", ")+".")
+}
+
+// Old and new data and ACL of the change, where they differ.
+func printDiff(w io.Writer, change dump.Change) {
+	if change.Old == nil || change.New == nil {
+		return
+	}
+	if change.Data {
+		fmt.Fprintf(w, "\t  - data %q\n", change.Old.Data)
+		fmt.Fprintf(w, "\t  + data %q\n", change.New.Data)
+	}
+	if change.ACL {
+		fmt.Fprintf(w, "\t  - acl %s\n", formatACL(change.Old.ACL))
+		fmt.Fprintf(w, "\t  + acl %s\n", formatACL(change.New.ACL))
+	}
+}
+
+func formatACL(acl []client.ACL) string {
+	list := []string{}
+	for _, entry := range acl {
+		list = append(list, entry.String())
+	}
+	return strings.Join(list, ",")
+}
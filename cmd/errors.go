@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/dump"
+	"github.com/conductant/zk/pkg/quorum"
+	"io"
+	"os"
+)
+
+// Exit codes of the commands, by the kind of error.
+const (
+	ExitError            = 1
+	ExitBadSettings      = 2
+	ExitSelfNotFound     = 3
+	ExitMyIdChanged      = 4
+	ExitDiscoveryTimeout = 5
+	ExitStartTimeout     = 6
+	ExitConfigRejected   = 7
+	ExitChildFailed      = 8
+	ExitRollingFailed    = 9
+	ExitConflict         = 10
+	ExitBadDataDir       = 11
+	ExitNoQuorum         = 12
+)
+
+// Exit code of the command that ran, set by exitOnError.  main exits with it once the command has
+// returned, so that its deferred cleanup runs.
+var exitCode = 0
+
+// The flags of a subcommand didn't parse.  The flag package prints why and the usage.
+var errBadFlags = errors.New("err-bad-flags")
+
+// -format is neither table nor json.
+var errBadFormat = errors.New("err-bad-format")
+
+type exitReason struct {
+	code    int
+	message string
+}
+
+var exitReasons = map[error]exitReason{
+	quorum.ErrBadMode:             {ExitBadSettings, "The mode must be exhibitor or native."},
+	quorum.ErrBadConfigHosts:      {ExitBadSettings, "-config_hosts must be names or ips."},
+	quorum.ErrBadHostPort:         {ExitBadSettings, "A member is not of the form [<id>@]<host>[:<client>[:<quorum>:<election>]]."},
+	quorum.ErrConflictingIds:      {ExitBadSettings, "A member is listed more than once with different ids."},
+	quorum.ErrDuplicateId:         {ExitBadSettings, "Two members have the same id."},
+	quorum.ErrBadMetadataProvider: {ExitBadSettings, "-metadata must be ec2 or gce."},
+	quorum.ErrBadReplicas:         {ExitBadSettings, "The number of replicas is not a number."},
+	quorum.ErrBadPodName:          {ExitBadSettings, "The pod name doesn't end with the ordinal of a StatefulSet member."},
+	quorum.ErrNoService:           {ExitBadSettings, "The headless service of the StatefulSet is not set."},
+	quorum.ErrOrdinalOutOfRange:   {ExitBadSettings, "This pod's ordinal is not less than the number of replicas."},
+	quorum.ErrNoCommand:           {ExitBadSettings, "No command to start."},
+	quorum.ErrInvalidConfig:       {ExitBadSettings, "The settings are invalid.  Run validate for all problems."},
+	quorum.ErrBadDataCheck:        {ExitBadSettings, "-data_check must be repair, strict or off."},
+	quorum.ErrBadEndpoint:         {ExitBadSettings, "config_endpoint and status_endpoint must be the urls of config/set and config/get-state on one Exhibitor."},
+	quorum.ErrSelfNotInEnsemble:   {ExitSelfNotFound, "This host is not a member of the ensemble.  Set -ip to one of the members."},
+	quorum.ErrAmbiguousSelf:       {ExitSelfNotFound, "This host matches more than one member of the ensemble.  Set -ip to one of them."},
+	quorum.ErrMyIdChanged:         {ExitMyIdChanged, "The data directory belongs to a server with another id.  Fix the member list or clear the data directory."},
+	quorum.ErrBadAssignment:       {ExitMyIdChanged, "The saved server ids next to the myid file are corrupt."},
+	quorum.ErrBadDataDir:          {ExitBadDataDir, "ZooKeeper can't load the data directory.  Run datadir inspect for details."},
+	quorum.ErrDiscoveryTimeout:    {ExitDiscoveryTimeout, "Not enough members were discovered in time."},
+	quorum.ErrExhibitorTimeout:    {ExitStartTimeout, "Exhibitor did not start ZooKeeper in time."},
+	quorum.ErrZkTimeout:           {ExitStartTimeout, "ZooKeeper did not start serving in time."},
+	quorum.ErrConfigRejected:      {ExitConfigRejected, "Exhibitor rejected the config."},
+	quorum.ErrCrashLoop:           {ExitChildFailed, "The child process kept crashing."},
+	quorum.ErrKilled:              {ExitChildFailed, "The child process was killed."},
+	quorum.ErrNoQuorum:            {ExitNoQuorum, "The ensemble has no quorum."},
+	quorum.ErrQuorumLost:          {ExitRollingFailed, "Quorum was lost during the rolling config change.  It was rolled back."},
+	quorum.ErrRollingTimeout:      {ExitRollingFailed, "The rolling config change did not finish in time.  It was rolled back."},
+	errBadFlags:                   {ExitBadSettings, "Unknown or bad flags.  See the usage above."},
+	errBadFormat:                  {ExitBadSettings, "-format must be table or json."},
+	dump.ErrBadFormat:             {ExitBadSettings, "-format must be json or tar."},
+	dump.ErrBadPolicy:             {ExitBadSettings, "-policy must be skip, overwrite or fail."},
+	dump.ErrBadArchive:            {ExitError, "The archive is not a subtree of znodes written by export."},
+	dump.ErrConflict:              {ExitConflict, "Znodes exist with other data or ACL.  Nothing was imported.  Use -dry_run to see them."},
+}
+
+// Exit code and human-readable message for the error.
+func explain(err error) (int, string) {
+	if reason, has := exitReasons[quorum.Cause(dump.Cause(err))]; has {
+		return reason.code, reason.message
+	}
+	return ExitError, "Failed."
+}
+
+// Wraps the run function of a command so that errors are printed and set the exit code for
+// their kind, instead of panicking.
+func exitOnError(run func([]string, io.Writer) error) func([]string, io.Writer) error {
+	return func(args []string, w io.Writer) error {
+		err := run(args, w)
+		if err == nil {
+			return nil
+		}
+		code, message := explain(err)
+		log.Error("Exiting: ", err)
+		fmt.Fprintln(os.Stderr, message)
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = code
+		return nil
+	}
+}
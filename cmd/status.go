@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/conductant/gohm/pkg/command"
+	"github.com/conductant/zk/pkg/fourletter"
+	"github.com/conductant/zk/pkg/quorum"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type statusCommand struct {
+	Servers       []quorum.HostPort `flag:"S, Quorum members of <host>:<port>"`
+	Observers     []quorum.HostPort `flag:"O, Quorum observers of <host>:<port>"`
+	Format        string            `flag:"format, Output format: table or json"`
+	Timeout       time.Duration     `flag:"timeout, Timeout for probing each member"`
+	ExhibitorPort int               `flag:"exhibitor_port, Also ask each member's Exhibitor on this port. 0 to skip"`
+}
+
+func init() {
+	status := &statusCommand{
+		Format:  "table",
+		Timeout: fourletter.DefaultTimeout,
+	}
+	command.RegisterFunc("status", status,
+		exitOnError(func(a []string, w io.Writer) error {
+			if status.Format != "table" && status.Format != "json" {
+				return errBadFormat
+			}
+			config := &quorum.Config{
+				Servers:   status.Servers,
+				Observers: status.Observers,
+			}
+			if err := config.InitEnsemble(); err != nil {
+				return err
+			}
+
+			result := config.Probe(status.Timeout, status.ExhibitorPort)
+			if status.Format == "json" {
+				buff, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(buff))
+			} else {
+				printStatus(w, result)
+			}
+
+			return result.Err()
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "Reports the health of every member of the ensemble.  Exits 12 if there is no quorum.")
+		})
+}
+
+func printStatus(w io.Writer, status *quorum.EnsembleStatus) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tADDR\tROLE\tMODE\tZXID\tLATENCY\tCONNECTIONS\tOUTSTANDING\tEXHIBITOR\tERROR")
+	for _, m := range status.Members {
+		role := "voter"
+		if m.Observer {
+			role = "observer"
+		}
+		mode := m.Mode
+		if mode == "" {
+			mode = "-"
+		}
+		exhibitor := "-"
+		if m.ExhibitorRunning != nil {
+			exhibitor = fmt.Sprintf("%v", *m.ExhibitorRunning)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t0x%x\t%d/%d/%d\t%d\t%d\t%s\t%s\n",
+			m.Id, m.Addr, role, mode, m.Zxid,
+			m.Latency.Min, m.Latency.Avg, m.Latency.Max,
+			m.Connections, m.Outstanding, exhibitor, m.Error)
+	}
+	tw.Flush()
+
+	quorum := "no"
+	if status.Quorum {
+		quorum = "yes"
+	}
+	fmt.Fprintf(w, "\nQuorum: %s (%d/%d voters serving", quorum, status.ServingVoters, status.Voters)
+	if status.Leader != "" {
+		fmt.Fprintf(w, ", leader %s", status.Leader)
+	}
+	fmt.Fprintln(w, ")")
+}
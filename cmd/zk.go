@@ -7,8 +7,15 @@ import (
 	"github.com/conductant/gohm/pkg/command"
 	"github.com/conductant/gohm/pkg/encoding"
 	"github.com/conductant/gohm/pkg/runtime"
+	"github.com/conductant/zk/pkg/exhibitor"
 	"github.com/conductant/zk/pkg/quorum"
+	"golang.org/x/net/context"
 	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 )
 
@@ -17,14 +24,46 @@ func main() {
 	config := &quorum.Config{
 		MyIdPath: quorum.MyIdFilePath,
 		Exhibitor: quorum.Exhibitor{
-			ReadyTimeout:        encoding.Duration{5 * time.Minute},
-			ReadyPollInterval:   encoding.Duration{5 * time.Second},
-			ConfigEndpoint:      quorum.ZkLocalExhibitorConfigEndpoint,
-			CheckStatusEndpoint: quorum.ZkLocalExhibitorCheckStatusEndpoint,
+			ReadyTimeout:         encoding.Duration{Duration: 5 * time.Minute},
+			ReadyPollInterval:    encoding.Duration{Duration: quorum.DefaultReadyPollInterval},
+			ReadyPollIntervalMax: quorum.DefaultReadyPollIntervalMax,
+			RequestTimeout:       encoding.Duration{Duration: exhibitor.DefaultTimeout},
+			Endpoint:             quorum.ZkLocalExhibitorEndpoint,
+			RollingTimeout:       quorum.DefaultRollingTimeout,
 		},
+		Mode: quorum.ModeExhibitor,
+		Native: quorum.ZooKeeper{
+			ReadyTimeout:         encoding.Duration{Duration: 5 * time.Minute},
+			ReadyPollInterval:    encoding.Duration{Duration: quorum.DefaultReadyPollInterval},
+			ReadyPollIntervalMax: quorum.DefaultReadyPollIntervalMax,
+			ConfigPath:           quorum.ZkLocalConfigPath,
+			DataDirectory:        quorum.ZkLocalDataDirectory,
+			ClientPort:           quorum.DefaultZkClientPort,
+			TickTime:             2000,
+			InitLimit:            10,
+			SyncLimit:            5,
+			StartCommand:         quorum.ZkLocalStartCommand,
+		},
+		Supervisor: quorum.Supervisor{
+			RestartBackoff:    quorum.DefaultRestartBackoff,
+			RestartBackoffMax: quorum.DefaultRestartBackoffMax,
+			MaxRestarts:       quorum.DefaultMaxRestarts,
+			CrashLoopWindow:   quorum.DefaultCrashLoopWindow,
+			LogTailLines:      quorum.DefaultLogTailLines,
+		},
+		ShutdownGracePeriod: quorum.DefaultShutdownGracePeriod,
+		HealthAddr:          quorum.DefaultHealthAddr,
+		MetricsInterval:     quorum.DefaultMetricsInterval,
+		DiscoverTimeout:     quorum.DefaultDiscoverTimeout,
+		DiscoverInterval:    quorum.DefaultDiscoverInterval,
+		ConfigHosts:         quorum.ConfigHostsNames,
+		ResolveInterval:     quorum.DefaultResolveInterval,
+		MetadataTimeout:     quorum.DefaultMetadataTimeout,
+		SeedTimeout:         quorum.DefaultSeedTimeout,
+		DataCheck:           quorum.DataCheckRepair,
 	}
 	command.RegisterFunc("bootstrap", config,
-		func(a []string, w io.Writer) error {
+		exitOnError(func(a []string, w io.Writer) error {
 			defer config.Close()
 
 			if err := config.Init(); err != nil {
@@ -32,66 +71,200 @@ func main() {
 			}
 			log.Info("Initialized")
 
-			buff, err := config.GenerateConfig()
-			if err != nil {
-				return err
+			if config.HealthAddr != "" {
+				listener, err := config.ServeHealth()
+				if err != nil {
+					return err
+				}
+				defer listener.Close()
 			}
-			log.Info("Generated config:", string(buff))
-
-			log.Info("Exhibitor starting.")
-			config.Exhibitor.Start()
 
-			// Block until Exhibitor is up
-			log.Info("Waiting for Exhibitor to come up.")
-			<-config.Exhibitor.Ready
+			// Shut down in order on termination signals.
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+			shutdown := make(chan error, 1)
+			go func() {
+				sig := <-signals
+				log.Info("Received signal ", sig, ".  Shutting down.")
+				go func() {
+					for sig := range signals {
+						log.Info("Already shutting down.  Ignoring signal ", sig)
+					}
+				}()
+				shutdown <- config.Shutdown()
+			}()
 
-			log.Info("Applying config")
-			config.Exhibitor.ApplyConfig("", buff)
+			var buff []byte
+			var err error
+			if config.Mode == quorum.ModeNative {
+				if buff, err = config.GenerateZooCfg(); err != nil {
+					return err
+				}
+				log.Info("Generated zoo.cfg:", string(buff))
 
-			<-config.ZkRunning
-			log.Info("Zookeeper running.")
+				if err := config.Native.WriteConfig(buff); err != nil {
+					return err
+				}
+				log.Info("ZooKeeper starting.")
+			} else {
+				if buff, err = config.GenerateConfig(); err != nil {
+					return err
+				}
+				log.Info("Generated config:", string(buff))
+				log.Info("Exhibitor starting.")
+			}
 
-			// Block forever....
-			done := make(chan bool)
-			<-done
+			// Don't start ZooKeeper on a data directory it can't load.
+			if _, err := config.CheckDataDir(buff); err != nil {
+				return err
+			}
+			if err := config.Start(); err == quorum.ErrShuttingDown {
+				// A signal came before the child was started.
+				return exit(config, shutdown)
+			} else if err != nil {
+				return err
+			}
 
-			return nil
-		},
+			// Give up if the child doesn't come up, so that the container is restarted.
+			if err := config.WaitStarted(context.Background(), buff); err != nil {
+				log.Error("Startup failed: ", err)
+				dumpLogTail(&config.Supervisor)
+				if stopErr := config.Shutdown(); stopErr != nil {
+					log.Warn("Shutdown after failed startup: ", stopErr)
+				}
+				return err
+			}
+			config.StartSeeding()
+			return exit(config, shutdown)
+		}),
 		func(w io.Writer) {
 			fmt.Fprintln(w, "Bootstraps an ensemble member")
 		})
 
-	command.RegisterFunc("print-config", config,
-		func(a []string, w io.Writer) error {
+	command.RegisterFunc("apply-config", config,
+		exitOnError(func(a []string, w io.Writer) error {
 			defer config.Close()
 
-			config.Init()
+			if err := config.Init(); err != nil {
+				return err
+			}
 			buff, err := config.GenerateConfig()
 			if err != nil {
-				panic(err)
+				return err
+			}
+
+			if !config.Rolling {
+				log.Info("Applying config")
+				return config.Exhibitor.ApplyConfig("", buff)
 			}
-			c := map[string]interface{}{}
-			err = json.Unmarshal(buff, &c)
+
+			log.Info("Applying config one server at a time")
+			ctx, cancel := context.WithTimeout(context.Background(), config.RollingTimeout)
+			defer cancel()
+			return config.ApplyConfigRolling(ctx, "", buff)
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "Applies the generated config to a running Exhibitor")
+		})
+
+	command.RegisterFunc("validate", config,
+		exitOnError(func(a []string, w io.Writer) error {
+			problems := config.Validate()
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			for _, p := range problems {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Severity, p.Check, p.Message)
+			}
+			tw.Flush()
+
+			voters := len(config.Voters())
+			fmt.Fprintf(w, "%d voters tolerating %d failures, %d observers.  %d errors, %d warnings.\n",
+				voters, quorum.FaultTolerance(voters), len(config.Ensemble())-voters,
+				problems.Count(quorum.SeverityError), problems.Count(quorum.SeverityWarning))
+			return problems.Err()
+		}),
+		func(w io.Writer) {
+			fmt.Fprintln(w, "Checks the ensemble settings and reports all problems.  Exits 2 if there are errors.")
+		})
+
+	command.RegisterFunc("print-config", config,
+		exitOnError(func(a []string, w io.Writer) error {
+			defer config.Close()
+
+			if err := config.Init(); err != nil {
+				log.Warn("Cannot initialize: ", err)
+			}
+
+			myid, err := config.GetMyId()
 			if err != nil {
 				return err
 			}
 
 			// Dump out in json format
 			m := map[string]interface{}{
-				"myid":     config.GetMyId(),
+				"myid":     myid,
 				"zk_hosts": config.GetZkHosts(),
-				"config":   c,
 			}
-			buff, err = json.MarshalIndent(m, "  ", "  ")
+			if config.Mode == quorum.ModeNative {
+				buff, err := config.GenerateZooCfg()
+				if err != nil {
+					return err
+				}
+				m["zoo_cfg"] = strings.Split(string(buff), "\n")
+			} else {
+				buff, err := config.GenerateConfig()
+				if err != nil {
+					return err
+				}
+				c := map[string]interface{}{}
+				err = json.Unmarshal(buff, &c)
+				if err != nil {
+					return err
+				}
+				m["config"] = c
+			}
+			buff, err := json.MarshalIndent(m, "  ", "  ")
 			if err != nil {
 				return err
 			}
 			fmt.Fprint(w, string(buff))
 			return nil
-		},
+		}),
 		func(w io.Writer) {
 			fmt.Fprintln(w, "For test only")
 		})
 
 	runtime.Main()
+	os.Exit(exitCode)
+}
+
+// Logs the last lines of the child's output.
+func dumpLogTail(supervisor *quorum.Supervisor) {
+	lines := supervisor.LogTail()
+	if len(lines) == 0 {
+		return
+	}
+	log.Error("Last ", len(lines), " lines of ", supervisor.Name, " output:")
+	for _, line := range lines {
+		fmt.Fprintln(os.Stderr, "  | "+line)
+	}
+}
+
+// Blocks until the supervised child finishes.  Returns the error if the supervisor gave up or
+// if any step of the shutdown failed.
+func exit(config *quorum.Config, shutdown <-chan error) error {
+	var err error
+	select {
+	case err = <-shutdown:
+	case <-config.Supervisor.Done:
+		if config.ShuttingDown() {
+			err = <-shutdown
+		} else {
+			err = config.Supervisor.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Stopped.")
+	return nil
 }
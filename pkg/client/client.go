@@ -0,0 +1,292 @@
+// Client for ZooKeeper's own protocol.  A client keeps one session, moving it between the
+// servers when the connection is lost.  An expired session ends the client; make a new one.
+// See https://zookeeper.apache.org/doc/r3.4.6/zookeeperProgrammers.html
+package client
+
+import (
+	"github.com/conductant/zk/pkg/jute"
+	"golang.org/x/net/context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPort           = 2181
+	DefaultSessionTimeout = 10 * time.Second
+	DefaultDialTimeout    = 5 * time.Second
+	DefaultRetryInterval  = time.Second
+
+	// Matches any version in Delete, Set, SetACL and CheckOp
+	AnyVersion = -1
+
+	// Session events buffered.  Events are dropped if nobody reads them.
+	EventBufferSize = 16
+)
+
+type SessionState int32
+
+const (
+	StateDisconnected SessionState = 0
+	StateConnecting   SessionState = 1
+	StateConnected    SessionState = 3
+	StateAuthFailed   SessionState = 4
+	StateExpired      SessionState = -112
+	StateClosed       SessionState = -11
+)
+
+func (this SessionState) String() string {
+	switch this {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateAuthFailed:
+		return "auth-failed"
+	case StateExpired:
+		return "expired"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown-" + strconv.Itoa(int(this))
+}
+
+type EventType int32
+
+const (
+	EventSession             EventType = -1 // The session changed state
+	EventNodeCreated         EventType = 1
+	EventNodeDeleted         EventType = 2
+	EventNodeDataChanged     EventType = 3
+	EventNodeChildrenChanged EventType = 4
+	EventNotWatching         EventType = -2 // The session ended before the watch triggered
+)
+
+func (this EventType) String() string {
+	switch this {
+	case EventSession:
+		return "session"
+	case EventNodeCreated:
+		return "node-created"
+	case EventNodeDeleted:
+		return "node-deleted"
+	case EventNodeDataChanged:
+		return "node-data-changed"
+	case EventNodeChildrenChanged:
+		return "node-children-changed"
+	case EventNotWatching:
+		return "not-watching"
+	}
+	return "unknown-" + strconv.Itoa(int(this))
+}
+
+// A session state change or a triggered watch
+type Event struct {
+	Type  EventType
+	State SessionState
+	Path  string
+	Err   error
+}
+
+type Client struct {
+	// host:port of the servers.  Connections start at a random one and go round.
+	Servers        []string
+	SessionTimeout time.Duration
+	// Timeout of connecting to a server, including the session handshake
+	DialTimeout time.Duration
+	// Wait after failing to connect to every server before trying them again
+	RetryInterval time.Duration
+
+	queue   chan *request
+	events  chan Event
+	closing chan interface{}
+	done    chan interface{}
+	once    sync.Once
+
+	lock      sync.Mutex
+	started   bool
+	state     SessionState
+	changed   chan interface{} // Closed and replaced on every state change
+	err       error            // Why the client stopped
+	lastErr   error            // Why the last connection failed
+	sessionId int64
+	password  []byte
+	timeout   time.Duration // Negotiated session timeout
+	lastZxid  int64
+	xid       int32
+	pending   map[int32]*request
+	authQueue []*request // Auth requests awaiting replies in order.  Nil for re-sent ones.
+	auths     []*authPacket
+	watchers  map[watchKey][]chan Event
+}
+
+// A request waiting for its reply.  The reply is decoded into resp.
+type request struct {
+	opcode int32
+	req    jute.Record
+	resp   jute.Record
+	watch  *watchRequest
+	done   chan error
+}
+
+// Takes a comma separated list of host:port, like the connection string of other clients.
+// The port defaults to 2181.  Chroot paths aren't supported.
+func NewClient(hosts string) (*Client, error) {
+	servers := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if strings.Contains(host, "/") {
+			return nil, ErrBadHosts
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(DefaultPort))
+		}
+		servers = append(servers, host)
+	}
+	if len(servers) == 0 {
+		return nil, ErrBadHosts
+	}
+	return &Client{
+		Servers:        servers,
+		SessionTimeout: DefaultSessionTimeout,
+		DialTimeout:    DefaultDialTimeout,
+		RetryInterval:  DefaultRetryInterval,
+		queue:          make(chan *request),
+		events:         make(chan Event, EventBufferSize),
+		closing:        make(chan interface{}),
+		done:           make(chan interface{}),
+		state:          StateDisconnected,
+		changed:        make(chan interface{}),
+		password:       make([]byte, passwordLength),
+		pending:        map[int32]*request{},
+		watchers:       map[watchKey][]chan Event{},
+	}, nil
+}
+
+// Starts the session and blocks until connected.  On failure or if the context is done first,
+// the client is closed and the error of the last attempt to connect is returned.
+func (this *Client) Connect(ctx context.Context) error {
+	this.lock.Lock()
+	if !this.started {
+		select {
+		case <-this.closing:
+			this.lock.Unlock()
+			return ErrClosed
+		default:
+		}
+		this.started = true
+		this.setState(StateConnecting, nil)
+		go this.loop()
+	}
+	this.lock.Unlock()
+
+	for {
+		this.lock.Lock()
+		state, changed, err := this.state, this.changed, this.err
+		this.lock.Unlock()
+
+		switch state {
+		case StateConnected:
+			return nil
+		case StateExpired, StateClosed:
+			return err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			this.lock.Lock()
+			lastErr := this.lastErr
+			this.lock.Unlock()
+			this.Close()
+			if lastErr != nil {
+				return lastErr
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// Ends the session.  Ephemeral nodes of the session are deleted.
+func (this *Client) Close() error {
+	this.once.Do(func() {
+		close(this.closing)
+	})
+	this.lock.Lock()
+	started := this.started
+	this.lock.Unlock()
+	if started {
+		<-this.done
+	} else {
+		this.stop(ErrClosed)
+	}
+	return nil
+}
+
+func (this *Client) State() SessionState {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.state
+}
+
+func (this *Client) SessionId() int64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.sessionId
+}
+
+// Why the client stopped, ErrSessionExpired or ErrClosed.  Nil while running.
+func (this *Client) Err() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.err
+}
+
+// Session state changes.  The channel is closed when the client stops.
+func (this *Client) Events() <-chan Event {
+	return this.events
+}
+
+// Closed when the client stops
+func (this *Client) Done() <-chan interface{} {
+	return this.done
+}
+
+// Must be called with the lock held
+func (this *Client) setState(state SessionState, err error) {
+	if state == this.state {
+		return
+	}
+	this.state = state
+	close(this.changed)
+	this.changed = make(chan interface{})
+	select {
+	case this.events <- Event{Type: EventSession, State: state, Err: err}:
+	default:
+	}
+}
+
+// Sends the request when connected and waits for the reply.  If the context is done first,
+// the reply is ignored but the request may still be applied.
+func (this *Client) call(ctx context.Context, opcode int32, req, resp jute.Record, watch *watchRequest) error {
+	r := &request{opcode: opcode, req: req, resp: resp, watch: watch, done: make(chan error, 1)}
+	select {
+	case this.queue <- r:
+	case <-this.done:
+		return this.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-r.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
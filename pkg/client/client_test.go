@@ -0,0 +1,397 @@
+package client
+
+import (
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) { TestingT(t) }
+
+type TestSuiteClient struct {
+}
+
+var _ = Suite(&TestSuiteClient{})
+
+func (suite *TestSuiteClient) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteClient) TearDownSuite(c *C) {
+}
+
+// Connects a client with short timeouts to the server
+func (suite *TestSuiteClient) connect(c *C, server *testServer) *Client {
+	client, err := NewClient(server.addrs())
+	c.Assert(err, IsNil)
+	client.SessionTimeout = 600 * time.Millisecond
+	client.DialTimeout = 200 * time.Millisecond
+	client.RetryInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(client.Connect(ctx), IsNil)
+	return client
+}
+
+// Waits for the session to reach the state
+func waitState(c *C, client *Client, state SessionState) {
+	for i := 0; i < 200 && client.State() != state; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(client.State(), Equals, state)
+}
+
+func waitEvent(c *C, watch <-chan Event) Event {
+	select {
+	case event := <-watch:
+		return event
+	case <-time.After(time.Second):
+		c.Fatal("No event")
+	}
+	return Event{}
+}
+
+func (suite *TestSuiteClient) TestNewClient(c *C) {
+	client, err := NewClient("zk-1:2182, zk-2 ,[fd00::3]:2183,fd00::4")
+	c.Assert(err, IsNil)
+	c.Assert(client.Servers, DeepEquals, []string{"zk-1:2182", "zk-2:2181", "[fd00::3]:2183", "[fd00::4]:2181"})
+	c.Assert(client.State(), Equals, StateDisconnected)
+
+	_, err = NewClient(" , ")
+	c.Assert(err, Equals, ErrBadHosts)
+	_, err = NewClient("zk-1:2181,zk-2:2181/app")
+	c.Assert(err, Equals, ErrBadHosts)
+}
+
+func (suite *TestSuiteClient) TestValidatePath(c *C) {
+	for _, p := range []string{"/", "/a", "/a/b.c", "/a/.b"} {
+		c.Assert(validatePath(p, false), IsNil, Commentf(p))
+	}
+	for _, p := range []string{"", "a", "/a/", "//a", "/a//b", "/a/./b", "/..", "/a\x00"} {
+		c.Assert(validatePath(p, false), Equals, ErrBadPath, Commentf(p))
+	}
+	c.Assert(validatePath("/queue/", true), IsNil)
+	c.Assert(validatePath("/queue/item-", true), IsNil)
+}
+
+func (suite *TestSuiteClient) TestDigestACL(c *C) {
+	c.Assert(DigestACL(PermAll, "super", "admin"), DeepEquals,
+		[]ACL{{Perms: 31, Scheme: "digest", Id: "super:xQJmxLMiHGwaqBvst5y6rkB6HQs="}})
+}
+
+func (suite *TestSuiteClient) TestACLString(c *C) {
+	c.Assert(OpenACL[0].String(), Equals, "world:anyone:cdrwa")
+	c.Assert(WorldACL(PermRead | PermWrite)[0].String(), Equals, "world:anyone:rw")
+	c.Assert(ACL{Scheme: "ip", Id: "10.0.0.0/8"}.String(), Equals, "ip:10.0.0.0/8:")
+}
+
+func (suite *TestSuiteClient) TestCrud(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	created, err := client.Create(ctx, "/app", []byte("v1"), 0, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(created, Equals, "/app")
+	_, err = client.Create(ctx, "/app", nil, 0, OpenACL)
+	c.Assert(err, Equals, ErrNodeExists)
+	_, err = client.Create(ctx, "/missing/child", nil, 0, OpenACL)
+	c.Assert(err, Equals, ErrNoNode)
+	_, err = client.Create(ctx, "app", nil, 0, OpenACL)
+	c.Assert(err, Equals, ErrBadPath)
+
+	data, stat, err := client.Get(ctx, "/app")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "v1")
+	c.Assert(stat.Version, Equals, int32(0))
+	c.Assert(stat.DataLength, Equals, int32(2))
+
+	stat, err = client.Set(ctx, "/app", []byte("v2"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Version, Equals, int32(1))
+	_, err = client.Set(ctx, "/app", []byte("v3"), 0)
+	c.Assert(err, Equals, ErrBadVersion)
+
+	first, err := client.Create(ctx, "/app/item-", nil, FlagSequence, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(first, Equals, "/app/item-0000000000")
+	second, err := client.Create(ctx, "/app/item-", nil, FlagSequence|FlagEphemeral, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(second, Equals, "/app/item-0000000001")
+
+	children, stat, err := client.Children(ctx, "/app")
+	c.Assert(err, IsNil)
+	c.Assert(children, DeepEquals, []string{"item-0000000000", "item-0000000001"})
+	c.Assert(stat.NumChildren, Equals, int32(2))
+
+	exists, stat, err := client.Exists(ctx, second)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+	c.Assert(stat.EphemeralOwner, Equals, client.SessionId())
+	exists, stat, err = client.Exists(ctx, "/missing")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+	c.Assert(stat, IsNil)
+
+	c.Assert(client.Delete(ctx, "/app", AnyVersion), Equals, ErrNotEmpty)
+	c.Assert(client.Delete(ctx, first, 1), Equals, ErrBadVersion)
+	c.Assert(client.Delete(ctx, first, 0), IsNil)
+	c.Assert(client.Delete(ctx, first, 0), Equals, ErrNoNode)
+	_, _, err = client.Get(ctx, first)
+	c.Assert(err, Equals, ErrNoNode)
+
+	acl := DigestACL(PermRead, "app", "secret")
+	stat, err = client.SetACL(ctx, "/app", acl, 0)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Aversion, Equals, int32(1))
+	got, _, err := client.GetACL(ctx, "/app")
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, acl)
+
+	c.Assert(client.Sync(ctx, "/app"), IsNil)
+}
+
+func (suite *TestSuiteClient) TestWatches(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	exists, _, created, err := client.ExistsW(ctx, "/app")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+	_, err = client.Create(ctx, "/app", []byte("v1"), 0, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(waitEvent(c, created), DeepEquals, Event{Type: EventNodeCreated, State: StateConnected, Path: "/app"})
+	_, open := <-created
+	c.Assert(open, Equals, false)
+
+	_, _, changed, err := client.GetW(ctx, "/app")
+	c.Assert(err, IsNil)
+	_, _, children, err := client.ChildrenW(ctx, "/app")
+	c.Assert(err, IsNil)
+	_, _, deleted, err := client.ExistsW(ctx, "/app")
+	c.Assert(err, IsNil)
+
+	_, err = client.Set(ctx, "/app", []byte("v2"), AnyVersion)
+	c.Assert(err, IsNil)
+	c.Assert(waitEvent(c, changed).Type, Equals, EventNodeDataChanged)
+	c.Assert(waitEvent(c, deleted).Type, Equals, EventNodeDataChanged)
+
+	_, err = client.Create(ctx, "/app/child", nil, 0, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(waitEvent(c, children).Type, Equals, EventNodeChildrenChanged)
+
+	// No watch is set when the operation fails
+	_, _, watch, err := client.GetW(ctx, "/missing")
+	c.Assert(err, Equals, ErrNoNode)
+	c.Assert(watch, IsNil)
+}
+
+func (suite *TestSuiteClient) TestMulti(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	results, err := client.Multi(ctx,
+		&CreateOp{Path: "/app", Data: []byte("v1"), ACL: OpenACL},
+		&CreateOp{Path: "/app/lock-", Flags: FlagSequence, ACL: OpenACL},
+		&SetOp{Path: "/app", Data: []byte("v2"), Version: 0},
+		&CheckOp{Path: "/app", Version: 1},
+	)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 4)
+	c.Assert(results[0].Path, Equals, "/app")
+	c.Assert(results[1].Path, Equals, "/app/lock-0000000000")
+	c.Assert(results[2].Stat.Version, Equals, int32(1))
+
+	results, err = client.Multi(ctx,
+		&DeleteOp{Path: "/app/lock-0000000000", Version: AnyVersion},
+		&CheckOp{Path: "/app", Version: 0},
+		&DeleteOp{Path: "/app", Version: AnyVersion},
+	)
+	c.Assert(err, Equals, ErrBadVersion)
+	c.Assert(results, HasLen, 3)
+	c.Assert(results[0].Err, IsNil)
+	c.Assert(results[1].Err, Equals, ErrBadVersion)
+	c.Assert(results[2].Err, Equals, ErrRuntimeInconsistency)
+
+	// Nothing was applied
+	children, _, err := client.Children(ctx, "/app")
+	c.Assert(err, IsNil)
+	c.Assert(children, DeepEquals, []string{"lock-0000000000"})
+
+	_, err = client.Multi(ctx, &DeleteOp{Path: "app/"})
+	c.Assert(err, Equals, ErrBadPath)
+}
+
+func (suite *TestSuiteClient) TestReconnect(c *C) {
+	server := newTestServer()
+	server.listen()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	c.Assert(client.AddAuth(ctx, "digest", []byte("app:secret")), IsNil)
+	_, err := client.Create(ctx, "/app", nil, FlagEphemeral, OpenACL)
+	c.Assert(err, IsNil)
+	_, _, watch, err := client.GetW(ctx, "/app")
+	c.Assert(err, IsNil)
+	for len(client.Events()) > 0 {
+		<-client.Events()
+	}
+
+	session := client.SessionId()
+	first := server.connectedTo(session)
+	server.stop(first)
+	waitState(c, client, StateConnected)
+	c.Assert(client.SessionId(), Equals, session)
+	c.Assert(server.connectedTo(session), Not(Equals), first)
+	c.Assert(waitEvent(c, client.Events()).State, Equals, StateDisconnected)
+	c.Assert(waitEvent(c, client.Events()).State, Equals, StateConnected)
+
+	// The credentials and the watch moved with the session, and so did the ephemeral node
+	_, err = client.Set(ctx, "/app", []byte("v2"), AnyVersion)
+	c.Assert(err, IsNil)
+	c.Assert(server.count(opAuth), Equals, 2)
+	c.Assert(server.count(opSetWatches), Equals, 1)
+	c.Assert(waitEvent(c, watch).Type, Equals, EventNodeDataChanged)
+}
+
+func (suite *TestSuiteClient) TestWatchRestored(c *C) {
+	server := newTestServer()
+	addr := server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	_, err := client.Create(ctx, "/app", nil, 0, OpenACL)
+	c.Assert(err, IsNil)
+	_, _, watch, err := client.GetW(ctx, "/app")
+	c.Assert(err, IsNil)
+
+	// Changed while the client was away
+	server.stop(addr)
+	waitState(c, client, StateDisconnected)
+	server.update("/app", []byte("v2"))
+	server.listenOn(addr)
+	waitState(c, client, StateConnected)
+	c.Assert(waitEvent(c, watch).Type, Equals, EventNodeDataChanged)
+}
+
+func (suite *TestSuiteClient) TestPing(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+
+	// Idle for longer than the session timeout
+	time.Sleep(time.Second)
+	c.Assert(client.State(), Equals, StateConnected)
+	pings := server.count(opPing)
+	c.Assert(pings >= 3, Equals, true, Commentf("%d pings", pings))
+}
+
+func (suite *TestSuiteClient) TestAuthFailed(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+
+	c.Assert(client.AddAuth(context.Background(), "unknown", []byte("x")), Equals, ErrAuthFailed)
+	waitState(c, client, StateConnected)
+	_, err := client.Create(context.Background(), "/app", nil, 0, OpenACL)
+	c.Assert(err, IsNil)
+}
+
+func (suite *TestSuiteClient) TestExpired(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	defer client.Close()
+	ctx := context.Background()
+
+	_, err := client.Create(ctx, "/lock", nil, FlagEphemeral, OpenACL)
+	c.Assert(err, IsNil)
+	_, _, watch, err := client.GetW(ctx, "/lock")
+	c.Assert(err, IsNil)
+
+	server.expire(client.SessionId())
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		c.Fatal("Not expired")
+	}
+	c.Assert(client.Err(), Equals, ErrSessionExpired)
+	c.Assert(client.State(), Equals, StateExpired)
+	c.Assert(waitEvent(c, watch), DeepEquals,
+		Event{Type: EventNotWatching, State: StateExpired, Path: "/lock", Err: ErrSessionExpired})
+	_, _, err = client.Get(ctx, "/lock")
+	c.Assert(err, Equals, ErrSessionExpired)
+
+	other := suite.connect(c, server)
+	defer other.Close()
+	exists, _, err := other.Exists(ctx, "/lock")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (suite *TestSuiteClient) TestClose(c *C) {
+	server := newTestServer()
+	server.listen()
+	defer server.close()
+	client := suite.connect(c, server)
+	ctx := context.Background()
+
+	_, err := client.Create(ctx, "/lock", nil, FlagEphemeral, OpenACL)
+	c.Assert(err, IsNil)
+	c.Assert(client.Close(), IsNil)
+	c.Assert(client.Close(), IsNil)
+	c.Assert(client.State(), Equals, StateClosed)
+	_, _, err = client.Get(ctx, "/lock")
+	c.Assert(err, Equals, ErrClosed)
+
+	c.Assert(server.last(), Equals, int32(opCloseSession))
+	other := suite.connect(c, server)
+	defer other.Close()
+	exists, _, err := other.Exists(ctx, "/lock")
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	events := []SessionState{}
+	for event := range client.Events() {
+		events = append(events, event.State)
+	}
+	c.Assert(events, DeepEquals, []SessionState{StateConnecting, StateConnected, StateClosed})
+}
+
+func (suite *TestSuiteClient) TestConnectTimeout(c *C) {
+	server := newTestServer()
+	addr := server.listen()
+	server.close()
+
+	client, err := NewClient(addr)
+	c.Assert(err, IsNil)
+	client.RetryInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = client.Connect(ctx)
+	c.Assert(err, ErrorMatches, ".*connection refused")
+	c.Assert(client.Err(), Equals, ErrClosed)
+
+	c.Assert(client.Connect(context.Background()), Equals, ErrClosed)
+}
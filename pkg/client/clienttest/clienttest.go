@@ -0,0 +1,181 @@
+// Znodes in memory that stand in for a client, for tests.
+package clienttest
+
+import (
+	"github.com/conductant/zk/pkg/client"
+	"golang.org/x/net/context"
+	"path"
+	"sync"
+)
+
+// Written in place of the data of missing znodes by Data.
+const NoData = "<none>"
+
+// A znode in memory.
+type Znode struct {
+	Data []byte
+	Stat client.Stat
+	ACL  []client.ACL
+}
+
+// Znodes in memory with the operations of the client.  Only existence watches on deletion are
+// supported.
+type Znodes struct {
+	nodes   map[string]*Znode
+	watches map[string][]chan client.Event
+	writes  int
+	lock    sync.Mutex
+}
+
+// Just the root, open to everyone.
+func NewZnodes() *Znodes {
+	return &Znodes{
+		nodes:   map[string]*Znode{"/": {ACL: client.OpenACL}},
+		watches: map[string][]chan client.Event{},
+	}
+}
+
+// Adds the znode without counting it as a write.
+func (this *Znodes) Add(p, data string, acl []client.ACL, ephemeral bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	node := &Znode{Data: []byte(data), ACL: acl}
+	if ephemeral {
+		node.Stat.EphemeralOwner = 1
+	}
+	this.nodes[p] = node
+}
+
+// Data of the znode, or NoData if it doesn't exist.
+func (this *Znodes) Data(p string) string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if node := this.nodes[p]; node != nil {
+		return string(node.Data)
+	}
+	return NoData
+}
+
+// ACL of the znode, or nil if it doesn't exist.
+func (this *Znodes) ACL(p string) []client.ACL {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if node := this.nodes[p]; node != nil {
+		return node.ACL
+	}
+	return nil
+}
+
+// Number of creates, deletes and sets so far, including failed ones.
+func (this *Znodes) Writes() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.writes
+}
+
+func (this *Znodes) Create(ctx context.Context, p string, data []byte, flags int32, acl []client.ACL) (string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writes++
+	if this.nodes[path.Dir(p)] == nil {
+		return "", client.ErrNoNode
+	}
+	if this.nodes[p] != nil {
+		return "", client.ErrNodeExists
+	}
+	node := &Znode{Data: data, ACL: acl}
+	if flags&client.FlagEphemeral != 0 {
+		node.Stat.EphemeralOwner = 1
+	}
+	this.nodes[p] = node
+	return p, nil
+}
+
+func (this *Znodes) Delete(ctx context.Context, p string, version int32) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writes++
+	if this.nodes[p] == nil {
+		return client.ErrNoNode
+	}
+	delete(this.nodes, p)
+	for _, ch := range this.watches[p] {
+		ch <- client.Event{Type: client.EventNodeDeleted, Path: p}
+		close(ch)
+	}
+	delete(this.watches, p)
+	return nil
+}
+
+func (this *Znodes) ExistsW(ctx context.Context, p string) (bool, *client.Stat, <-chan client.Event, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	ch := make(chan client.Event, 1)
+	this.watches[p] = append(this.watches[p], ch)
+	if node := this.nodes[p]; node != nil {
+		stat := node.Stat
+		return true, &stat, ch, nil
+	}
+	return false, nil, ch, nil
+}
+
+func (this *Znodes) Get(ctx context.Context, p string) ([]byte, *client.Stat, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if node := this.nodes[p]; node != nil {
+		stat := node.Stat
+		return node.Data, &stat, nil
+	}
+	return nil, nil, client.ErrNoNode
+}
+
+func (this *Znodes) GetACL(ctx context.Context, p string) ([]client.ACL, *client.Stat, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if node := this.nodes[p]; node != nil {
+		stat := node.Stat
+		return node.ACL, &stat, nil
+	}
+	return nil, nil, client.ErrNoNode
+}
+
+func (this *Znodes) Children(ctx context.Context, p string) ([]string, *client.Stat, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	node := this.nodes[p]
+	if node == nil {
+		return nil, nil, client.ErrNoNode
+	}
+	children := []string{}
+	for child := range this.nodes {
+		if child != "/" && path.Dir(child) == p {
+			children = append(children, path.Base(child))
+		}
+	}
+	stat := node.Stat
+	return children, &stat, nil
+}
+
+func (this *Znodes) Set(ctx context.Context, p string, data []byte, version int32) (*client.Stat, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writes++
+	if node := this.nodes[p]; node != nil {
+		node.Data = data
+		stat := node.Stat
+		return &stat, nil
+	}
+	return nil, client.ErrNoNode
+}
+
+func (this *Znodes) SetACL(ctx context.Context, p string, acl []client.ACL, version int32) (*client.Stat, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writes++
+	if node := this.nodes[p]; node != nil {
+		node.ACL = acl
+		stat := node.Stat
+		return &stat, nil
+	}
+	return nil, client.ErrNoNode
+}
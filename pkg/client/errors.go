@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the server
+var (
+	ErrSystemError             = errors.New("err-system-error")
+	ErrRuntimeInconsistency    = errors.New("err-runtime-inconsistency")
+	ErrDataInconsistency       = errors.New("err-data-inconsistency")
+	ErrMarshallingError        = errors.New("err-marshalling-error")
+	ErrUnimplemented           = errors.New("err-unimplemented")
+	ErrOperationTimeout        = errors.New("err-operation-timeout")
+	ErrBadArguments            = errors.New("err-bad-arguments")
+	ErrApiError                = errors.New("err-api-error")
+	ErrNoNode                  = errors.New("err-no-node")
+	ErrNoAuth                  = errors.New("err-no-auth")
+	ErrBadVersion              = errors.New("err-bad-version")
+	ErrNoChildrenForEphemerals = errors.New("err-no-children-for-ephemerals")
+	ErrNodeExists              = errors.New("err-node-exists")
+	ErrNotEmpty                = errors.New("err-not-empty")
+	ErrSessionExpired          = errors.New("err-session-expired")
+	ErrInvalidCallback         = errors.New("err-invalid-callback")
+	ErrInvalidACL              = errors.New("err-invalid-acl")
+	ErrAuthFailed              = errors.New("err-auth-failed")
+	ErrSessionMoved            = errors.New("err-session-moved")
+	ErrNotReadOnly             = errors.New("err-not-read-only")
+)
+
+// Errors of the client
+var (
+	ErrBadHosts       = errors.New("err-bad-hosts")
+	ErrBadPath        = errors.New("err-bad-path")
+	ErrBadResponse    = errors.New("err-bad-response")
+	ErrConnectionLoss = errors.New("err-connection-loss")
+	ErrClosed         = errors.New("err-closed")
+)
+
+var codeErrors = map[int32]error{
+	-1:   ErrSystemError,
+	-2:   ErrRuntimeInconsistency,
+	-3:   ErrDataInconsistency,
+	-4:   ErrConnectionLoss,
+	-5:   ErrMarshallingError,
+	-6:   ErrUnimplemented,
+	-7:   ErrOperationTimeout,
+	-8:   ErrBadArguments,
+	-100: ErrApiError,
+	-101: ErrNoNode,
+	-102: ErrNoAuth,
+	-103: ErrBadVersion,
+	-108: ErrNoChildrenForEphemerals,
+	-110: ErrNodeExists,
+	-111: ErrNotEmpty,
+	-112: ErrSessionExpired,
+	-113: ErrInvalidCallback,
+	-114: ErrInvalidACL,
+	-115: ErrAuthFailed,
+	-118: ErrSessionMoved,
+	-119: ErrNotReadOnly,
+}
+
+// The error of a code in a reply.  Returns nil for 0.
+func codeError(code int32) error {
+	if code == 0 {
+		return nil
+	}
+	if err, has := codeErrors[code]; has {
+		return err
+	}
+	return fmt.Errorf("err-unknown-code:%d", code)
+}
+
+// The code of an error of the server.  Returns -1, a system error, for other errors.
+func errorCode(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	for code, e := range codeErrors {
+		if e == err {
+			return code
+		}
+	}
+	return -1
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"github.com/conductant/zk/pkg/jute"
+)
+
+// An operation of Multi: *CreateOp, *DeleteOp, *SetOp or *CheckOp
+type Op interface {
+	validate() error
+	request() (int32, jute.Record)
+}
+
+type CreateOp struct {
+	Path  string
+	Data  []byte
+	Flags int32
+	ACL   []ACL
+}
+
+type DeleteOp struct {
+	Path    string
+	Version int32
+}
+
+type SetOp struct {
+	Path    string
+	Data    []byte
+	Version int32
+}
+
+// Fails the multi unless the version of the node matches.
+type CheckOp struct {
+	Path    string
+	Version int32
+}
+
+func (this *CreateOp) validate() error {
+	return validatePath(this.Path, this.Flags&FlagSequence != 0)
+}
+
+func (this *CreateOp) request() (int32, jute.Record) {
+	return opCreate, &createRequest{Path: this.Path, Data: this.Data, ACL: this.ACL, Flags: this.Flags}
+}
+
+func (this *DeleteOp) validate() error {
+	return validatePath(this.Path, false)
+}
+
+func (this *DeleteOp) request() (int32, jute.Record) {
+	return opDelete, &pathVersionRecord{Path: this.Path, Version: this.Version}
+}
+
+func (this *SetOp) validate() error {
+	return validatePath(this.Path, false)
+}
+
+func (this *SetOp) request() (int32, jute.Record) {
+	return opSetData, &setDataRequest{Path: this.Path, Data: this.Data, Version: this.Version}
+}
+
+func (this *CheckOp) validate() error {
+	return validatePath(this.Path, false)
+}
+
+func (this *CheckOp) request() (int32, jute.Record) {
+	return opCheck, &pathVersionRecord{Path: this.Path, Version: this.Version}
+}
+
+// Result of an operation of Multi.  Path is set for CreateOp and Stat for SetOp.
+type OpResult struct {
+	Path string
+	Stat *Stat
+	Err  error
+
+	opcode int32
+}
+
+type multiRequest struct {
+	Ops []Op
+}
+
+func (this *multiRequest) Encode(e *jute.Encoder) {
+	for _, op := range this.Ops {
+		opcode, record := op.request()
+		(&multiHeader{Type: opcode, Done: false, Err: -1}).Encode(e)
+		record.Encode(e)
+	}
+	(&multiHeader{Type: -1, Done: true, Err: -1}).Encode(e)
+}
+
+func (this *multiRequest) Decode(d *jute.Decoder) {
+	this.Ops = nil
+	for d.Err() == nil {
+		header := &multiHeader{}
+		header.Decode(d)
+		if header.Done {
+			return
+		}
+		var op Op
+		switch header.Type {
+		case opCreate:
+			r := &createRequest{}
+			r.Decode(d)
+			op = &CreateOp{Path: r.Path, Data: r.Data, Flags: r.Flags, ACL: r.ACL}
+		case opDelete:
+			r := &pathVersionRecord{}
+			r.Decode(d)
+			op = &DeleteOp{Path: r.Path, Version: r.Version}
+		case opSetData:
+			r := &setDataRequest{}
+			r.Decode(d)
+			op = &SetOp{Path: r.Path, Data: r.Data, Version: r.Version}
+		case opCheck:
+			r := &pathVersionRecord{}
+			r.Decode(d)
+			op = &CheckOp{Path: r.Path, Version: r.Version}
+		default:
+			return
+		}
+		this.Ops = append(this.Ops, op)
+	}
+}
+
+type multiResponse struct {
+	Results []OpResult
+}
+
+func (this *multiResponse) Encode(e *jute.Encoder) {
+	for _, result := range this.Results {
+		code := errorCode(result.Err)
+		opcode := result.opcode
+		if result.Err != nil {
+			opcode = opError
+		}
+		(&multiHeader{Type: opcode, Done: false, Err: code}).Encode(e)
+		switch opcode {
+		case opCreate:
+			e.WriteString(result.Path)
+		case opSetData:
+			result.Stat.Encode(e)
+		case opError:
+			e.WriteInt(code)
+		}
+	}
+	(&multiHeader{Type: -1, Done: true, Err: -1}).Encode(e)
+}
+
+func (this *multiResponse) Decode(d *jute.Decoder) {
+	this.Results = nil
+	for d.Err() == nil {
+		header := &multiHeader{}
+		header.Decode(d)
+		if header.Done {
+			return
+		}
+		result := OpResult{opcode: header.Type}
+		switch header.Type {
+		case opCreate:
+			result.Path = d.ReadString()
+		case opSetData:
+			result.Stat = &Stat{}
+			result.Stat.Decode(d)
+		case opError:
+			result.Err = codeError(d.ReadInt())
+		}
+		this.Results = append(this.Results, result)
+	}
+}
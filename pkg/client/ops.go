@@ -0,0 +1,204 @@
+package client
+
+import (
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// Creates the node and returns its path, which has a suffix added with FlagSequence.  The
+// parent must exist.
+func (this *Client) Create(ctx context.Context, path string, data []byte, flags int32, acl []ACL) (string, error) {
+	if err := validatePath(path, flags&FlagSequence != 0); err != nil {
+		return "", err
+	}
+	resp := &pathRecord{}
+	err := this.call(ctx, opCreate, &createRequest{Path: path, Data: data, ACL: acl, Flags: flags}, resp, nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.Path, nil
+}
+
+// Deletes the node if its version matches.  The node must not have children.
+func (this *Client) Delete(ctx context.Context, path string, version int32) error {
+	if err := validatePath(path, false); err != nil {
+		return err
+	}
+	return this.call(ctx, opDelete, &pathVersionRecord{Path: path, Version: version}, nil, nil)
+}
+
+func (this *Client) Exists(ctx context.Context, path string) (bool, *Stat, error) {
+	return this.exists(ctx, path, nil)
+}
+
+// Also watches the node for being created, changed or deleted.
+func (this *Client) ExistsW(ctx context.Context, path string) (bool, *Stat, <-chan Event, error) {
+	watch := newWatchRequest(path, watchExist)
+	exists, stat, err := this.exists(ctx, path, watch)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	return exists, stat, watch.ch, nil
+}
+
+func (this *Client) exists(ctx context.Context, path string, watch *watchRequest) (bool, *Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return false, nil, err
+	}
+	resp := &statRecord{}
+	err := this.call(ctx, opExists, &pathWatchRecord{Path: path, Watch: watch != nil}, resp, watch)
+	switch err {
+	case nil:
+		return true, &resp.Stat, nil
+	case ErrNoNode:
+		return false, nil, nil
+	}
+	return false, nil, err
+}
+
+func (this *Client) Get(ctx context.Context, path string) ([]byte, *Stat, error) {
+	return this.get(ctx, path, nil)
+}
+
+// Also watches the data of the node for changing or the node for being deleted.
+func (this *Client) GetW(ctx context.Context, path string) ([]byte, *Stat, <-chan Event, error) {
+	watch := newWatchRequest(path, watchData)
+	data, stat, err := this.get(ctx, path, watch)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return data, stat, watch.ch, nil
+}
+
+func (this *Client) get(ctx context.Context, path string, watch *watchRequest) ([]byte, *Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return nil, nil, err
+	}
+	resp := &getDataResponse{}
+	if err := this.call(ctx, opGetData, &pathWatchRecord{Path: path, Watch: watch != nil}, resp, watch); err != nil {
+		return nil, nil, err
+	}
+	return resp.Data, &resp.Stat, nil
+}
+
+// Sets the data of the node if its version matches.
+func (this *Client) Set(ctx context.Context, path string, data []byte, version int32) (*Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return nil, err
+	}
+	resp := &statRecord{}
+	if err := this.call(ctx, opSetData, &setDataRequest{Path: path, Data: data, Version: version}, resp, nil); err != nil {
+		return nil, err
+	}
+	return &resp.Stat, nil
+}
+
+// Names of the children, in no particular order.
+func (this *Client) Children(ctx context.Context, path string) ([]string, *Stat, error) {
+	return this.children(ctx, path, nil)
+}
+
+// Also watches the node for children being added or removed, or the node being deleted.
+func (this *Client) ChildrenW(ctx context.Context, path string) ([]string, *Stat, <-chan Event, error) {
+	watch := newWatchRequest(path, watchChild)
+	children, stat, err := this.children(ctx, path, watch)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return children, stat, watch.ch, nil
+}
+
+func (this *Client) children(ctx context.Context, path string, watch *watchRequest) ([]string, *Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return nil, nil, err
+	}
+	resp := &getChildrenResponse{}
+	if err := this.call(ctx, opGetChildren2, &pathWatchRecord{Path: path, Watch: watch != nil}, resp, watch); err != nil {
+		return nil, nil, err
+	}
+	return resp.Children, &resp.Stat, nil
+}
+
+func (this *Client) GetACL(ctx context.Context, path string) ([]ACL, *Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return nil, nil, err
+	}
+	resp := &getAclResponse{}
+	if err := this.call(ctx, opGetAcl, &pathRecord{Path: path}, resp, nil); err != nil {
+		return nil, nil, err
+	}
+	return resp.ACL, &resp.Stat, nil
+}
+
+// Sets the ACL of the node if its ACL version (Stat.Aversion) matches.
+func (this *Client) SetACL(ctx context.Context, path string, acl []ACL, version int32) (*Stat, error) {
+	if err := validatePath(path, false); err != nil {
+		return nil, err
+	}
+	resp := &statRecord{}
+	if err := this.call(ctx, opSetAcl, &setAclRequest{Path: path, ACL: acl, Version: version}, resp, nil); err != nil {
+		return nil, err
+	}
+	return &resp.Stat, nil
+}
+
+// Waits for the server to catch up with the leader on the path.
+func (this *Client) Sync(ctx context.Context, path string) error {
+	if err := validatePath(path, false); err != nil {
+		return err
+	}
+	return this.call(ctx, opSync, &pathRecord{Path: path}, &pathRecord{}, nil)
+}
+
+// Adds credentials to the session, e.g. AddAuth(ctx, "digest", []byte("user:password")).
+// They are sent again on every new connection.
+func (this *Client) AddAuth(ctx context.Context, scheme string, auth []byte) error {
+	return this.call(ctx, opAuth, &authPacket{Scheme: scheme, Auth: auth}, nil, nil)
+}
+
+// Applies the operations atomically.  Returns the result of each and the error of the first
+// that failed, in which case none was applied.
+func (this *Client) Multi(ctx context.Context, ops ...Op) ([]OpResult, error) {
+	for _, op := range ops {
+		if err := op.validate(); err != nil {
+			return nil, err
+		}
+	}
+	resp := &multiResponse{}
+	err := this.call(ctx, opMulti, &multiRequest{Ops: ops}, resp, nil)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(ops) {
+		if err == nil {
+			err = ErrBadResponse
+		}
+		return nil, err
+	}
+	for _, result := range resp.Results {
+		if result.Err != nil {
+			return resp.Results, result.Err
+		}
+	}
+	return resp.Results, err
+}
+
+// Paths are absolute, without empty, relative or trailing components.  Sequential nodes may
+// end with a slash; the server appends the sequence.
+func validatePath(path string, sequence bool) error {
+	if sequence {
+		path += "0"
+	}
+	if path == "/" {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") || strings.ContainsRune(path, 0) {
+		return ErrBadPath
+	}
+	for _, name := range strings.Split(path[1:], "/") {
+		if name == "" || name == "." || name == ".." {
+			return ErrBadPath
+		}
+	}
+	return nil
+}
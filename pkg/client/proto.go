@@ -0,0 +1,473 @@
+package client
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"github.com/conductant/zk/pkg/jute"
+)
+
+const (
+	protocolVersion = 0
+	passwordLength  = 16
+
+	// Xids of packets that aren't replies to requests
+	xidWatchEvent = -1
+	xidPing       = -2
+	xidAuth       = -4
+	xidSetWatches = -8
+)
+
+const (
+	opNotification = 0
+	opCreate       = 1
+	opDelete       = 2
+	opExists       = 3
+	opGetData      = 4
+	opSetData      = 5
+	opGetAcl       = 6
+	opSetAcl       = 7
+	opGetChildren  = 8
+	opSync         = 9
+	opPing         = 11
+	opGetChildren2 = 12
+	opCheck        = 13
+	opMulti        = 14
+	opAuth         = 100
+	opSetWatches   = 101
+	opError        = -1
+	opCloseSession = -11
+)
+
+// Flags of Create
+const (
+	FlagEphemeral = 1
+	FlagSequence  = 2
+)
+
+// Permissions of an ACL
+const (
+	PermRead   = 1 << 0
+	PermWrite  = 1 << 1
+	PermCreate = 1 << 2
+	PermDelete = 1 << 3
+	PermAdmin  = 1 << 4
+	PermAll    = PermRead | PermWrite | PermCreate | PermDelete | PermAdmin
+)
+
+// Metadata of a znode.  Times are milliseconds since the epoch.
+type Stat struct {
+	Czxid          int64 `json:"czxid"`
+	Mzxid          int64 `json:"mzxid"`
+	Ctime          int64 `json:"ctime"`
+	Mtime          int64 `json:"mtime"`
+	Version        int32 `json:"version"`
+	Cversion       int32 `json:"cversion"`
+	Aversion       int32 `json:"aversion"`
+	EphemeralOwner int64 `json:"ephemeralOwner"`
+	DataLength     int32 `json:"dataLength"`
+	NumChildren    int32 `json:"numChildren"`
+	Pzxid          int64 `json:"pzxid"`
+}
+
+func (this *Stat) Encode(e *jute.Encoder) {
+	e.WriteLong(this.Czxid)
+	e.WriteLong(this.Mzxid)
+	e.WriteLong(this.Ctime)
+	e.WriteLong(this.Mtime)
+	e.WriteInt(this.Version)
+	e.WriteInt(this.Cversion)
+	e.WriteInt(this.Aversion)
+	e.WriteLong(this.EphemeralOwner)
+	e.WriteInt(this.DataLength)
+	e.WriteInt(this.NumChildren)
+	e.WriteLong(this.Pzxid)
+}
+
+func (this *Stat) Decode(d *jute.Decoder) {
+	this.Czxid = d.ReadLong()
+	this.Mzxid = d.ReadLong()
+	this.Ctime = d.ReadLong()
+	this.Mtime = d.ReadLong()
+	this.Version = d.ReadInt()
+	this.Cversion = d.ReadInt()
+	this.Aversion = d.ReadInt()
+	this.EphemeralOwner = d.ReadLong()
+	this.DataLength = d.ReadInt()
+	this.NumChildren = d.ReadInt()
+	this.Pzxid = d.ReadLong()
+}
+
+// Permissions granted to an identity, e.g. world:anyone, ip:10.0.0.0/8 or digest:user:hash.
+type ACL struct {
+	Perms  int32  `json:"perms"`
+	Scheme string `json:"scheme"`
+	Id     string `json:"id"`
+}
+
+// As scheme:id:perms with the permissions as letters of cdrwa, e.g. world:anyone:rw.
+func (this ACL) String() string {
+	perms := ""
+	for _, p := range []struct {
+		letter string
+		perm   int32
+	}{{"c", PermCreate}, {"d", PermDelete}, {"r", PermRead}, {"w", PermWrite}, {"a", PermAdmin}} {
+		if this.Perms&p.perm != 0 {
+			perms += p.letter
+		}
+	}
+	return this.Scheme + ":" + this.Id + ":" + perms
+}
+
+func (this *ACL) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Perms)
+	e.WriteString(this.Scheme)
+	e.WriteString(this.Id)
+}
+
+func (this *ACL) Decode(d *jute.Decoder) {
+	this.Perms = d.ReadInt()
+	this.Scheme = d.ReadString()
+	this.Id = d.ReadString()
+}
+
+// Grants the permissions to everyone.
+func WorldACL(perms int32) []ACL {
+	return []ACL{{Perms: perms, Scheme: "world", Id: "anyone"}}
+}
+
+// Grants the permissions to the user of the digest scheme.  Sessions authenticate as the user
+// with AddAuth("digest", "user:password").
+func DigestACL(perms int32, user, password string) []ACL {
+	hash := sha1.Sum([]byte(user + ":" + password))
+	return []ACL{{Perms: perms, Scheme: "digest", Id: user + ":" + base64.StdEncoding.EncodeToString(hash[:])}}
+}
+
+var (
+	OpenACL = WorldACL(PermAll)
+)
+
+func writeACLs(e *jute.Encoder, acl []ACL) {
+	e.WriteInt(int32(len(acl)))
+	for i := range acl {
+		acl[i].Encode(e)
+	}
+}
+
+func readACLs(d *jute.Decoder) []ACL {
+	n := d.ReadLength()
+	if n < 0 {
+		return nil
+	}
+	acl := []ACL{}
+	for i := 0; i < n && d.Err() == nil; i++ {
+		a := ACL{}
+		a.Decode(d)
+		acl = append(acl, a)
+	}
+	return acl
+}
+
+type connectRequest struct {
+	ProtocolVersion int32
+	LastZxidSeen    int64
+	Timeout         int32
+	SessionId       int64
+	Password        []byte
+	ReadOnly        bool
+}
+
+func (this *connectRequest) Encode(e *jute.Encoder) {
+	e.WriteInt(this.ProtocolVersion)
+	e.WriteLong(this.LastZxidSeen)
+	e.WriteInt(this.Timeout)
+	e.WriteLong(this.SessionId)
+	e.WriteBuffer(this.Password)
+	e.WriteBool(this.ReadOnly)
+}
+
+func (this *connectRequest) Decode(d *jute.Decoder) {
+	this.ProtocolVersion = d.ReadInt()
+	this.LastZxidSeen = d.ReadLong()
+	this.Timeout = d.ReadInt()
+	this.SessionId = d.ReadLong()
+	this.Password = d.ReadBuffer()
+}
+
+// A Timeout of 0 means the session expired.  Servers before 3.4 don't send ReadOnly.
+type connectResponse struct {
+	ProtocolVersion int32
+	Timeout         int32
+	SessionId       int64
+	Password        []byte
+}
+
+func (this *connectResponse) Encode(e *jute.Encoder) {
+	e.WriteInt(this.ProtocolVersion)
+	e.WriteInt(this.Timeout)
+	e.WriteLong(this.SessionId)
+	e.WriteBuffer(this.Password)
+}
+
+func (this *connectResponse) Decode(d *jute.Decoder) {
+	this.ProtocolVersion = d.ReadInt()
+	this.Timeout = d.ReadInt()
+	this.SessionId = d.ReadLong()
+	this.Password = d.ReadBuffer()
+}
+
+type requestHeader struct {
+	Xid    int32
+	OpCode int32
+}
+
+func (this *requestHeader) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Xid)
+	e.WriteInt(this.OpCode)
+}
+
+func (this *requestHeader) Decode(d *jute.Decoder) {
+	this.Xid = d.ReadInt()
+	this.OpCode = d.ReadInt()
+}
+
+type replyHeader struct {
+	Xid  int32
+	Zxid int64
+	Err  int32
+}
+
+func (this *replyHeader) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Xid)
+	e.WriteLong(this.Zxid)
+	e.WriteInt(this.Err)
+}
+
+func (this *replyHeader) Decode(d *jute.Decoder) {
+	this.Xid = d.ReadInt()
+	this.Zxid = d.ReadLong()
+	this.Err = d.ReadInt()
+}
+
+// Requests and responses made of a path, a path and watch flag, a path and version, or a stat
+type pathRecord struct {
+	Path string
+}
+
+func (this *pathRecord) Encode(e *jute.Encoder) { e.WriteString(this.Path) }
+func (this *pathRecord) Decode(d *jute.Decoder) { this.Path = d.ReadString() }
+
+type pathWatchRecord struct {
+	Path  string
+	Watch bool
+}
+
+func (this *pathWatchRecord) Encode(e *jute.Encoder) {
+	e.WriteString(this.Path)
+	e.WriteBool(this.Watch)
+}
+
+func (this *pathWatchRecord) Decode(d *jute.Decoder) {
+	this.Path = d.ReadString()
+	this.Watch = d.ReadBool()
+}
+
+type pathVersionRecord struct {
+	Path    string
+	Version int32
+}
+
+func (this *pathVersionRecord) Encode(e *jute.Encoder) {
+	e.WriteString(this.Path)
+	e.WriteInt(this.Version)
+}
+
+func (this *pathVersionRecord) Decode(d *jute.Decoder) {
+	this.Path = d.ReadString()
+	this.Version = d.ReadInt()
+}
+
+type statRecord struct {
+	Stat Stat
+}
+
+func (this *statRecord) Encode(e *jute.Encoder) { this.Stat.Encode(e) }
+func (this *statRecord) Decode(d *jute.Decoder) { this.Stat.Decode(d) }
+
+type createRequest struct {
+	Path  string
+	Data  []byte
+	ACL   []ACL
+	Flags int32
+}
+
+func (this *createRequest) Encode(e *jute.Encoder) {
+	e.WriteString(this.Path)
+	e.WriteBuffer(this.Data)
+	writeACLs(e, this.ACL)
+	e.WriteInt(this.Flags)
+}
+
+func (this *createRequest) Decode(d *jute.Decoder) {
+	this.Path = d.ReadString()
+	this.Data = d.ReadBuffer()
+	this.ACL = readACLs(d)
+	this.Flags = d.ReadInt()
+}
+
+type getDataResponse struct {
+	Data []byte
+	Stat Stat
+}
+
+func (this *getDataResponse) Encode(e *jute.Encoder) {
+	e.WriteBuffer(this.Data)
+	this.Stat.Encode(e)
+}
+
+func (this *getDataResponse) Decode(d *jute.Decoder) {
+	this.Data = d.ReadBuffer()
+	this.Stat.Decode(d)
+}
+
+type setDataRequest struct {
+	Path    string
+	Data    []byte
+	Version int32
+}
+
+func (this *setDataRequest) Encode(e *jute.Encoder) {
+	e.WriteString(this.Path)
+	e.WriteBuffer(this.Data)
+	e.WriteInt(this.Version)
+}
+
+func (this *setDataRequest) Decode(d *jute.Decoder) {
+	this.Path = d.ReadString()
+	this.Data = d.ReadBuffer()
+	this.Version = d.ReadInt()
+}
+
+type getChildrenResponse struct {
+	Children []string
+	Stat     Stat
+}
+
+func (this *getChildrenResponse) Encode(e *jute.Encoder) {
+	e.WriteStrings(this.Children)
+	this.Stat.Encode(e)
+}
+
+func (this *getChildrenResponse) Decode(d *jute.Decoder) {
+	this.Children = d.ReadStrings()
+	this.Stat.Decode(d)
+}
+
+type setAclRequest struct {
+	Path    string
+	ACL     []ACL
+	Version int32
+}
+
+func (this *setAclRequest) Encode(e *jute.Encoder) {
+	e.WriteString(this.Path)
+	writeACLs(e, this.ACL)
+	e.WriteInt(this.Version)
+}
+
+func (this *setAclRequest) Decode(d *jute.Decoder) {
+	this.Path = d.ReadString()
+	this.ACL = readACLs(d)
+	this.Version = d.ReadInt()
+}
+
+type getAclResponse struct {
+	ACL  []ACL
+	Stat Stat
+}
+
+func (this *getAclResponse) Encode(e *jute.Encoder) {
+	writeACLs(e, this.ACL)
+	this.Stat.Encode(e)
+}
+
+func (this *getAclResponse) Decode(d *jute.Decoder) {
+	this.ACL = readACLs(d)
+	this.Stat.Decode(d)
+}
+
+type authPacket struct {
+	Type   int32
+	Scheme string
+	Auth   []byte
+}
+
+func (this *authPacket) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Type)
+	e.WriteString(this.Scheme)
+	e.WriteBuffer(this.Auth)
+}
+
+func (this *authPacket) Decode(d *jute.Decoder) {
+	this.Type = d.ReadInt()
+	this.Scheme = d.ReadString()
+	this.Auth = d.ReadBuffer()
+}
+
+type setWatchesRequest struct {
+	RelativeZxid int64
+	DataWatches  []string
+	ExistWatches []string
+	ChildWatches []string
+}
+
+func (this *setWatchesRequest) Encode(e *jute.Encoder) {
+	e.WriteLong(this.RelativeZxid)
+	e.WriteStrings(this.DataWatches)
+	e.WriteStrings(this.ExistWatches)
+	e.WriteStrings(this.ChildWatches)
+}
+
+func (this *setWatchesRequest) Decode(d *jute.Decoder) {
+	this.RelativeZxid = d.ReadLong()
+	this.DataWatches = d.ReadStrings()
+	this.ExistWatches = d.ReadStrings()
+	this.ChildWatches = d.ReadStrings()
+}
+
+type watcherEvent struct {
+	Type  int32
+	State int32
+	Path  string
+}
+
+func (this *watcherEvent) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Type)
+	e.WriteInt(this.State)
+	e.WriteString(this.Path)
+}
+
+func (this *watcherEvent) Decode(d *jute.Decoder) {
+	this.Type = d.ReadInt()
+	this.State = d.ReadInt()
+	this.Path = d.ReadString()
+}
+
+// Precedes every operation of a multi request and every result of its response.  The last
+// header has Done set.
+type multiHeader struct {
+	Type int32
+	Done bool
+	Err  int32
+}
+
+func (this *multiHeader) Encode(e *jute.Encoder) {
+	e.WriteInt(this.Type)
+	e.WriteBool(this.Done)
+	e.WriteInt(this.Err)
+}
+
+func (this *multiHeader) Decode(d *jute.Decoder) {
+	this.Type = d.ReadInt()
+	this.Done = d.ReadBool()
+	this.Err = d.ReadInt()
+}
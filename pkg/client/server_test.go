@@ -0,0 +1,586 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/conductant/zk/pkg/jute"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In-memory ZooKeeper speaking the client protocol on any number of addresses, like the
+// members of an ensemble sharing one tree.
+type testServer struct {
+	lock      sync.Mutex
+	listeners map[string]net.Listener
+	conns     map[*testConn]bool
+	nodes     map[string]*testNode
+	sessions  map[int64][]byte // Passwords of live sessions
+	zxid      int64
+	nextId    int64
+	watches   map[watchKey]map[*testConn]bool
+	outbox    []testEvent // Watch events to send once the request is done
+	received  []int32     // Opcodes of the requests received
+}
+
+type testEvent struct {
+	conn  *testConn
+	event *watcherEvent
+}
+
+type testNode struct {
+	data []byte
+	acl  []ACL
+	stat Stat
+}
+
+type testConn struct {
+	net.Conn
+	server    *testServer
+	addr      string
+	sessionId int64
+	lock      sync.Mutex
+}
+
+func newTestServer() *testServer {
+	return &testServer{
+		listeners: map[string]net.Listener{},
+		conns:     map[*testConn]bool{},
+		nodes:     map[string]*testNode{"/": {acl: OpenACL}},
+		sessions:  map[int64][]byte{},
+		nextId:    0x100,
+		watches:   map[watchKey]map[*testConn]bool{},
+	}
+}
+
+// Listens on a new address
+func (this *testServer) listen() string {
+	return this.listenOn("127.0.0.1:0")
+}
+
+func (this *testServer) listenOn(addr string) string {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	addr = listener.Addr().String()
+	this.lock.Lock()
+	this.listeners[addr] = listener
+	this.lock.Unlock()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go this.serve(&testConn{Conn: conn, server: this, addr: addr})
+		}
+	}()
+	return addr
+}
+
+// Stops listening on the address and drops its connections
+func (this *testServer) stop(addr string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if listener, has := this.listeners[addr]; has {
+		listener.Close()
+		delete(this.listeners, addr)
+	}
+	for conn := range this.conns {
+		if conn.addr == addr {
+			conn.Close()
+			delete(this.conns, conn)
+		}
+	}
+}
+
+func (this *testServer) close() {
+	this.lock.Lock()
+	addrs := []string{}
+	for addr := range this.listeners {
+		addrs = append(addrs, addr)
+	}
+	this.lock.Unlock()
+	for _, addr := range addrs {
+		this.stop(addr)
+	}
+}
+
+// Drops every connection, keeping the sessions
+func (this *testServer) drop() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for conn := range this.conns {
+		conn.Close()
+		delete(this.conns, conn)
+	}
+}
+
+// Expires the session and drops its connections
+func (this *testServer) expire(sessionId int64) {
+	this.lock.Lock()
+	this.endSession(sessionId)
+	for conn := range this.conns {
+		if conn.sessionId == sessionId {
+			conn.Close()
+			delete(this.conns, conn)
+		}
+	}
+	outbox := this.takeOutbox()
+	this.lock.Unlock()
+	deliver(outbox)
+}
+
+// Number of requests received with the opcode
+func (this *testServer) count(opcode int32) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	count := 0
+	for _, received := range this.received {
+		if received == opcode {
+			count++
+		}
+	}
+	return count
+}
+
+func (this *testServer) last() int32 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.received[len(this.received)-1]
+}
+
+// Changes the data as another client would
+func (this *testServer) update(p string, data []byte) {
+	this.lock.Lock()
+	this.set(p, data, AnyVersion)
+	outbox := this.takeOutbox()
+	this.lock.Unlock()
+	deliver(outbox)
+}
+
+func (this *testServer) serve(conn *testConn) {
+	defer func() {
+		conn.Close()
+		this.lock.Lock()
+		delete(this.conns, conn)
+		for _, conns := range this.watches {
+			delete(conns, conn)
+		}
+		this.lock.Unlock()
+	}()
+
+	buff, err := readPacket(conn)
+	if err != nil {
+		return
+	}
+	req := &connectRequest{}
+	if jute.Unmarshal(buff, req) != nil {
+		return
+	}
+	this.lock.Lock()
+	resp := &connectResponse{Timeout: req.Timeout, SessionId: req.SessionId, Password: req.Password}
+	if req.SessionId == 0 {
+		this.nextId++
+		resp.SessionId = this.nextId
+		resp.Password = []byte(fmt.Sprintf("%016x", this.nextId))
+		this.sessions[resp.SessionId] = resp.Password
+	} else if password, has := this.sessions[req.SessionId]; !has || !bytes.Equal(password, req.Password) {
+		resp = &connectResponse{Password: make([]byte, passwordLength)}
+	}
+	conn.sessionId = resp.SessionId
+	this.conns[conn] = true
+	this.lock.Unlock()
+	if conn.write(resp) != nil || resp.Timeout == 0 {
+		return
+	}
+
+	for {
+		buff, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		decoder := jute.NewDecoder(bytes.NewReader(buff))
+		header := &requestHeader{}
+		header.Decode(decoder)
+		if !this.handle(conn, header, decoder) {
+			return
+		}
+	}
+}
+
+// Returns false to close the connection
+func (this *testServer) handle(conn *testConn, header *requestHeader, d *jute.Decoder) bool {
+	this.lock.Lock()
+	this.received = append(this.received, header.OpCode)
+	reply := &replyHeader{Xid: header.Xid, Zxid: this.zxid}
+	var resp jute.Record
+	var err error
+
+	switch header.OpCode {
+	case opPing:
+	case opAuth:
+		req := &authPacket{}
+		req.Decode(d)
+		if req.Scheme != "digest" {
+			err = ErrAuthFailed
+		}
+	case opSetWatches:
+		req := &setWatchesRequest{}
+		req.Decode(d)
+		this.restoreWatches(conn, req)
+	case opCloseSession:
+		this.endSession(conn.sessionId)
+	case opCreate:
+		req := &createRequest{}
+		req.Decode(d)
+		var created string
+		created, err = this.create(req.Path, req.Data, req.ACL, req.Flags, conn.sessionId)
+		resp = &pathRecord{Path: created}
+	case opDelete:
+		req := &pathVersionRecord{}
+		req.Decode(d)
+		err = this.delete(req.Path, req.Version)
+	case opExists:
+		req := &pathWatchRecord{}
+		req.Decode(d)
+		node := this.nodes[req.Path]
+		if req.Watch {
+			if node == nil {
+				this.watch(conn, req.Path, watchExist)
+			} else {
+				this.watch(conn, req.Path, watchData)
+			}
+		}
+		if node == nil {
+			err = ErrNoNode
+		} else {
+			resp = &statRecord{Stat: node.stat}
+		}
+	case opGetData:
+		req := &pathWatchRecord{}
+		req.Decode(d)
+		if node := this.nodes[req.Path]; node == nil {
+			err = ErrNoNode
+		} else {
+			if req.Watch {
+				this.watch(conn, req.Path, watchData)
+			}
+			resp = &getDataResponse{Data: node.data, Stat: node.stat}
+		}
+	case opSetData:
+		req := &setDataRequest{}
+		req.Decode(d)
+		var stat *Stat
+		stat, err = this.set(req.Path, req.Data, req.Version)
+		if err == nil {
+			resp = &statRecord{Stat: *stat}
+		}
+	case opGetChildren2:
+		req := &pathWatchRecord{}
+		req.Decode(d)
+		if node := this.nodes[req.Path]; node == nil {
+			err = ErrNoNode
+		} else {
+			if req.Watch {
+				this.watch(conn, req.Path, watchChild)
+			}
+			resp = &getChildrenResponse{Children: this.children(req.Path), Stat: node.stat}
+		}
+	case opGetAcl:
+		req := &pathRecord{}
+		req.Decode(d)
+		if node := this.nodes[req.Path]; node == nil {
+			err = ErrNoNode
+		} else {
+			resp = &getAclResponse{ACL: node.acl, Stat: node.stat}
+		}
+	case opSetAcl:
+		req := &setAclRequest{}
+		req.Decode(d)
+		if node := this.nodes[req.Path]; node == nil {
+			err = ErrNoNode
+		} else if req.Version != AnyVersion && req.Version != node.stat.Aversion {
+			err = ErrBadVersion
+		} else {
+			node.acl = req.ACL
+			node.stat.Aversion++
+			resp = &statRecord{Stat: node.stat}
+		}
+	case opSync:
+		req := &pathRecord{}
+		req.Decode(d)
+		resp = req
+	case opMulti:
+		req := &multiRequest{}
+		req.Decode(d)
+		resp, err = this.multi(req.Ops, conn.sessionId)
+	default:
+		err = ErrUnimplemented
+	}
+
+	reply.Zxid = this.zxid
+	reply.Err = errorCode(err)
+	outbox := this.takeOutbox()
+	this.lock.Unlock()
+
+	if resp == nil || (err != nil && header.OpCode != opMulti) {
+		conn.write(reply)
+	} else {
+		conn.write(reply, resp)
+	}
+	deliver(outbox)
+	return header.OpCode != opCloseSession && err != ErrAuthFailed
+}
+
+func (this *testConn) write(records ...jute.Record) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return writePacket(this, records...)
+}
+
+// Must be called with the lock held
+func (this *testServer) endSession(sessionId int64) {
+	delete(this.sessions, sessionId)
+	for p, node := range this.nodes {
+		if node.stat.EphemeralOwner == sessionId {
+			this.delete(p, AnyVersion)
+		}
+	}
+}
+
+func (this *testServer) children(p string) []string {
+	children := []string{}
+	for child := range this.nodes {
+		if child != "/" && path.Dir(child) == p {
+			children = append(children, path.Base(child))
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (this *testServer) create(p string, data []byte, acl []ACL, flags int32, sessionId int64) (string, error) {
+	parent := this.nodes[path.Dir(p)]
+	if parent == nil {
+		return "", ErrNoNode
+	}
+	if parent.stat.EphemeralOwner != 0 {
+		return "", ErrNoChildrenForEphemerals
+	}
+	if flags&FlagSequence != 0 {
+		p = fmt.Sprintf("%s%010d", p, parent.stat.Cversion)
+	}
+	if this.nodes[p] != nil {
+		return "", ErrNodeExists
+	}
+	this.zxid++
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	node := &testNode{data: data, acl: acl, stat: Stat{
+		Czxid: this.zxid, Mzxid: this.zxid, Pzxid: this.zxid, Ctime: now, Mtime: now, DataLength: int32(len(data)),
+	}}
+	if flags&FlagEphemeral != 0 {
+		node.stat.EphemeralOwner = sessionId
+	}
+	this.nodes[p] = node
+	parent.stat.Cversion++
+	parent.stat.NumChildren++
+	parent.stat.Pzxid = this.zxid
+	this.fire(p, EventNodeCreated, watchData, watchExist)
+	this.fire(path.Dir(p), EventNodeChildrenChanged, watchChild)
+	return p, nil
+}
+
+func (this *testServer) delete(p string, version int32) error {
+	node := this.nodes[p]
+	if node == nil {
+		return ErrNoNode
+	}
+	if version != AnyVersion && version != node.stat.Version {
+		return ErrBadVersion
+	}
+	if len(this.children(p)) > 0 {
+		return ErrNotEmpty
+	}
+	this.zxid++
+	delete(this.nodes, p)
+	parent := this.nodes[path.Dir(p)]
+	parent.stat.Cversion++
+	parent.stat.NumChildren--
+	parent.stat.Pzxid = this.zxid
+	this.fire(p, EventNodeDeleted, watchData, watchExist, watchChild)
+	this.fire(path.Dir(p), EventNodeChildrenChanged, watchChild)
+	return nil
+}
+
+func (this *testServer) set(p string, data []byte, version int32) (*Stat, error) {
+	node := this.nodes[p]
+	if node == nil {
+		return nil, ErrNoNode
+	}
+	if version != AnyVersion && version != node.stat.Version {
+		return nil, ErrBadVersion
+	}
+	this.zxid++
+	node.data = data
+	node.stat.Version++
+	node.stat.Mzxid = this.zxid
+	node.stat.DataLength = int32(len(data))
+	this.fire(p, EventNodeDataChanged, watchData, watchExist)
+	return &node.stat, nil
+}
+
+// Applies all operations or none.  Like ZooKeeper, the failed operation has its error,
+// those before it succeed and those after it have ErrRuntimeInconsistency.  The reply has the
+// error of the failed operation.
+func (this *testServer) multi(ops []Op, sessionId int64) (*multiResponse, error) {
+	nodes := map[string]*testNode{}
+	for p, node := range this.nodes {
+		copied := *node
+		nodes[p] = &copied
+	}
+	watches := map[watchKey]map[*testConn]bool{}
+	for key, conns := range this.watches {
+		watches[key] = map[*testConn]bool{}
+		for conn := range conns {
+			watches[key][conn] = true
+		}
+	}
+	zxid, outbox := this.zxid, len(this.outbox)
+
+	resp := &multiResponse{}
+	var failed error
+	for _, op := range ops {
+		result := OpResult{}
+		result.opcode, _ = op.request()
+		if failed != nil {
+			result.Err = ErrRuntimeInconsistency
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+		switch op := op.(type) {
+		case *CreateOp:
+			result.Path, result.Err = this.create(op.Path, op.Data, op.ACL, op.Flags, sessionId)
+		case *DeleteOp:
+			result.Err = this.delete(op.Path, op.Version)
+		case *SetOp:
+			result.Stat, result.Err = this.set(op.Path, op.Data, op.Version)
+		case *CheckOp:
+			if node := this.nodes[op.Path]; node == nil {
+				result.Err = ErrNoNode
+			} else if op.Version != AnyVersion && op.Version != node.stat.Version {
+				result.Err = ErrBadVersion
+			}
+		}
+		if result.Err != nil {
+			failed = result.Err
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	if failed == nil {
+		return resp, nil
+	}
+
+	this.nodes, this.watches, this.zxid, this.outbox = nodes, watches, zxid, this.outbox[:outbox]
+	for i := range resp.Results {
+		resp.Results[i] = OpResult{Err: resp.Results[i].Err, opcode: opError}
+	}
+	return resp, failed
+}
+
+func (this *testServer) watch(conn *testConn, p string, kind watchType) {
+	key := watchKey{path: p, kind: kind}
+	if this.watches[key] == nil {
+		this.watches[key] = map[*testConn]bool{}
+	}
+	this.watches[key][conn] = true
+}
+
+// Must be called with the lock held
+func (this *testServer) fire(p string, event EventType, kinds ...watchType) {
+	notified := map[*testConn]bool{}
+	for _, kind := range kinds {
+		key := watchKey{path: p, kind: kind}
+		for conn := range this.watches[key] {
+			if !notified[conn] {
+				notified[conn] = true
+				this.send(conn, event, p)
+			}
+		}
+		delete(this.watches, key)
+	}
+}
+
+func (this *testServer) send(conn *testConn, event EventType, p string) {
+	this.outbox = append(this.outbox, testEvent{conn: conn,
+		event: &watcherEvent{Type: int32(event), State: int32(StateConnected), Path: p}})
+}
+
+func (this *testServer) takeOutbox() []testEvent {
+	outbox := this.outbox
+	this.outbox = nil
+	return outbox
+}
+
+func deliver(outbox []testEvent) {
+	for _, e := range outbox {
+		e.conn.write(&replyHeader{Xid: xidWatchEvent, Zxid: -1}, e.event)
+	}
+}
+
+// Sets the watches of a reconnected client, firing those whose nodes changed meanwhile.
+func (this *testServer) restoreWatches(conn *testConn, req *setWatchesRequest) {
+	for _, p := range req.DataWatches {
+		if node := this.nodes[p]; node == nil {
+			this.send(conn, EventNodeDeleted, p)
+		} else if node.stat.Mzxid > req.RelativeZxid {
+			this.send(conn, EventNodeDataChanged, p)
+		} else {
+			this.watch(conn, p, watchData)
+		}
+	}
+	for _, p := range req.ExistWatches {
+		if this.nodes[p] != nil {
+			this.send(conn, EventNodeCreated, p)
+		} else {
+			this.watch(conn, p, watchExist)
+		}
+	}
+	for _, p := range req.ChildWatches {
+		if node := this.nodes[p]; node == nil {
+			this.send(conn, EventNodeDeleted, p)
+		} else if node.stat.Pzxid > req.RelativeZxid {
+			this.send(conn, EventNodeChildrenChanged, p)
+		} else {
+			this.watch(conn, p, watchChild)
+		}
+	}
+}
+
+// The address the session is connected to
+func (this *testServer) connectedTo(sessionId int64) string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for conn := range this.conns {
+		if conn.sessionId == sessionId {
+			return conn.addr
+		}
+	}
+	return ""
+}
+
+func (this *testServer) addrs() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	addrs := []string{}
+	for addr := range this.listeners {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
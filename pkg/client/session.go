@@ -0,0 +1,353 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/jute"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Connects to the servers in turn until the session expires or the client is closed.
+func (this *Client) loop() {
+	next := rand.Intn(len(this.Servers))
+	failures := 0
+	for {
+		wait := time.Duration(0)
+		if failures > 0 && failures%len(this.Servers) == 0 {
+			wait = this.RetryInterval
+		}
+		select {
+		case <-this.closing:
+			this.stop(ErrClosed)
+			return
+		case <-time.After(wait):
+		}
+
+		server := this.Servers[next%len(this.Servers)]
+		next++
+		conn, err := this.connect(server)
+		if err == ErrSessionExpired {
+			log.Warn("Session expired.")
+			this.stop(ErrSessionExpired)
+			return
+		}
+		if err != nil {
+			log.Warn("Cannot connect to ", server, ": ", err)
+			this.lock.Lock()
+			this.lastErr = err
+			this.lock.Unlock()
+			failures++
+			continue
+		}
+
+		failures = 0
+		err = this.serve(conn)
+		if err == ErrClosed {
+			this.stop(ErrClosed)
+			return
+		}
+		log.Warn("Lost connection to ", server, ": ", err)
+	}
+}
+
+// Dials the server and starts or resumes the session.
+func (this *Client) connect(server string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", server, this.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(this.DialTimeout))
+
+	this.lock.Lock()
+	req := &connectRequest{
+		ProtocolVersion: protocolVersion,
+		LastZxidSeen:    this.lastZxid,
+		Timeout:         int32(this.SessionTimeout / time.Millisecond),
+		SessionId:       this.sessionId,
+		Password:        this.password,
+	}
+	this.lock.Unlock()
+
+	resp := &connectResponse{}
+	if err := writePacket(conn, req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if buff, err := readPacket(conn); err != nil {
+		conn.Close()
+		return nil, err
+	} else if err := jute.Unmarshal(buff, resp); err != nil {
+		conn.Close()
+		return nil, ErrBadResponse
+	}
+	if resp.Timeout <= 0 {
+		conn.Close()
+		return nil, ErrSessionExpired
+	}
+	conn.SetDeadline(time.Time{})
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.sessionId = resp.SessionId
+	this.password = resp.Password
+	this.timeout = time.Duration(resp.Timeout) * time.Millisecond
+	log.Infof("Connected to %s, session=0x%x, timeout=%v", server, this.sessionId, this.timeout)
+	return conn, nil
+}
+
+// Sends requests and pings on the connection until it breaks or the client is closed.  Replies
+// are read by another goroutine.  Returns ErrClosed if the client was closed.
+func (this *Client) serve(conn net.Conn) error {
+	this.lock.Lock()
+	timeout := this.timeout
+	auths := this.auths
+	this.authQueue = make([]*request, len(auths))
+	watches := this.watches()
+	this.lock.Unlock()
+
+	write := func(records ...jute.Record) error {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		return writePacket(conn, records...)
+	}
+
+	// Restore the credentials and the watches before anything else
+	var err error
+	for _, auth := range auths {
+		if err == nil {
+			err = write(&requestHeader{Xid: xidAuth, OpCode: opAuth}, auth)
+		}
+	}
+	if watches != nil && err == nil {
+		err = write(&requestHeader{Xid: xidSetWatches, OpCode: opSetWatches}, watches)
+	}
+
+	var readErr error
+	readDone := make(chan interface{})
+	go func() {
+		readErr = this.read(conn, timeout*2/3)
+		close(readDone)
+	}()
+
+	if err == nil {
+		this.lock.Lock()
+		this.setState(StateConnected, nil)
+		this.lock.Unlock()
+	}
+
+	ping := time.NewTicker(timeout / 3)
+	defer ping.Stop()
+	for err == nil {
+		select {
+		case r := <-this.queue:
+			err = this.send(r, write)
+		case <-ping.C:
+			err = write(&requestHeader{Xid: xidPing, OpCode: opPing})
+		case <-readDone:
+			err = readErr
+		case <-this.closing:
+			this.closeSession(write, readDone)
+			err = ErrClosed
+		}
+	}
+	conn.Close()
+	<-readDone
+
+	// Requests without replies are lost
+	failed := ErrConnectionLoss
+	if err == ErrClosed {
+		failed = ErrClosed
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for xid, r := range this.pending {
+		r.done <- failed
+		delete(this.pending, xid)
+	}
+	for _, r := range this.authQueue {
+		if r != nil {
+			r.done <- failed
+		}
+	}
+	this.authQueue = nil
+	if err != ErrClosed {
+		this.setState(StateDisconnected, err)
+	}
+	return err
+}
+
+func (this *Client) send(r *request, write func(...jute.Record) error) error {
+	header := &requestHeader{OpCode: r.opcode}
+	this.lock.Lock()
+	if r.opcode == opAuth {
+		header.Xid = xidAuth
+		this.authQueue = append(this.authQueue, r)
+	} else {
+		if this.xid == math.MaxInt32 {
+			this.xid = 0
+		}
+		this.xid++
+		header.Xid = this.xid
+		this.pending[header.Xid] = r
+	}
+	this.lock.Unlock()
+
+	if r.req == nil {
+		return write(header)
+	}
+	return write(header, r.req)
+}
+
+// Asks the server to end the session and waits a while for the reply.
+func (this *Client) closeSession(write func(...jute.Record) error, readDone chan interface{}) {
+	r := &request{opcode: opCloseSession, done: make(chan error, 1)}
+	if err := this.send(r, write); err != nil {
+		return
+	}
+	select {
+	case <-r.done:
+	case <-readDone:
+	case <-time.After(this.DialTimeout):
+	}
+}
+
+// Reads replies until the connection breaks.  Nothing arriving within timeout, though the
+// server answers pings, counts as broken.
+func (this *Client) read(conn net.Conn, timeout time.Duration) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		buff, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		if err := this.dispatch(buff); err != nil {
+			return err
+		}
+	}
+}
+
+func (this *Client) dispatch(buff []byte) error {
+	decoder := jute.NewDecoder(bytes.NewReader(buff))
+	header := &replyHeader{}
+	header.Decode(decoder)
+	if decoder.Err() != nil {
+		return ErrBadResponse
+	}
+	err := codeError(header.Err)
+
+	this.lock.Lock()
+	if header.Zxid > this.lastZxid {
+		this.lastZxid = header.Zxid
+	}
+	this.lock.Unlock()
+
+	switch header.Xid {
+	case xidPing, xidSetWatches:
+		return nil
+
+	case xidWatchEvent:
+		event := &watcherEvent{}
+		event.Decode(decoder)
+		if decoder.Err() != nil {
+			return ErrBadResponse
+		}
+		this.trigger(event)
+		return nil
+
+	case xidAuth:
+		this.lock.Lock()
+		var r *request
+		if len(this.authQueue) > 0 {
+			r = this.authQueue[0]
+			this.authQueue = this.authQueue[1:]
+		}
+		if err == nil && r != nil {
+			this.auths = append(this.auths, r.req.(*authPacket))
+		}
+		if err != nil {
+			this.setState(StateAuthFailed, err)
+		}
+		this.lock.Unlock()
+		if r != nil {
+			r.done <- err
+		}
+		return nil
+	}
+
+	this.lock.Lock()
+	r := this.pending[header.Xid]
+	delete(this.pending, header.Xid)
+	this.lock.Unlock()
+	if r == nil {
+		log.Warn("Reply to unknown request xid=", header.Xid)
+		return nil
+	}
+
+	// Multi replies carry the result of every operation even when one failed
+	if r.resp != nil && (err == nil || r.opcode == opMulti) {
+		r.resp.Decode(decoder)
+		if decoder.Err() != nil && err == nil {
+			err = ErrBadResponse
+		}
+	}
+	if r.watch != nil {
+		this.register(r.watch, err)
+	}
+	r.done <- err
+	return nil
+}
+
+// Ends the client.  Waiting requests and watches fail with the error.
+func (this *Client) stop(err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.err != nil {
+		return
+	}
+	this.err = err
+
+	state := StateClosed
+	if err == ErrSessionExpired {
+		state = StateExpired
+	}
+	for xid, r := range this.pending {
+		r.done <- err
+		delete(this.pending, xid)
+	}
+	this.unwatchAll(state, err)
+	this.setState(state, err)
+	close(this.events)
+	close(this.done)
+}
+
+func writePacket(conn net.Conn, records ...jute.Record) error {
+	encoder := jute.NewEncoder()
+	encoder.WriteInt(0)
+	for _, r := range records {
+		r.Encode(encoder)
+	}
+	buff := encoder.Bytes()
+	binary.BigEndian.PutUint32(buff, uint32(len(buff)-4))
+	_, err := conn.Write(buff)
+	return err
+}
+
+func readPacket(conn net.Conn) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	n := int32(binary.BigEndian.Uint32(length[:]))
+	if n < 0 || n > jute.DefaultMaxLength {
+		return nil, ErrBadResponse
+	}
+	buff := make([]byte, n)
+	if _, err := io.ReadFull(conn, buff); err != nil {
+		return nil, err
+	}
+	return buff, nil
+}
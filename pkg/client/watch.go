@@ -0,0 +1,100 @@
+package client
+
+type watchType int
+
+const (
+	watchData  watchType = iota // Set by Get and by Exists on a node that exists
+	watchExist                  // Set by Exists on a node that doesn't exist
+	watchChild                  // Set by Children
+)
+
+type watchKey struct {
+	path string
+	kind watchType
+}
+
+// A watch requested with an operation.  It is set if the operation succeeds.
+type watchRequest struct {
+	path string
+	kind watchType
+	ch   chan Event
+}
+
+func newWatchRequest(path string, kind watchType) *watchRequest {
+	return &watchRequest{path: path, kind: kind, ch: make(chan Event, 1)}
+}
+
+// Watches triggered by each event type
+var triggers = map[EventType][]watchType{
+	EventNodeCreated:         {watchData, watchExist},
+	EventNodeDataChanged:     {watchData, watchExist},
+	EventNodeDeleted:         {watchData, watchExist, watchChild},
+	EventNodeChildrenChanged: {watchChild},
+}
+
+// Sets the watch after its operation returned err.  Must be called before the next reply is
+// read, so no event of the watch is missed.
+func (this *Client) register(w *watchRequest, err error) {
+	kind := w.kind
+	switch {
+	case err == nil && kind == watchExist:
+		kind = watchData
+	case err == ErrNoNode && kind == watchExist:
+	case err != nil:
+		return
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	key := watchKey{path: w.path, kind: kind}
+	this.watchers[key] = append(this.watchers[key], w.ch)
+}
+
+// Watches are one-shot: each channel gets one event and is closed.
+func (this *Client) trigger(event *watcherEvent) {
+	e := Event{Type: EventType(event.Type), State: SessionState(event.State), Path: event.Path}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, kind := range triggers[e.Type] {
+		key := watchKey{path: e.Path, kind: kind}
+		for _, ch := range this.watchers[key] {
+			ch <- e
+			close(ch)
+		}
+		delete(this.watchers, key)
+	}
+}
+
+// Must be called with the lock held
+func (this *Client) unwatchAll(state SessionState, err error) {
+	for key, chs := range this.watchers {
+		for _, ch := range chs {
+			ch <- Event{Type: EventNotWatching, State: state, Path: key.path, Err: err}
+			close(ch)
+		}
+		delete(this.watchers, key)
+	}
+}
+
+// The watches to restore on a new connection, nil if none.  Must be called with the lock held.
+func (this *Client) watches() *setWatchesRequest {
+	if len(this.watchers) == 0 {
+		return nil
+	}
+	req := &setWatchesRequest{
+		RelativeZxid: this.lastZxid,
+		DataWatches:  []string{},
+		ExistWatches: []string{},
+		ChildWatches: []string{},
+	}
+	for key := range this.watchers {
+		switch key.kind {
+		case watchData:
+			req.DataWatches = append(req.DataWatches, key.path)
+		case watchExist:
+			req.ExistWatches = append(req.ExistWatches, key.path)
+		case watchChild:
+			req.ChildWatches = append(req.ChildWatches, key.path)
+		}
+	}
+	return req
+}
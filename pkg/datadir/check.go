@@ -0,0 +1,153 @@
+package datadir
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Result of checking every record of a log.  Err is the first bad record, if any.  It is torn if
+// nothing but zeros follows it: the server stopped while writing it, so it was never committed.
+// Anything else is corruption.
+type LogCheck struct {
+	File
+	Txns     int
+	LastZxid Zxid
+	// Offset after the last good record
+	End  int64
+	Err  *FileError
+	Torn bool
+}
+
+// Reads all the records of the log, verifying their checksums.  A log too short for its header is
+// torn at offset 0.  Only errors opening the file are returned.
+func CheckLog(file File) (*LogCheck, error) {
+	check := &LogCheck{File: file}
+	reader, err := OpenLog(file)
+	if fileErr, is := err.(*FileError); is {
+		check.Err = fileErr
+		content, err := contentEnd(file.Path, 0)
+		if err != nil {
+			return nil, err
+		}
+		check.Torn = content < LogHeaderSize
+		return check, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for {
+		txn, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			check.Err = err.(*FileError)
+			break
+		}
+		check.Txns++
+		check.LastZxid = txn.Zxid
+	}
+	check.End = reader.Offset()
+	if check.Err == nil || check.Err.Err == ErrBadTxn {
+		return check, nil // A record that matches its checksum wasn't torn
+	}
+	recordEnd, err := recordEnd(file.Path, check.End)
+	if err != nil {
+		return nil, err
+	}
+	content, err := contentEnd(file.Path, check.End)
+	if err != nil {
+		return nil, err
+	}
+	check.Torn = recordEnd >= content
+	return check, nil
+}
+
+// Where the record at the offset claims to end.  Past the end of the file if the record is too
+// short to tell.
+func recordEnd(path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	head := make([]byte, 12)
+	if _, err := f.ReadAt(head, offset); err == io.EOF {
+		return offset + int64(len(head)), nil
+	} else if err != nil {
+		return 0, err
+	}
+	return offset + int64(len(head)) + int64(binary.BigEndian.Uint32(head[8:])) + 1, nil
+}
+
+// Offset after the last byte that isn't zero, at or after the offset.
+func contentEnd(path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, 0); err != nil {
+		return 0, err
+	}
+	end := offset
+	reader := bufio.NewReader(f)
+	for at := offset; ; at++ {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return end, nil
+		} else if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			end = at + 1
+		}
+	}
+}
+
+// Moves the bytes of the log after the good records, up to the zeros it was padded with, into a
+// file named after the log and the offset in the directory, then truncates the log.  A log
+// without a good header is moved as a whole.  Returns the path of the quarantined bytes.
+func Quarantine(check *LogCheck, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(check.Path), check.End))
+	if check.End == 0 {
+		return path, os.Rename(check.Path, path)
+	}
+
+	content, err := contentEnd(check.Path, check.End)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(check.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Seek(check.End, 0); err != nil {
+		return "", err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.CopyN(out, f, content-check.End); err != nil {
+		out.Close()
+		return "", err
+	}
+	// Keep the bytes before dropping them from the log.
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Truncate(check.Path, check.End)
+}
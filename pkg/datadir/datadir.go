@@ -0,0 +1,161 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Files in a ZooKeeper data directory.  Snapshots and transaction logs are in VersionDir and
+// named by the first zxid they hold, in hex.  The epochs are in VersionDir too, next to the
+// snapshots.  myid is in the data directory.
+const (
+	VersionDir        = "version-2"
+	SnapshotPrefix    = "snapshot."
+	LogPrefix         = "log."
+	AcceptedEpochFile = "acceptedEpoch"
+	CurrentEpochFile  = "currentEpoch"
+	MyIdFile          = "myid"
+)
+
+var (
+	ErrBadMagic   = errors.New("err-bad-magic")
+	ErrBadVersion = errors.New("err-bad-version")
+	ErrBadCRC     = errors.New("err-bad-crc")
+	ErrTruncated  = errors.New("err-truncated")
+	ErrBadTxn     = errors.New("err-bad-txn")
+	ErrBadTxnType = errors.New("err-bad-txn-type")
+	ErrBadNumber  = errors.New("err-bad-number")
+)
+
+// A problem reading a file, at the byte offset where the bad record starts.
+type FileError struct {
+	Path   string
+	Offset int64
+	Err    error
+}
+
+func (this *FileError) Error() string {
+	return fmt.Sprintf("%v:%s at offset %d", this.Err, this.Path, this.Offset)
+}
+
+// Kind of the error.  Errors of other packages are returned as is.
+func Cause(err error) error {
+	if err, is := err.(*FileError); is {
+		return err.Err
+	}
+	return err
+}
+
+// ZooKeeper transaction id.  The high 32 bits are the epoch of the leader that proposed it, the
+// low 32 bits count the transactions of the epoch.
+type Zxid int64
+
+func (this Zxid) Epoch() int64 {
+	return int64(this) >> 32
+}
+
+func (this Zxid) Counter() int64 {
+	return int64(this) & 0xffffffff
+}
+
+func (this Zxid) String() string {
+	return fmt.Sprintf("0x%x", int64(this))
+}
+
+func (this Zxid) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+// A snapshot or log file.
+type File struct {
+	Path string `json:"path"`
+	Zxid Zxid   `json:"zxid"`
+}
+
+// The files of a data directory.
+type DataDir struct {
+	Dir       string `json:"dir"`
+	LogDir    string `json:"logDir"`
+	Snapshots []File `json:"snapshots"`
+	Logs      []File `json:"logs"`
+}
+
+// Lists the snapshots and logs in dir, and in logDir if the logs are kept apart (ZooKeeper's
+// dataLogDir).  Files are ordered by zxid.
+func Open(dir, logDir string) (*DataDir, error) {
+	if logDir == "" {
+		logDir = dir
+	}
+	for _, d := range []string{dir, logDir} {
+		if _, err := os.Stat(d); err != nil {
+			return nil, err
+		}
+	}
+	this := &DataDir{Dir: dir, LogDir: logDir}
+	var err error
+	if this.Snapshots, err = list(dir, SnapshotPrefix); err != nil {
+		return nil, err
+	}
+	if this.Logs, err = list(logDir, LogPrefix); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+func list(dir, prefix string) ([]File, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(dir, VersionDir))
+	if os.IsNotExist(err) {
+		return []File{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		zxid, err := strconv.ParseInt(strings.TrimPrefix(entry.Name(), prefix), 16, 64)
+		if err != nil {
+			continue // e.g. compressed snapshots or files set aside
+		}
+		files = append(files, File{Path: filepath.Join(dir, VersionDir, entry.Name()), Zxid: Zxid(zxid)})
+	}
+	sort.Sort(byZxid(files))
+	return files, nil
+}
+
+type byZxid []File
+
+func (this byZxid) Len() int           { return len(this) }
+func (this byZxid) Less(i, j int) bool { return this[i].Zxid < this[j].Zxid }
+func (this byZxid) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+
+// Reads an epoch file.  Returns -1 if there is none, as before the server first joined a quorum.
+func (this *DataDir) Epoch(name string) (int64, error) {
+	return readNumber(filepath.Join(this.Dir, VersionDir, name))
+}
+
+// Returns -1 if there is no myid file.
+func (this *DataDir) MyId() (int64, error) {
+	return readNumber(filepath.Join(this.Dir, MyIdFile))
+}
+
+func readNumber(path string) (int64, error) {
+	buff, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(buff)), 10, 64)
+	if err != nil {
+		return -1, &FileError{Path: path, Err: ErrBadNumber}
+	}
+	return n, nil
+}
@@ -0,0 +1,353 @@
+package datadir_test
+
+import (
+	"fmt"
+	"github.com/conductant/zk/pkg/client"
+	. "github.com/conductant/zk/pkg/datadir"
+	"github.com/conductant/zk/pkg/datadir/datadirtest"
+	. "gopkg.in/check.v1"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDataDir(t *testing.T) { TestingT(t) }
+
+type TestSuiteDataDir struct {
+}
+
+var _ = Suite(&TestSuiteDataDir{})
+
+func (suite *TestSuiteDataDir) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteDataDir) TearDownSuite(c *C) {
+}
+
+var epoch = time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return epoch.Add(time.Duration(minutes) * time.Minute)
+}
+
+var txns = []*Txn{
+	{Session: 0x100, Zxid: 0x100000003, Time: at(1), Type: TxnCreateSession, Timeout: 30000},
+	{Session: 0x100, Cxid: 1, Zxid: 0x100000004, Time: at(2), Type: TxnCreate, Path: "/app", Data: []byte("v1"), ACL: client.OpenACL},
+	{Session: 0x100, Cxid: 2, Zxid: 0x100000005, Time: at(3), Type: TxnMulti, Ops: []*Txn{
+		{Type: TxnCreate, Path: "/app/lock", Data: []byte{}, ACL: client.OpenACL, Ephemeral: true},
+		{Type: TxnSetData, Path: "/app", Data: []byte("v2"), Version: 1},
+	}},
+	{Session: 0x99, Zxid: 0x100000006, Time: at(4), Type: TxnCloseSession},
+	{Session: 0x100, Cxid: 3, Zxid: 0x200000001, Time: at(5), Type: TxnDelete, Path: "/other"},
+	{Session: 0x100, Cxid: 4, Zxid: 0x200000002, Time: at(6), Type: TxnError, Err: -101},
+}
+
+func (suite *TestSuiteDataDir) TestZxid(c *C) {
+	zxid := Zxid(0x300000002)
+	c.Assert(zxid.Epoch(), Equals, int64(3))
+	c.Assert(zxid.Counter(), Equals, int64(2))
+	c.Assert(zxid.String(), Equals, "0x300000002")
+}
+
+func (suite *TestSuiteDataDir) TestOpen(c *C) {
+	f := datadirtest.NewFixture(c)
+	f.Write(c, VersionDir+"/snapshot.200000000", nil)
+	f.Write(c, VersionDir+"/snapshot.10000000a", nil)
+	f.Write(c, VersionDir+"/snapshot.300000000.gz", nil)
+	f.Write(c, VersionDir+"/log.100000001", nil)
+	f.Write(c, VersionDir+"/other", nil)
+
+	dir, err := Open(f.Dir, "")
+	c.Assert(err, IsNil)
+	c.Assert(dir.Snapshots, DeepEquals, []File{
+		{Path: filepath.Join(f.Dir, VersionDir, "snapshot.10000000a"), Zxid: 0x10000000a},
+		{Path: filepath.Join(f.Dir, VersionDir, "snapshot.200000000"), Zxid: 0x200000000},
+	})
+	c.Assert(dir.Logs, DeepEquals, []File{{Path: filepath.Join(f.Dir, VersionDir, "log.100000001"), Zxid: 0x100000001}})
+
+	epoch, err := dir.Epoch(CurrentEpochFile)
+	c.Assert(err, IsNil)
+	c.Assert(epoch, Equals, int64(-1))
+	f.Write(c, VersionDir+"/"+CurrentEpochFile, []byte("3"))
+	epoch, err = dir.Epoch(CurrentEpochFile)
+	c.Assert(err, IsNil)
+	c.Assert(epoch, Equals, int64(3))
+	f.Write(c, MyIdFile, []byte("x\n"))
+	_, err = dir.MyId()
+	c.Assert(Cause(err), Equals, ErrBadNumber)
+
+	dir, err = Open(c.MkDir(), "")
+	c.Assert(err, IsNil)
+	c.Assert(dir.Snapshots, HasLen, 0)
+	c.Assert(dir.Logs, HasLen, 0)
+}
+
+func (suite *TestSuiteDataDir) TestSnapshot(c *C) {
+	f := datadirtest.NewFixture(c)
+	nodes := []*Node{
+		{Path: "/", Data: []byte{}, ACL: 1},
+		{Path: "/app", Data: []byte("v1"), ACL: 1, Stat: Stat{Czxid: 0x100000001, Mzxid: 0x100000002, Version: 1}},
+		{Path: "/app/lock", Data: []byte{}, ACL: 1, Stat: Stat{Czxid: 0x100000002, EphemeralOwner: 0x99}},
+	}
+	path := f.Snapshot(c, 0x100000002, map[int64]int32{0x99: 30000}, nodes)
+
+	read := []*Node{}
+	snapshot, err := ReadSnapshot(File{Path: path, Zxid: 0x100000002}, func(node *Node) error {
+		read = append(read, node)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Nodes, Equals, 3)
+	c.Assert(snapshot.Sessions, DeepEquals, map[int64]int32{0x99: 30000})
+	c.Assert(snapshot.ACLs, DeepEquals, map[int64][]client.ACL{1: client.OpenACL})
+	c.Assert(read, DeepEquals, nodes)
+
+	buff, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	corrupt := append([]byte{}, buff...)
+	corrupt[60] ^= 0xff
+	f.Write(c, "corrupt", corrupt)
+	_, err = ReadSnapshot(File{Path: filepath.Join(f.Dir, "corrupt")}, nil)
+	c.Assert(Cause(err), Equals, ErrBadCRC)
+
+	f.Write(c, "truncated", buff[:len(buff)-20])
+	_, err = ReadSnapshot(File{Path: filepath.Join(f.Dir, "truncated")}, nil)
+	c.Assert(Cause(err), Equals, ErrTruncated)
+
+	f.Write(c, "log", datadirtest.LogHeader())
+	_, err = ReadSnapshot(File{Path: filepath.Join(f.Dir, "log")}, nil)
+	c.Assert(err, ErrorMatches, "err-bad-magic:.*/log at offset 0")
+}
+
+func readAll(c *C, path string) ([]*Txn, int64, error) {
+	reader, err := OpenLog(File{Path: path})
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	read := []*Txn{}
+	for {
+		txn, err := reader.Next()
+		if err == io.EOF {
+			return read, reader.Offset(), nil
+		} else if err != nil {
+			return read, reader.Offset(), err
+		}
+		read = append(read, txn)
+	}
+}
+
+func (suite *TestSuiteDataDir) TestLog(c *C) {
+	f := datadirtest.NewFixture(c)
+	for _, padding := range []int{0, 4, 1024} {
+		path := f.Log(c, txns, padding)
+		read, offset, err := readAll(c, path)
+		c.Assert(err, IsNil, Commentf("padding %d", padding))
+		c.Assert(read, HasLen, len(txns))
+		for i, txn := range read {
+			c.Assert(txn.Offset > 0, Equals, true)
+			txn.Offset = 0
+			c.Assert(txn.Time.Equal(txns[i].Time), Equals, true)
+			txn.Time = txns[i].Time
+			c.Assert(txn, DeepEquals, txns[i])
+		}
+		info, err := os.Stat(path)
+		c.Assert(err, IsNil)
+		c.Assert(offset, Equals, info.Size()-int64(padding))
+	}
+
+	good := append(datadirtest.LogHeader(), datadirtest.LogRecord(txns[0])...)
+	torn := datadirtest.LogRecord(txns[1])
+	badCRC := datadirtest.LogRecord(txns[1])
+	badCRC[20] ^= 0xff
+	noEOR := datadirtest.LogRecord(txns[1])
+	noEOR[len(noEOR)-1] = 0
+	for _, t := range []struct {
+		tail []byte
+		err  error
+	}{
+		{torn[:5], ErrTruncated},
+		{torn[:len(torn)-3], ErrTruncated},
+		{append(torn[:len(torn)-3], make([]byte, 100)...), ErrTruncated},
+		{badCRC, ErrBadCRC},
+		{noEOR, ErrTruncated},
+		{[]byte{0, 0, 0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff}, ErrBadTxn},
+	} {
+		path := f.Write(c, "log.1", append(append([]byte{}, good...), t.tail...))
+		read, offset, err := readAll(c, path)
+		c.Assert(read, HasLen, 1)
+		c.Assert(Cause(err), Equals, t.err)
+		c.Assert(err.(*FileError).Offset, Equals, int64(len(good)))
+		c.Assert(offset, Equals, int64(len(good)))
+	}
+
+	f.Write(c, "log.2", []byte("ZKSN"))
+	_, err := OpenLog(File{Path: filepath.Join(f.Dir, "log.2")})
+	c.Assert(Cause(err), Equals, ErrTruncated)
+}
+
+func (suite *TestSuiteDataDir) TestInspect(c *C) {
+	f := datadirtest.NewFixture(c)
+	f.Epochs(c, "2", "2")
+	f.Write(c, MyIdFile, []byte("3"))
+	f.Snapshot(c, 0x100000002, map[int64]int32{0x99: 30000, 0x98: 30000}, []*Node{
+		{Path: "/", Data: []byte{}, ACL: 1},
+		{Path: "/lock", Data: []byte{}, ACL: 1, Stat: Stat{EphemeralOwner: 0x99}},
+	})
+	f.Snapshot(c, 0x100000006, nil, nil)
+	f.Write(c, VersionDir+"/snapshot.100000006", []byte("corrupt"))
+	f.Log(c, txns[:4], 100)
+	f.Log(c, txns[4:], 0)
+
+	listed := []Zxid{}
+	summary, err := Inspect(f.Dir, "", func(txn *Txn) {
+		listed = append(listed, txn.Zxid)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(summary.MyId, Equals, int64(3))
+	c.Assert(summary.AcceptedEpoch, Equals, int64(2))
+	c.Assert(summary.CurrentEpoch, Equals, int64(2))
+	c.Assert(summary.Snapshots, HasLen, 2)
+	c.Assert(summary.Snapshot.Zxid, Equals, Zxid(0x100000002))
+	c.Assert(summary.Snapshot.Nodes, Equals, 2)
+	c.Assert(summary.Snapshot.Ephemerals, Equals, 1)
+	c.Assert(summary.Snapshot.Sessions, Equals, 2)
+	c.Assert(summary.Logs, HasLen, 2)
+	c.Assert(summary.Logs[0].FirstZxid, Equals, Zxid(0x100000003))
+	c.Assert(summary.Logs[0].LastZxid, Equals, Zxid(0x100000006))
+	c.Assert(summary.Logs[0].Txns, Equals, 4)
+	c.Assert(summary.LastZxid, Equals, Zxid(0x200000002))
+	c.Assert(summary.Sessions, Equals, 2) // 0x98 and 0x100
+	c.Assert(summary.Errors, HasLen, 1)
+	c.Assert(summary.Errors[0], Matches, "err-bad-magic:.*snapshot.100000006 at offset 0")
+	c.Assert(listed, HasLen, 6)
+
+	// Torn log
+	path := f.Log(c, txns[4:], 0)
+	buff, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	f.Write(c, VersionDir+"/log.200000001", buff[:len(buff)-1])
+	summary, err = Inspect(f.Dir, "", nil)
+	c.Assert(err, IsNil)
+	c.Assert(summary.LastZxid, Equals, Zxid(0x200000001))
+	c.Assert(summary.Logs[1].Txns, Equals, 1)
+	c.Assert(summary.Logs[1].Err, Matches, "err-truncated:.*log.200000001 at offset .*")
+}
+
+func (suite *TestSuiteDataDir) TestFilter(c *C) {
+	for _, t := range []struct {
+		filter Filter
+		match  []Zxid
+	}{
+		{Filter{}, []Zxid{0x100000003, 0x100000004, 0x100000005, 0x100000006, 0x200000001, 0x200000002}},
+		{Filter{Path: "/app"}, []Zxid{0x100000004, 0x100000005}},
+		{Filter{Path: "/app/lock"}, []Zxid{0x100000005}},
+		{Filter{Path: "/ap"}, []Zxid{}},
+		{Filter{Path: "/"}, []Zxid{0x100000004, 0x100000005, 0x200000001}},
+		{Filter{Types: []TxnType{TxnSetData}}, []Zxid{0x100000005}},
+		{Filter{Types: []TxnType{TxnCreateSession, TxnCloseSession}}, []Zxid{0x100000003, 0x100000006}},
+		{Filter{Types: []TxnType{TxnDelete}, Path: "/app"}, []Zxid{}},
+		{Filter{Since: at(3), Until: at(5)}, []Zxid{0x100000005, 0x100000006, 0x200000001}},
+	} {
+		match := []Zxid{}
+		for _, txn := range txns {
+			if t.filter.Match(txn) {
+				match = append(match, txn.Zxid)
+			}
+		}
+		c.Assert(match, DeepEquals, t.match, Commentf("%+v", t.filter))
+	}
+
+	t, err := ParseTxnType("setdata")
+	c.Assert(err, IsNil)
+	c.Assert(t, Equals, TxnSetData)
+	_, err = ParseTxnType("rename")
+	c.Assert(err, Equals, ErrBadTxnType)
+	c.Assert(TxnType(99).String(), Equals, "type-99")
+}
+
+func (suite *TestSuiteDataDir) TestCheckLog(c *C) {
+	f := datadirtest.NewFixture(c)
+	good := append(datadirtest.LogHeader(), datadirtest.LogRecord(txns[0])...)
+	torn := datadirtest.LogRecord(txns[1])
+	badCRC := datadirtest.LogRecord(txns[1])
+	badCRC[20] ^= 0xff
+	noEOR := datadirtest.LogRecord(txns[1])
+	noEOR[len(noEOR)-1] = 0
+	for _, t := range []struct {
+		tail []byte
+		err  error
+		torn bool
+	}{
+		{make([]byte, 100), nil, false},
+		{torn[:5], ErrTruncated, true},
+		{append(torn[:len(torn)-3], make([]byte, 100)...), ErrTruncated, true},
+		{append(append([]byte{}, badCRC...), make([]byte, 100)...), ErrBadCRC, true},
+		{append(append([]byte{}, badCRC...), datadirtest.LogRecord(txns[2])...), ErrBadCRC, false},
+		{append(append([]byte{}, noEOR...), datadirtest.LogRecord(txns[2])...), ErrTruncated, false},
+		{[]byte{0, 0, 0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff}, ErrBadTxn, false},
+	} {
+		path := f.Write(c, "log.1", append(append([]byte{}, good...), t.tail...))
+		check, err := CheckLog(File{Path: path})
+		c.Assert(err, IsNil)
+		c.Assert(check.Txns, Equals, 1)
+		c.Assert(check.LastZxid, Equals, txns[0].Zxid)
+		c.Assert(check.End, Equals, int64(len(good)))
+		if t.err == nil {
+			c.Assert(check.Err, IsNil)
+		} else {
+			c.Assert(Cause(check.Err), Equals, t.err)
+		}
+		c.Assert(check.Torn, Equals, t.torn, Commentf("%v", t.err))
+	}
+
+	for _, buff := range [][]byte{{}, datadirtest.LogHeader()[:5], make([]byte, 1024)} {
+		path := f.Write(c, "log.2", buff)
+		check, err := CheckLog(File{Path: path})
+		c.Assert(err, IsNil)
+		c.Assert(check.Err, NotNil)
+		c.Assert(check.End, Equals, int64(0))
+		c.Assert(check.Torn, Equals, true)
+	}
+	path := f.Write(c, "log.3", []byte("not a transaction log"))
+	check, err := CheckLog(File{Path: path})
+	c.Assert(err, IsNil)
+	c.Assert(Cause(check.Err), Equals, ErrBadMagic)
+	c.Assert(check.Torn, Equals, false)
+}
+
+func (suite *TestSuiteDataDir) TestQuarantine(c *C) {
+	f := datadirtest.NewFixture(c)
+	quarantine := filepath.Join(f.Dir, "quarantine")
+	good := append(datadirtest.LogHeader(), datadirtest.LogRecord(txns[0])...)
+	torn := datadirtest.LogRecord(txns[1])[:19] // Ends in a byte that is not zero
+	path := f.Write(c, "log.1", append(append(append([]byte{}, good...), torn...), make([]byte, 1024)...))
+	check, err := CheckLog(File{Path: path})
+	c.Assert(err, IsNil)
+	c.Assert(check.Torn, Equals, true)
+
+	moved, err := Quarantine(check, quarantine)
+	c.Assert(err, IsNil)
+	c.Assert(moved, Equals, filepath.Join(quarantine, fmt.Sprintf("log.1.%d", len(good))))
+	buff, err := ioutil.ReadFile(moved)
+	c.Assert(err, IsNil)
+	c.Assert(buff, DeepEquals, torn)
+	buff, err = ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(buff, DeepEquals, good)
+	check, err = CheckLog(File{Path: path})
+	c.Assert(err, IsNil)
+	c.Assert(check.Err, IsNil)
+	c.Assert(check.Txns, Equals, 1)
+
+	// Without a header
+	path = f.Write(c, "log.2", []byte{})
+	check, err = CheckLog(File{Path: path})
+	c.Assert(err, IsNil)
+	moved, err = Quarantine(check, quarantine)
+	c.Assert(err, IsNil)
+	c.Assert(moved, Equals, filepath.Join(quarantine, "log.2.0"))
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -0,0 +1,152 @@
+// Writes snapshots and transaction logs the way ZooKeeper does, for tests.
+package datadirtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/datadir"
+	"github.com/conductant/zk/pkg/jute"
+	. "gopkg.in/check.v1"
+	"hash/adler32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writes files the way ZooKeeper does.
+type Fixture struct {
+	Dir string
+}
+
+// A data directory with an empty version-2 directory.
+func NewFixture(c *C) *Fixture {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dir, datadir.VersionDir), 0755), IsNil)
+	return &Fixture{Dir: dir}
+}
+
+// Writes the file, named relative to the data directory.
+func (this *Fixture) Write(c *C, name string, buff []byte) string {
+	path := filepath.Join(this.Dir, name)
+	c.Assert(ioutil.WriteFile(path, buff, 0644), IsNil)
+	return path
+}
+
+// Writes acceptedEpoch and currentEpoch next to the snapshots, as ZooKeeper does once the server
+// has joined a quorum.
+func (this *Fixture) Epochs(c *C, accepted, current string) {
+	this.Write(c, filepath.Join(datadir.VersionDir, datadir.AcceptedEpochFile), []byte(accepted))
+	this.Write(c, filepath.Join(datadir.VersionDir, datadir.CurrentEpochFile), []byte(current))
+}
+
+// A snapshot of the sessions and nodes, parents first, named after the zxid.
+func (this *Fixture) Snapshot(c *C, zxid datadir.Zxid, sessions map[int64]int32, nodes []*datadir.Node) string {
+	e := jute.NewEncoder()
+	e.WriteInt(datadir.SnapshotMagic)
+	e.WriteInt(datadir.FileVersion)
+	e.WriteLong(-1)
+	e.WriteInt(int32(len(sessions)))
+	for id, timeout := range sessions {
+		e.WriteLong(id)
+		e.WriteInt(timeout)
+	}
+	e.WriteInt(1)
+	e.WriteLong(1)
+	writeACLs(e, client.OpenACL)
+	for _, node := range nodes {
+		if node.Path == "/" {
+			e.WriteString("")
+		} else {
+			e.WriteString(node.Path)
+		}
+		e.WriteBuffer(node.Data)
+		e.WriteLong(node.ACL)
+		e.WriteLong(int64(node.Stat.Czxid))
+		e.WriteLong(int64(node.Stat.Mzxid))
+		e.WriteLong(node.Stat.Ctime)
+		e.WriteLong(node.Stat.Mtime)
+		e.WriteInt(node.Stat.Version)
+		e.WriteInt(node.Stat.Cversion)
+		e.WriteInt(node.Stat.Aversion)
+		e.WriteLong(node.Stat.EphemeralOwner)
+		e.WriteLong(int64(node.Stat.Pzxid))
+	}
+	e.WriteString("/")
+	sum := adler32.Checksum(e.Bytes())
+	e.WriteLong(int64(sum))
+	e.WriteString("/")
+	return this.Write(c, fmt.Sprintf("%s/%s%x", datadir.VersionDir, datadir.SnapshotPrefix, int64(zxid)), e.Bytes())
+}
+
+// A log of the transactions, padded with zeros.
+func (this *Fixture) Log(c *C, txns []*datadir.Txn, padding int) string {
+	buff := LogHeader()
+	for _, txn := range txns {
+		buff = append(buff, LogRecord(txn)...)
+	}
+	buff = append(buff, make([]byte, padding)...)
+	return this.Write(c, fmt.Sprintf("%s/%s%x", datadir.VersionDir, datadir.LogPrefix, int64(txns[0].Zxid)), buff)
+}
+
+// Header of a log file.
+func LogHeader() []byte {
+	buff := make([]byte, datadir.LogHeaderSize)
+	binary.BigEndian.PutUint32(buff, datadir.LogMagic)
+	binary.BigEndian.PutUint32(buff[4:], datadir.FileVersion)
+	return buff
+}
+
+// A record of a log: checksum, length, the txn and the end of record byte.
+func LogRecord(txn *datadir.Txn) []byte {
+	e := jute.NewEncoder()
+	e.WriteLong(txn.Session)
+	e.WriteInt(txn.Cxid)
+	e.WriteLong(int64(txn.Zxid))
+	e.WriteLong(txn.Time.UnixNano() / int64(time.Millisecond))
+	e.WriteInt(int32(txn.Type))
+	encodeBody(e, txn)
+	body := e.Bytes()
+
+	record := make([]byte, 12, 12+len(body)+1)
+	binary.BigEndian.PutUint64(record, uint64(adler32.Checksum(body)))
+	binary.BigEndian.PutUint32(record[8:], uint32(len(body)))
+	return append(append(record, body...), datadir.EndOfRecord)
+}
+
+func encodeBody(e *jute.Encoder, txn *datadir.Txn) {
+	switch txn.Type {
+	case datadir.TxnCreate:
+		e.WriteString(txn.Path)
+		e.WriteBuffer(txn.Data)
+		writeACLs(e, txn.ACL)
+		e.WriteBool(txn.Ephemeral)
+		e.WriteInt(1)
+	case datadir.TxnDelete:
+		e.WriteString(txn.Path)
+	case datadir.TxnSetData:
+		e.WriteString(txn.Path)
+		e.WriteBuffer(txn.Data)
+		e.WriteInt(txn.Version)
+	case datadir.TxnCreateSession:
+		e.WriteInt(txn.Timeout)
+	case datadir.TxnError:
+		e.WriteInt(txn.Err)
+	case datadir.TxnMulti:
+		e.WriteInt(int32(len(txn.Ops)))
+		for _, op := range txn.Ops {
+			e.WriteInt(int32(op.Type))
+			oe := jute.NewEncoder()
+			encodeBody(oe, op)
+			e.WriteBuffer(oe.Bytes())
+		}
+	}
+}
+
+func writeACLs(e *jute.Encoder, acl []client.ACL) {
+	e.WriteInt(int32(len(acl)))
+	for _, entry := range acl {
+		entry.Encode(e)
+	}
+}
@@ -0,0 +1,188 @@
+package datadir
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// What a data directory holds.  Epochs and MyId are -1 if their file is missing.
+type Summary struct {
+	Dir           string           `json:"dir"`
+	LogDir        string           `json:"logDir"`
+	MyId          int64            `json:"myid"`
+	AcceptedEpoch int64            `json:"acceptedEpoch"`
+	CurrentEpoch  int64            `json:"currentEpoch"`
+	Snapshots     []File           `json:"snapshots"`
+	Snapshot      *SnapshotSummary `json:"snapshot,omitempty"`
+	Logs          []LogSummary     `json:"logs"`
+	LastZxid      Zxid             `json:"lastZxid"`
+	Sessions      int              `json:"sessions"`
+	Errors        []string         `json:"errors,omitempty"`
+}
+
+// The latest snapshot that could be read.
+type SnapshotSummary struct {
+	File
+	Nodes      int `json:"nodes"`
+	Ephemerals int `json:"ephemerals"`
+	Sessions   int `json:"sessions"`
+}
+
+type LogSummary struct {
+	File
+	FirstZxid Zxid   `json:"firstZxid"`
+	LastZxid  Zxid   `json:"lastZxid"`
+	Txns      int    `json:"txns"`
+	Err       string `json:"error,omitempty"`
+}
+
+// Reads the latest good snapshot and all the logs, calling each, if not nil, with every
+// transaction.  The sessions are those of the snapshot, opened and closed by the transactions
+// after it.  Files that can't be read are listed in Errors.
+func Inspect(dir, logDir string, each func(*Txn)) (*Summary, error) {
+	dataDir, err := Open(dir, logDir)
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{
+		Dir:       dataDir.Dir,
+		LogDir:    dataDir.LogDir,
+		Snapshots: dataDir.Snapshots,
+		Logs:      []LogSummary{},
+		Errors:    []string{},
+	}
+	if summary.MyId, err = dataDir.MyId(); err != nil {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+	if summary.AcceptedEpoch, err = dataDir.Epoch(AcceptedEpochFile); err != nil {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+	if summary.CurrentEpoch, err = dataDir.Epoch(CurrentEpochFile); err != nil {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+
+	// Like ZooKeeper, fall back to older snapshots if the latest is bad.
+	sessions := map[int64]bool{}
+	for i := len(dataDir.Snapshots) - 1; i >= 0; i-- {
+		file := dataDir.Snapshots[i]
+		ephemerals := 0
+		snapshot, err := ReadSnapshot(file, func(node *Node) error {
+			if node.Stat.EphemeralOwner != 0 {
+				ephemerals++
+			}
+			return nil
+		})
+		if err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+			continue
+		}
+		summary.Snapshot = &SnapshotSummary{
+			File:       file,
+			Nodes:      snapshot.Nodes,
+			Ephemerals: ephemerals,
+			Sessions:   len(snapshot.Sessions),
+		}
+		summary.LastZxid = file.Zxid
+		for id := range snapshot.Sessions {
+			sessions[id] = true
+		}
+		break
+	}
+
+	for _, file := range dataDir.Logs {
+		log := LogSummary{File: file}
+		err := readLog(file, func(txn *Txn) {
+			if log.Txns == 0 {
+				log.FirstZxid = txn.Zxid
+			}
+			log.LastZxid = txn.Zxid
+			log.Txns++
+			if txn.Zxid > summary.LastZxid {
+				summary.LastZxid = txn.Zxid
+			}
+			if summary.Snapshot == nil || txn.Zxid > summary.Snapshot.Zxid {
+				switch txn.Type {
+				case TxnCreateSession:
+					sessions[txn.Session] = true
+				case TxnCloseSession:
+					delete(sessions, txn.Session)
+				}
+			}
+			if each != nil {
+				each(txn)
+			}
+		})
+		if err != nil {
+			log.Err = err.Error()
+			summary.Errors = append(summary.Errors, err.Error())
+		}
+		summary.Logs = append(summary.Logs, log)
+	}
+	summary.Sessions = len(sessions)
+	return summary, nil
+}
+
+func readLog(file File, each func(*Txn)) error {
+	reader, err := OpenLog(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for {
+		txn, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		each(txn)
+	}
+}
+
+// Selects transactions.  Zero fields match all.
+type Filter struct {
+	// The path or its descendants
+	Path  string
+	Types []TxnType
+	Since time.Time
+	Until time.Time
+}
+
+// Whether the transaction matches.  A multi matches if any of its operations has the type, or
+// any has the path.
+func (this *Filter) Match(txn *Txn) bool {
+	if !this.Since.IsZero() && txn.Time.Before(this.Since) {
+		return false
+	}
+	if !this.Until.IsZero() && txn.Time.After(this.Until) {
+		return false
+	}
+	return (len(this.Types) == 0 || this.hasType(txn)) && (this.Path == "" || this.hasPath(txn))
+}
+
+func (this *Filter) hasType(txn *Txn) bool {
+	for _, t := range this.Types {
+		if t == txn.Type {
+			return true
+		}
+	}
+	for _, op := range txn.Ops {
+		if this.hasType(op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Filter) hasPath(txn *Txn) bool {
+	if txn.Path != "" && (this.Path == "/" || txn.Path == this.Path || strings.HasPrefix(txn.Path, this.Path+"/")) {
+		return true
+	}
+	for _, op := range txn.Ops {
+		if this.hasPath(op) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package datadir
+
+import (
+	"bufio"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/jute"
+	"hash"
+	"hash/adler32"
+	"io"
+	"os"
+)
+
+const (
+	SnapshotMagic = 0x5a4b534e // ZKSN
+	LogMagic      = 0x5a4b4c47 // ZKLG
+	FileVersion   = 2
+)
+
+// Metadata of a znode as it is persisted.  Times are milliseconds since the epoch.
+type Stat struct {
+	Czxid          Zxid  `json:"czxid"`
+	Mzxid          Zxid  `json:"mzxid"`
+	Ctime          int64 `json:"ctime"`
+	Mtime          int64 `json:"mtime"`
+	Version        int32 `json:"version"`
+	Cversion       int32 `json:"cversion"`
+	Aversion       int32 `json:"aversion"`
+	EphemeralOwner int64 `json:"ephemeralOwner"`
+	Pzxid          Zxid  `json:"pzxid"`
+}
+
+func (this *Stat) Decode(d *jute.Decoder) {
+	this.Czxid = Zxid(d.ReadLong())
+	this.Mzxid = Zxid(d.ReadLong())
+	this.Ctime = d.ReadLong()
+	this.Mtime = d.ReadLong()
+	this.Version = d.ReadInt()
+	this.Cversion = d.ReadInt()
+	this.Aversion = d.ReadInt()
+	this.EphemeralOwner = d.ReadLong()
+	this.Pzxid = Zxid(d.ReadLong())
+}
+
+// A znode of a snapshot.  ACL refers to an entry of Snapshot.ACLs.
+type Node struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+	ACL  int64  `json:"acl"`
+	Stat Stat   `json:"stat"`
+}
+
+// A snapshot of the tree, without the znodes.  The snapshot is fuzzy: it was taken while
+// transactions after Zxid were being applied.
+type Snapshot struct {
+	Path     string                 `json:"path"`
+	Zxid     Zxid                   `json:"zxid"`
+	DbId     int64                  `json:"dbId"`
+	Sessions map[int64]int32        `json:"sessions"`
+	ACLs     map[int64][]client.ACL `json:"acls"`
+	Nodes    int                    `json:"nodes"`
+}
+
+// Counts the bytes read and sums them while check is set.
+type checkedReader struct {
+	reader io.Reader
+	hash   hash.Hash32
+	check  bool
+	offset int64
+}
+
+func (this *checkedReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	if this.check {
+		this.hash.Write(p[:n])
+	}
+	this.offset += int64(n)
+	return n, err
+}
+
+// Reads the snapshot and verifies its checksum, calling each, if not nil, with every znode.
+// Stops at the first error each returns.
+func ReadSnapshot(file File, each func(*Node) error) (*Snapshot, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := &checkedReader{reader: bufio.NewReader(f), hash: adler32.New(), check: true}
+	d := jute.NewDecoder(reader)
+	start := int64(0)
+	fail := func(err error) (*Snapshot, error) {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrTruncated
+		}
+		return nil, &FileError{Path: file.Path, Offset: start, Err: err}
+	}
+
+	if d.ReadInt() != SnapshotMagic && d.Err() == nil {
+		return fail(ErrBadMagic)
+	}
+	if d.ReadInt() != FileVersion && d.Err() == nil {
+		return fail(ErrBadVersion)
+	}
+	snapshot := &Snapshot{
+		Path:     file.Path,
+		Zxid:     file.Zxid,
+		DbId:     d.ReadLong(),
+		Sessions: map[int64]int32{},
+		ACLs:     map[int64][]client.ACL{},
+	}
+
+	start = reader.offset
+	for n := d.ReadInt(); n > 0 && d.Err() == nil; n-- {
+		id := d.ReadLong()
+		snapshot.Sessions[id] = d.ReadInt()
+	}
+	start = reader.offset
+	for n := d.ReadInt(); n > 0 && d.Err() == nil; n-- {
+		id := d.ReadLong()
+		snapshot.ACLs[id] = readACLs(d)
+	}
+	if d.Err() != nil {
+		return fail(d.Err())
+	}
+
+	// Znodes are written parents first, the root with an empty path, and end with "/".
+	for {
+		start = reader.offset
+		node := &Node{Path: d.ReadString()}
+		if node.Path == "/" || d.Err() != nil {
+			break
+		}
+		if node.Path == "" {
+			node.Path = "/"
+		}
+		node.Data = d.ReadBuffer()
+		node.ACL = d.ReadLong()
+		node.Stat.Decode(d)
+		if d.Err() != nil {
+			break
+		}
+		snapshot.Nodes++
+		if each != nil {
+			if err := each(node); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if d.Err() != nil {
+		return fail(d.Err())
+	}
+
+	start = reader.offset
+	reader.check = false
+	sum := reader.hash.Sum32()
+	checksum := d.ReadLong()
+	if d.Err() != nil {
+		return fail(d.Err())
+	}
+	if uint32(checksum) != sum || checksum>>32 != 0 {
+		return fail(ErrBadCRC)
+	}
+	return snapshot, nil
+}
+
+func readACLs(d *jute.Decoder) []client.ACL {
+	n := d.ReadLength()
+	if n < 0 {
+		return nil
+	}
+	acl := []client.ACL{}
+	for i := 0; i < n && d.Err() == nil; i++ {
+		entry := client.ACL{}
+		entry.Decode(d)
+		acl = append(acl, entry)
+	}
+	return acl
+}
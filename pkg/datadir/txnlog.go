@@ -0,0 +1,259 @@
+package datadir
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/jute"
+	"hash/adler32"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Types of transactions
+const (
+	TxnCreate          TxnType = 1
+	TxnDelete          TxnType = 2
+	TxnSetData         TxnType = 5
+	TxnSetACL          TxnType = 7
+	TxnCheck           TxnType = 13
+	TxnMulti           TxnType = 14
+	TxnCreate2         TxnType = 15
+	TxnReconfig        TxnType = 16
+	TxnCreateContainer TxnType = 19
+	TxnDeleteContainer TxnType = 20
+	TxnCreateTTL       TxnType = 21
+	TxnCreateSession   TxnType = -10
+	TxnCloseSession    TxnType = -11
+	TxnError           TxnType = -1
+)
+
+const (
+	// Size of the header of a log file
+	LogHeaderSize = 16
+	// Ends every record of a log
+	EndOfRecord = 'B'
+)
+
+type TxnType int32
+
+var txnTypeNames = map[TxnType]string{
+	TxnCreate:          "create",
+	TxnDelete:          "delete",
+	TxnSetData:         "setData",
+	TxnSetACL:          "setACL",
+	TxnCheck:           "check",
+	TxnMulti:           "multi",
+	TxnCreate2:         "create2",
+	TxnReconfig:        "reconfig",
+	TxnCreateContainer: "createContainer",
+	TxnDeleteContainer: "deleteContainer",
+	TxnCreateTTL:       "createTTL",
+	TxnCreateSession:   "createSession",
+	TxnCloseSession:    "closeSession",
+	TxnError:           "error",
+}
+
+func (this TxnType) String() string {
+	if name, has := txnTypeNames[this]; has {
+		return name
+	}
+	return fmt.Sprintf("type-%d", int32(this))
+}
+
+func (this TxnType) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+// Parses the name of a type, as in ZooKeeper's logs, e.g. setData.
+func ParseTxnType(name string) (TxnType, error) {
+	for t, n := range txnTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return 0, ErrBadTxnType
+}
+
+// A transaction.  Fields other than the header are set by type.  The operations of a multi are
+// in Ops, with only Type and their own fields set.
+type Txn struct {
+	Offset  int64     `json:"offset,omitempty"`
+	Session int64     `json:"session,omitempty"`
+	Cxid    int32     `json:"cxid,omitempty"`
+	Zxid    Zxid      `json:"zxid,omitempty"`
+	Time    time.Time `json:"time,omitempty"`
+	Type    TxnType   `json:"type"`
+
+	Path      string       `json:"path,omitempty"`
+	Data      []byte       `json:"data,omitempty"`
+	ACL       []client.ACL `json:"acl,omitempty"`
+	Ephemeral bool         `json:"ephemeral,omitempty"`
+	Version   int32        `json:"version,omitempty"`
+	TTL       int64        `json:"ttl,omitempty"`
+	Timeout   int32        `json:"timeout,omitempty"`
+	Err       int32        `json:"err,omitempty"`
+	Paths     []string     `json:"paths,omitempty"`
+	Ops       []*Txn       `json:"ops,omitempty"`
+}
+
+func (this *Txn) decodeBody(d *jute.Decoder, remaining func() int) error {
+	switch this.Type {
+	case TxnCreate, TxnCreate2, TxnCreateContainer, TxnCreateTTL:
+		this.Path = d.ReadString()
+		this.Data = d.ReadBuffer()
+		this.ACL = readACLs(d)
+		if this.Type == TxnCreate || this.Type == TxnCreate2 {
+			this.Ephemeral = d.ReadBool()
+		}
+		d.ReadInt() // Parent cversion
+		if this.Type == TxnCreateTTL {
+			this.TTL = d.ReadLong()
+		}
+	case TxnDelete, TxnDeleteContainer:
+		this.Path = d.ReadString()
+	case TxnSetData, TxnReconfig:
+		this.Path = d.ReadString()
+		this.Data = d.ReadBuffer()
+		this.Version = d.ReadInt()
+	case TxnSetACL:
+		this.Path = d.ReadString()
+		this.ACL = readACLs(d)
+		this.Version = d.ReadInt()
+	case TxnCheck:
+		this.Path = d.ReadString()
+		this.Version = d.ReadInt()
+	case TxnCreateSession:
+		this.Timeout = d.ReadInt()
+	case TxnCloseSession:
+		if remaining() > 0 {
+			this.Paths = d.ReadStrings() // Ephemerals to delete, since 3.6
+		}
+	case TxnError:
+		this.Err = d.ReadInt()
+	case TxnMulti:
+		this.Ops = []*Txn{}
+		for n := d.ReadInt(); n > 0 && d.Err() == nil; n-- {
+			op := &Txn{Type: TxnType(d.ReadInt())}
+			body := d.ReadBuffer()
+			if d.Err() != nil {
+				break
+			}
+			reader := bytes.NewReader(body)
+			if err := op.decodeBody(jute.NewDecoder(reader), reader.Len); err != nil {
+				return err
+			}
+			this.Ops = append(this.Ops, op)
+		}
+	}
+	return d.Err()
+}
+
+// Decodes a transaction from the bytes of a log record.
+func DecodeTxn(buff []byte) (*Txn, error) {
+	reader := bytes.NewReader(buff)
+	d := jute.NewDecoder(reader)
+	txn := &Txn{
+		Session: d.ReadLong(),
+		Cxid:    d.ReadInt(),
+		Zxid:    Zxid(d.ReadLong()),
+	}
+	txn.Time = time.Unix(0, d.ReadLong()*int64(time.Millisecond))
+	txn.Type = TxnType(d.ReadInt())
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	if err := txn.decodeBody(d, reader.Len); err != nil {
+		return nil, err
+	}
+	return txn, nil
+}
+
+// Reads the transactions of a log file one by one.
+type LogReader struct {
+	Path string
+	DbId int64
+
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+}
+
+func OpenLog(file File) (*LogReader, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	this := &LogReader{Path: file.Path, file: f, reader: bufio.NewReader(f)}
+	header := make([]byte, LogHeaderSize)
+	if _, err := io.ReadFull(this.reader, header); err != nil {
+		f.Close()
+		return nil, &FileError{Path: file.Path, Err: ErrTruncated}
+	}
+	if binary.BigEndian.Uint32(header) != LogMagic {
+		f.Close()
+		return nil, &FileError{Path: file.Path, Err: ErrBadMagic}
+	}
+	if binary.BigEndian.Uint32(header[4:]) != FileVersion {
+		f.Close()
+		return nil, &FileError{Path: file.Path, Err: ErrBadVersion}
+	}
+	this.DbId = int64(binary.BigEndian.Uint64(header[8:]))
+	this.offset = LogHeaderSize
+	return this, nil
+}
+
+// Returns the next transaction, or io.EOF after the last.  The log ends at the end of the file
+// or where it is padded with zeros.  A record that is cut short, doesn't match its checksum or
+// can't be decoded is a *FileError at the offset of the record.
+func (this *LogReader) Next() (*Txn, error) {
+	fail := func(err error) (*Txn, error) {
+		return nil, &FileError{Path: this.Path, Offset: this.offset, Err: err}
+	}
+	head := make([]byte, 12)
+	n, err := io.ReadFull(this.reader, head)
+	switch {
+	case err == io.EOF:
+		return nil, io.EOF
+	case bytes.Count(head[:n], []byte{0}) == n && (err != nil || n >= 8):
+		return nil, io.EOF // Padding
+	case err != nil:
+		return fail(ErrTruncated)
+	}
+	checksum := binary.BigEndian.Uint64(head)
+	length := int32(binary.BigEndian.Uint32(head[8:]))
+	if length == 0 {
+		return nil, io.EOF
+	}
+	if length < 0 || length > jute.DefaultMaxLength {
+		return fail(ErrBadTxn)
+	}
+	record := make([]byte, int(length)+1)
+	if _, err := io.ReadFull(this.reader, record); err != nil || record[length] != EndOfRecord {
+		return fail(ErrTruncated)
+	}
+	record = record[:length]
+	if uint64(adler32.Checksum(record)) != checksum {
+		return fail(ErrBadCRC)
+	}
+	txn, err := DecodeTxn(record)
+	if err != nil {
+		return fail(ErrBadTxn)
+	}
+	txn.Offset = this.offset
+	this.offset += int64(len(head)) + int64(length) + 1
+	return txn, nil
+}
+
+// Offset after the last transaction read.
+func (this *LogReader) Offset() int64 {
+	return this.offset
+}
+
+func (this *LogReader) Close() error {
+	return this.file.Close()
+}
@@ -0,0 +1,106 @@
+// Finds the members of an ensemble in DNS.
+package discovery
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	SchemeDns = "dns"
+)
+
+var (
+	ErrBadUrl = errors.New("err-bad-discovery-url")
+)
+
+// The lookups used for discovery.  See net.LookupSRV and net.LookupHost.
+type Resolver interface {
+	LookupSRV(service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(host string) ([]string, error)
+}
+
+type netResolver struct{}
+
+func (this netResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return net.LookupSRV(service, proto, name)
+}
+
+func (this netResolver) LookupHost(host string) ([]string, error) {
+	return net.LookupHost(host)
+}
+
+// Resolver backed by the system's DNS.
+var DefaultResolver Resolver = netResolver{}
+
+// Resolves the members at target into a sorted list of host:port, or just host if the
+// port isn't known.  Target can be
+//
+//	dns://_zookeeper._tcp.example.internal   SRV records, giving the host and port of each member
+//	dns://zk.example.svc.cluster.local:2181  A records, e.g. a Kubernetes headless service
+//	zk.example.svc.cluster.local             same as above
+func Resolve(resolver Resolver, target string) ([]string, error) {
+	host, port, err := parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []string{}
+	if strings.HasPrefix(host, "_") {
+		// The SRV name is given in full, so there's no service and proto.
+		_, records, err := resolver.LookupSRV("", "", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			list = append(list, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+		}
+	} else {
+		addrs, err := resolver.LookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if port == "" {
+				list = append(list, addr)
+			} else {
+				list = append(list, net.JoinHostPort(addr, port))
+			}
+		}
+	}
+	sort.Strings(list)
+	return dedupe(list), nil
+}
+
+func parse(target string) (host, port string, err error) {
+	if !strings.Contains(target, "://") {
+		target = SchemeDns + "://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != SchemeDns || u.Host == "" {
+		return "", "", ErrBadUrl
+	}
+	host = u.Host
+	if h, p, err := net.SplitHostPort(u.Host); err == nil {
+		host, port = h, p
+	}
+	return host, port, nil
+}
+
+// Removes adjacent duplicates from a sorted list.
+func dedupe(list []string) []string {
+	out := []string{}
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
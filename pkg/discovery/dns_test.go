@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"errors"
+	. "gopkg.in/check.v1"
+	"net"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) { TestingT(t) }
+
+type TestSuiteDns struct {
+}
+
+var _ = Suite(&TestSuiteDns{})
+
+func (suite *TestSuiteDns) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteDns) TearDownSuite(c *C) {
+}
+
+type fakeResolver struct {
+	srv   map[string][]*net.SRV
+	hosts map[string][]string
+}
+
+func (this *fakeResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	if records, has := this.srv[name]; has {
+		return name, records, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func (this *fakeResolver) LookupHost(host string) ([]string, error) {
+	if addrs, has := this.hosts[host]; has {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+var resolver = &fakeResolver{
+	srv: map[string][]*net.SRV{
+		"_zookeeper._tcp.example.internal": []*net.SRV{
+			{Target: "zk-2.example.internal.", Port: 2181},
+			{Target: "zk-1.example.internal.", Port: 2181},
+			{Target: "zk-1.example.internal.", Port: 2181},
+		},
+	},
+	hosts: map[string][]string{
+		"zk.example.svc.cluster.local": []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"},
+	},
+}
+
+func (suite *TestSuiteDns) TestSrv(c *C) {
+	list, err := Resolve(resolver, "dns://_zookeeper._tcp.example.internal")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"zk-1.example.internal:2181", "zk-2.example.internal:2181"})
+}
+
+func (suite *TestSuiteDns) TestHost(c *C) {
+	list, err := Resolve(resolver, "dns://zk.example.svc.cluster.local")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+
+	list, err = Resolve(resolver, "zk.example.svc.cluster.local:2182")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"10.0.0.1:2182", "10.0.0.2:2182", "10.0.0.3:2182"})
+}
+
+func (suite *TestSuiteDns) TestErrors(c *C) {
+	_, err := Resolve(resolver, "http://zk.example.svc.cluster.local")
+	c.Assert(err, Equals, ErrBadUrl)
+
+	_, err = Resolve(resolver, "dns://unknown.example.internal")
+	c.Assert(err, NotNil)
+}
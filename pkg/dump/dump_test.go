@@ -0,0 +1,229 @@
+package dump
+
+import (
+	"bytes"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/client/clienttest"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) { TestingT(t) }
+
+type TestSuiteDump struct {
+}
+
+var _ = Suite(&TestSuiteDump{})
+
+func (suite *TestSuiteDump) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteDump) TearDownSuite(c *C) {
+}
+
+var readOnly = client.WorldACL(client.PermRead)
+
+func source() *clienttest.Znodes {
+	zk := clienttest.NewZnodes()
+	zk.Add("/zookeeper", "", client.OpenACL, false)
+	zk.Add("/zookeeper/quota", "", client.OpenACL, false)
+	zk.Add("/app", "root", client.OpenACL, false)
+	zk.Add("/app/config", "debug=false", readOnly, false)
+	zk.Add("/app/.hidden", "\x00\xff", client.OpenACL, false)
+	zk.Add("/app/a b+c", "", client.OpenACL, false)
+	zk.Add("/app/workers", "", client.OpenACL, false)
+	zk.Add("/app/workers/w-0000000001", "10.0.0.1", client.OpenACL, true)
+	return zk
+}
+
+func paths(archive *Archive) []string {
+	list := []string{}
+	for _, node := range archive.Nodes {
+		list = append(list, node.Path)
+	}
+	return list
+}
+
+func actions(changes []Change) []string {
+	list := []string{}
+	for _, change := range changes {
+		what := change.Action + " " + change.Path
+		if change.Data {
+			what += " data"
+		}
+		if change.ACL {
+			what += " acl"
+		}
+		list = append(list, what)
+	}
+	return list
+}
+
+func (suite *TestSuiteDump) TestExport(c *C) {
+	ctx := context.Background()
+	archive, err := Export(ctx, source(), "/")
+	c.Assert(err, IsNil)
+	c.Assert(archive.Root, Equals, "/")
+	c.Assert(paths(archive), DeepEquals, []string{"/", "/app", "/app/.hidden", "/app/a b+c", "/app/config", "/app/workers"})
+	c.Assert(string(archive.Nodes[4].Data), Equals, "debug=false")
+	c.Assert(archive.Nodes[4].ACL, DeepEquals, readOnly)
+
+	archive, err = Export(ctx, source(), "/app/workers")
+	c.Assert(err, IsNil)
+	c.Assert(paths(archive), DeepEquals, []string{"/app/workers"})
+
+	_, err = Export(ctx, source(), "/missing")
+	c.Assert(err, ErrorMatches, "err-no-node:export /missing")
+	c.Assert(Cause(err), Equals, client.ErrNoNode)
+}
+
+func (suite *TestSuiteDump) TestFormats(c *C) {
+	archive, err := Export(context.Background(), source(), "/app")
+	c.Assert(err, IsNil)
+	for _, format := range []string{FormatJSON, FormatTar} {
+		buff := &bytes.Buffer{}
+		c.Assert(archive.Write(buff, format), IsNil)
+		read, err := ReadArchive(buff)
+		c.Assert(err, IsNil, Commentf(format))
+		c.Assert(read, DeepEquals, archive, Commentf(format))
+	}
+	c.Assert(archive.Write(&bytes.Buffer{}, "zip"), ErrorMatches, `err-bad-format:"zip".  Use json or tar`)
+	c.Assert(CheckFormat(FormatTar), IsNil)
+	c.Assert(Cause(CheckFormat("zip")), Equals, ErrBadFormat)
+
+	c.Assert(tarDir("/"), Equals, "znodes")
+	c.Assert(tarDir("/app/.hidden"), Equals, "znodes/app/%2Ehidden")
+	c.Assert(tarDir("/app/a b+c"), Equals, "znodes/app/a+b%2Bc")
+}
+
+func (suite *TestSuiteDump) TestBadArchive(c *C) {
+	for _, t := range []struct {
+		archive string
+		err     string
+	}{
+		{`{"root": "/a"`, "err-bad-archive:unexpected EOF"},
+		{`{"root": "/a", "nodes": []}`, "err-bad-archive:no znodes"},
+		{`{"root": "/a", "nodes": [{"path": "/b"}]}`, "err-bad-archive:first znode /b is not the root /a"},
+		{`{"root": "/a", "nodes": [{"path": "/a"}, {"path": "/b"}]}`, "err-bad-archive:/b comes before its parent or is not under /a"},
+		{`{"root": "/a", "nodes": [{"path": "/a"}, {"path": "/a/b/c"}, {"path": "/a/b"}]}`, "err-bad-archive:/a/b/c comes before .*"},
+		{`{"root": "/a", "nodes": [{"path": "/a"}, {"path": "/a/b"}, {"path": "/a/b"}]}`, "err-bad-archive:/a/b is listed more than once"},
+		{`{"root": "/a/", "nodes": [{"path": "/a/"}]}`, `err-bad-archive:bad path "/a/"`},
+	} {
+		_, err := ReadArchive(strings.NewReader(t.archive))
+		c.Assert(err, ErrorMatches, t.err, Commentf(t.archive))
+	}
+}
+
+func (suite *TestSuiteDump) TestImport(c *C) {
+	ctx := context.Background()
+	archive, err := Export(ctx, source(), "/app")
+	c.Assert(err, IsNil)
+
+	// Moved, creating the parents
+	zk := clienttest.NewZnodes()
+	changes, err := Import(ctx, zk, archive, ImportOptions{To: "/copy/of/app", Policy: PolicyFail})
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, []string{
+		"create /copy",
+		"create /copy/of",
+		"create /copy/of/app",
+		"create /copy/of/app/.hidden",
+		"create /copy/of/app/a b+c",
+		"create /copy/of/app/config",
+		"create /copy/of/app/workers",
+	})
+	c.Assert(zk.Data("/copy/of/app/config"), Equals, "debug=false")
+	c.Assert(zk.ACL("/copy/of/app/config"), DeepEquals, readOnly)
+	c.Assert(zk.ACL("/copy"), DeepEquals, client.OpenACL)
+
+	// Again
+	writes := zk.Writes()
+	changes, err = Import(ctx, zk, archive, ImportOptions{To: "/copy/of/app", Policy: PolicyFail})
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 5)
+	for _, change := range changes {
+		c.Assert(change.Action, Equals, ActionUnchanged)
+	}
+	c.Assert(zk.Writes(), Equals, writes)
+}
+
+func (suite *TestSuiteDump) TestPolicies(c *C) {
+	ctx := context.Background()
+	archive, err := Export(ctx, source(), "/app")
+	c.Assert(err, IsNil)
+	target := func() *clienttest.Znodes {
+		zk := clienttest.NewZnodes()
+		zk.Add("/app", "root", client.OpenACL, false)
+		zk.Add("/app/config", "debug=true", client.OpenACL, false)
+		zk.Add("/app/workers", "", client.OpenACL, false)
+		zk.Add("/app/.hidden", "\x00\xff", readOnly, false)
+		return zk
+	}
+	expected := []string{
+		"unchanged /app",
+		"%s /app/.hidden acl",
+		"create /app/a b+c",
+		"%s /app/config data acl",
+		"unchanged /app/workers",
+	}
+	plan := func(action string) []string {
+		list := []string{}
+		for _, line := range expected {
+			list = append(list, strings.Replace(line, "%s", action, 1))
+		}
+		return list
+	}
+
+	zk := target()
+	changes, err := Import(ctx, zk, archive, ImportOptions{Policy: PolicyFail})
+	c.Assert(err, ErrorMatches, "err-conflict:/app/.hidden, /app/config")
+	c.Assert(actions(changes), DeepEquals, plan(ActionConflict))
+	c.Assert(zk.Writes(), Equals, 0)
+
+	changes, err = Import(ctx, zk, archive, ImportOptions{Policy: PolicyFail, DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, plan(ActionConflict))
+	config := changes[3]
+	c.Assert(string(config.Old.Data), Equals, "debug=true")
+	c.Assert(config.Old.ACL, DeepEquals, client.OpenACL)
+	c.Assert(string(config.New.Data), Equals, "debug=false")
+	c.Assert(config.New.ACL, DeepEquals, readOnly)
+	c.Assert(changes[2].Old, IsNil)
+
+	changes, err = Import(ctx, zk, archive, ImportOptions{Policy: PolicyOverwrite, DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, plan(ActionUpdate))
+	c.Assert(zk.Writes(), Equals, 0)
+
+	changes, err = Import(ctx, zk, archive, ImportOptions{Policy: PolicySkip})
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, plan(ActionSkip))
+	c.Assert(zk.Data("/app/config"), Equals, "debug=true")
+	c.Assert(zk.Data("/app/a b+c"), Equals, "")
+
+	zk = target()
+	changes, err = Import(ctx, zk, archive, ImportOptions{Policy: PolicyOverwrite})
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, plan(ActionUpdate))
+	c.Assert(zk.Data("/app/config"), Equals, "debug=false")
+	c.Assert(zk.ACL("/app/config"), DeepEquals, readOnly)
+	c.Assert(zk.ACL("/app/.hidden"), DeepEquals, client.OpenACL)
+
+	_, err = Import(ctx, zk, archive, ImportOptions{Policy: "merge"})
+	c.Assert(err, ErrorMatches, `err-bad-policy:"merge".  Use skip, overwrite or fail`)
+}
+
+func (suite *TestSuiteDump) TestRelocate(c *C) {
+	for _, t := range [][4]string{
+		{"/a/b", "/a", "/x", "/x/b"},
+		{"/a", "/a", "/x", "/x"},
+		{"/a/b", "/a", "/", "/b"},
+		{"/a", "/", "/x", "/x/a"},
+		{"/", "/", "/x", "/x"},
+		{"/a/b", "/a", "/a", "/a/b"},
+	} {
+		c.Assert(relocate(t[0], t[1], t[2]), Equals, t[3], Commentf("%v", t))
+	}
+}
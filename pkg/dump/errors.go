@@ -0,0 +1,42 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors returned by this package.  Errors with detail are an *Error; use Cause to get
+// the kind.  Failed ZooKeeper operations are an *Error of the client's error, e.g.
+// client.ErrNoAuth.
+var (
+	ErrBadFormat  = errors.New("err-bad-format")
+	ErrBadArchive = errors.New("err-bad-archive")
+	ErrBadPolicy  = errors.New("err-bad-policy")
+	ErrConflict   = errors.New("err-conflict")
+)
+
+// An error of one of the kinds above, with detail.
+type Error struct {
+	Err    error
+	Detail string
+}
+
+func (this *Error) Error() string {
+	return this.Err.Error() + ":" + this.Detail
+}
+
+func newError(err error, format string, args ...interface{}) *Error {
+	return &Error{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Kind of the error.  Errors of other packages are returned as is.
+func Cause(err error) error {
+	if err, is := err.(*Error); is {
+		return err.Err
+	}
+	return err
+}
+
+func opError(op, path string, err error) error {
+	return newError(err, "%s %s", op, path)
+}
@@ -0,0 +1,137 @@
+package dump
+
+import (
+	"github.com/conductant/zk/pkg/client"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+// ZooKeeper's own subtree, never exported.
+const ReservedPath = "/zookeeper"
+
+// A znode with its data, metadata and ACL.
+type Node struct {
+	Path string       `json:"path"`
+	Data []byte       `json:"data"`
+	Stat client.Stat  `json:"stat"`
+	ACL  []client.ACL `json:"acl"`
+}
+
+// A subtree of znodes.  Parents come before their children.
+type Archive struct {
+	Root  string  `json:"root"`
+	Nodes []*Node `json:"nodes"`
+}
+
+// The operations of the ZooKeeper client used for exporting
+type Reader interface {
+	Get(ctx context.Context, path string) ([]byte, *client.Stat, error)
+	GetACL(ctx context.Context, path string) ([]client.ACL, *client.Stat, error)
+	Children(ctx context.Context, path string) ([]string, *client.Stat, error)
+}
+
+// Reads the subtree at root, skipping ephemeral znodes.  Znodes are read one at a time, so the
+// archive is not a consistent snapshot of a tree that is being changed.
+func Export(ctx context.Context, zk Reader, root string) (*Archive, error) {
+	archive := &Archive{Root: root, Nodes: []*Node{}}
+	if err := export(ctx, zk, root, archive); err != nil {
+		return nil, err
+	}
+	if len(archive.Nodes) == 0 {
+		return nil, opError("export", root, client.ErrNoNode)
+	}
+	return archive, nil
+}
+
+func export(ctx context.Context, zk Reader, p string, archive *Archive) error {
+	data, stat, err := zk.Get(ctx, p)
+	switch {
+	case err == client.ErrNoNode:
+		return nil // Deleted since its parent was read
+	case err != nil:
+		return opError("get", p, err)
+	case stat.EphemeralOwner != 0:
+		return nil
+	}
+	acl, _, err := zk.GetACL(ctx, p)
+	if err == client.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return opError("get acl", p, err)
+	}
+	archive.Nodes = append(archive.Nodes, &Node{Path: p, Data: data, Stat: *stat, ACL: acl})
+
+	children, _, err := zk.Children(ctx, p)
+	if err == client.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return opError("get children", p, err)
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		path := join(p, child)
+		if path == ReservedPath {
+			continue
+		}
+		if err := export(ctx, zk, path, archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that the nodes are the subtree at Root, with parents first.
+func (this *Archive) validate() error {
+	if len(this.Nodes) == 0 {
+		return newError(ErrBadArchive, "no znodes")
+	}
+	seen := map[string]bool{}
+	for i, node := range this.Nodes {
+		if i == 0 {
+			if node.Path != this.Root {
+				return newError(ErrBadArchive, "first znode %s is not the root %s", node.Path, this.Root)
+			}
+		} else if !seen[parent(node.Path)] {
+			return newError(ErrBadArchive, "%s comes before its parent or is not under %s", node.Path, this.Root)
+		}
+		if seen[node.Path] {
+			return newError(ErrBadArchive, "%s is listed more than once", node.Path)
+		}
+		if !validPath(node.Path) {
+			return newError(ErrBadArchive, "bad path %q", node.Path)
+		}
+		seen[node.Path] = true
+	}
+	return nil
+}
+
+func join(p, name string) string {
+	if p == "/" {
+		return "/" + name
+	}
+	return p + "/" + name
+}
+
+func parent(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+func validPath(p string) bool {
+	if p == "/" {
+		return true
+	}
+	if !strings.HasPrefix(p, "/") || strings.ContainsRune(p, 0) {
+		return false
+	}
+	for _, name := range strings.Split(p[1:], "/") {
+		if name == "" || name == "." || name == ".." {
+			return false
+		}
+	}
+	return true
+}
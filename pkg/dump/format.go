@@ -0,0 +1,182 @@
+package dump
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Formats of archives
+const (
+	FormatJSON = "json"
+	FormatTar  = "tar"
+)
+
+// In a tar archive every znode is a directory under TarPrefix, named by its path.  The
+// directory holds the data in TarDataFile and the path, stat and ACL as JSON in TarMetaFile.
+// Names of znodes are escaped so that they never start with a dot.
+const (
+	TarPrefix   = "znodes"
+	TarDataFile = ".data"
+	TarMetaFile = ".meta"
+)
+
+// Returns an error of kind ErrBadFormat unless the format is json or tar.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatTar:
+		return nil
+	}
+	return newError(ErrBadFormat, "%q.  Use json or tar", format)
+}
+
+// Writes the archive in the format.
+func (this *Archive) Write(w io.Writer, format string) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	if format == FormatTar {
+		return this.writeTar(w)
+	}
+	buff, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buff, '\n'))
+	return err
+}
+
+func (this *Archive) writeTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, node := range this.Nodes {
+		dir := tarDir(node.Path)
+		mtime := time.Unix(0, node.Stat.Mtime*int64(time.Millisecond))
+		meta, err := json.Marshal(&Node{Path: node.Path, Stat: node.Stat, ACL: node.ACL})
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: dir + "/", Mode: 0755, ModTime: mtime, Typeflag: tar.TypeDir})
+		if err != nil {
+			return err
+		}
+		for _, file := range []struct {
+			name string
+			buff []byte
+		}{
+			{TarMetaFile, meta},
+			{TarDataFile, node.Data},
+		} {
+			header := &tar.Header{
+				Name:     dir + "/" + file.name,
+				Mode:     0644,
+				Size:     int64(len(file.buff)),
+				ModTime:  mtime,
+				Typeflag: tar.TypeReg,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(file.buff); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// Directory of the znode in a tar archive.
+func tarDir(p string) string {
+	dir := TarPrefix
+	if p == "/" {
+		return dir
+	}
+	for _, name := range strings.Split(p[1:], "/") {
+		name = url.QueryEscape(name)
+		if strings.HasPrefix(name, ".") {
+			name = "%2E" + name[1:]
+		}
+		dir += "/" + name
+	}
+	return dir
+}
+
+// Reads an archive written in either format.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(262)
+	var archive *Archive
+	var err error
+	if len(head) == 262 && bytes.HasPrefix(head[257:], []byte("ustar")) {
+		archive, err = readTar(br)
+	} else {
+		archive = &Archive{}
+		if err = json.NewDecoder(br).Decode(archive); err != nil {
+			err = newError(ErrBadArchive, "%v", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.validate(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func readTar(r io.Reader) (*Archive, error) {
+	archive := &Archive{Nodes: []*Node{}}
+	nodes := map[string]*Node{}
+	data := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, newError(ErrBadArchive, "%v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		dir, file := path.Split(header.Name)
+		buff, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, newError(ErrBadArchive, "%s: %v", header.Name, err)
+		}
+		switch file {
+		case TarMetaFile:
+			node := &Node{}
+			if err := json.Unmarshal(buff, node); err != nil {
+				return nil, newError(ErrBadArchive, "%s: %v", header.Name, err)
+			}
+			if nodes[dir] != nil {
+				return nil, newError(ErrBadArchive, "%s is listed more than once", header.Name)
+			}
+			nodes[dir] = node
+			archive.Nodes = append(archive.Nodes, node)
+		case TarDataFile:
+			data[dir] = buff
+		default:
+			return nil, newError(ErrBadArchive, "unexpected file %s", header.Name)
+		}
+	}
+	for dir, buff := range data {
+		node := nodes[dir]
+		if node == nil {
+			return nil, newError(ErrBadArchive, "%s%s without %s", dir, TarDataFile, TarMetaFile)
+		}
+		node.Data = buff
+	}
+	if len(archive.Nodes) > 0 {
+		archive.Root = archive.Nodes[0].Path
+	}
+	return archive, nil
+}
@@ -0,0 +1,221 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/conductant/zk/pkg/client"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+)
+
+// What to do with znodes that exist with other data or ACL than in the archive
+const (
+	PolicySkip      = "skip"
+	PolicyOverwrite = "overwrite"
+	PolicyFail      = "fail"
+)
+
+// What importing does to a znode
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionSkip      = "skip"
+	ActionConflict  = "conflict"
+	ActionUnchanged = "unchanged"
+)
+
+// A change to a znode.  Data and ACL tell what differs for an existing znode, whose data and
+// ACL are in Old.  New is the znode of the archive, nil for missing parents of the root.
+type Change struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Data   bool   `json:"data,omitempty"`
+	ACL    bool   `json:"acl,omitempty"`
+	Old    *Node  `json:"old,omitempty"`
+	New    *Node  `json:"new,omitempty"`
+}
+
+// The operations of the ZooKeeper client used for importing
+type Writer interface {
+	Reader
+	Create(ctx context.Context, path string, data []byte, flags int32, acl []client.ACL) (string, error)
+	Set(ctx context.Context, path string, data []byte, version int32) (*client.Stat, error)
+	SetACL(ctx context.Context, path string, acl []client.ACL, version int32) (*client.Stat, error)
+}
+
+type ImportOptions struct {
+	// Where to recreate the root of the archive.  Its original path if empty.
+	To     string
+	Policy string
+	DryRun bool
+}
+
+// Recreates the archive, or with DryRun only works out the changes.  Missing parents of the
+// root are created empty, with an open ACL.  Returns the changes, ordered parents first.  With
+// PolicyFail nothing is changed if any znode conflicts.
+func Import(ctx context.Context, zk Writer, archive *Archive, options ImportOptions) ([]Change, error) {
+	switch options.Policy {
+	case PolicySkip, PolicyOverwrite, PolicyFail:
+	default:
+		return nil, newError(ErrBadPolicy, "%q.  Use skip, overwrite or fail", options.Policy)
+	}
+	to := options.To
+	if to == "" {
+		to = archive.Root
+	}
+	if !validPath(to) {
+		return nil, newError(ErrBadArchive, "bad path %q to import to", to)
+	}
+	if err := archive.validate(); err != nil {
+		return nil, err
+	}
+
+	changes, err := plan(ctx, zk, archive, to, options.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if options.DryRun {
+		return changes, nil
+	}
+	conflicts := []string{}
+	for _, change := range changes {
+		if change.Action == ActionConflict {
+			conflicts = append(conflicts, change.Path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return changes, newError(ErrConflict, "%s", strings.Join(conflicts, ", "))
+	}
+	for _, change := range changes {
+		if err := apply(ctx, zk, change); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// Compares the archive to the znodes at the destination.
+func plan(ctx context.Context, zk Writer, archive *Archive, to, policy string) ([]Change, error) {
+	changes := []Change{}
+
+	// Parents of the destination
+	missing := []string{}
+	for p := parent(to); to != "/" && p != "/"; p = parent(p) {
+		_, _, err := zk.Get(ctx, p)
+		if err == nil {
+			break
+		} else if err != client.ErrNoNode {
+			return nil, opError("get", p, err)
+		}
+		missing = append([]string{p}, missing...)
+	}
+	for _, p := range missing {
+		changes = append(changes, Change{Path: p, Action: ActionCreate})
+	}
+
+	for _, node := range archive.Nodes {
+		change := Change{Path: relocate(node.Path, archive.Root, to), New: node}
+		data, _, err := zk.Get(ctx, change.Path)
+		switch {
+		case err == client.ErrNoNode:
+			change.Action = ActionCreate
+			changes = append(changes, change)
+			continue
+		case err != nil:
+			return nil, opError("get", change.Path, err)
+		}
+		acl, _, err := zk.GetACL(ctx, change.Path)
+		if err != nil {
+			return nil, opError("get acl", change.Path, err)
+		}
+		change.Old = &Node{Path: change.Path, Data: data, ACL: acl}
+		change.Data = !bytes.Equal(data, node.Data)
+		change.ACL = !equalACL(acl, node.ACL)
+		switch {
+		case !change.Data && !change.ACL:
+			change.Action = ActionUnchanged
+		case policy == PolicyOverwrite:
+			change.Action = ActionUpdate
+		case policy == PolicySkip:
+			change.Action = ActionSkip
+		default:
+			change.Action = ActionConflict
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func apply(ctx context.Context, zk Writer, change Change) error {
+	node := change.New
+	if node == nil {
+		node = &Node{}
+	}
+	switch change.Action {
+	case ActionCreate:
+		acl := node.ACL
+		if len(acl) == 0 {
+			acl = client.OpenACL
+		}
+		data := node.Data
+		if data == nil {
+			data = []byte{}
+		}
+		if _, err := zk.Create(ctx, change.Path, data, 0, acl); err != nil {
+			return opError("create", change.Path, err)
+		}
+	case ActionUpdate:
+		if change.Data {
+			if _, err := zk.Set(ctx, change.Path, node.Data, client.AnyVersion); err != nil {
+				return opError("set", change.Path, err)
+			}
+		}
+		if change.ACL {
+			if _, err := zk.SetACL(ctx, change.Path, node.ACL, client.AnyVersion); err != nil {
+				return opError("set acl", change.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Path of the znode when the root is moved.
+func relocate(p, from, to string) string {
+	if from == to {
+		return p
+	}
+	if p == from {
+		return to
+	}
+	rest := p
+	if from != "/" {
+		rest = p[len(from):]
+	}
+	if to == "/" {
+		return rest
+	}
+	return to + rest
+}
+
+// ACLs are equal regardless of order.
+func equalACL(a, b []client.ACL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(acl []client.ACL) []string {
+		keys := []string{}
+		for _, entry := range acl {
+			keys = append(keys, fmt.Sprintf("%s:%s:%d", entry.Scheme, entry.Id, entry.Perms))
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	ka, kb := key(a), key(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+// Client for the Exhibitor REST API.  See https://github.com/soabase/exhibitor/wiki/REST-Introduction
+package exhibitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+
+	ApiPrefix = "/exhibitor/v1/"
+
+	PathConfigGetState           = "config/get-state"
+	PathConfigSet                = "config/set"
+	PathConfigSetRolling         = "config/set-rolling"
+	PathConfigRollbackRolling    = "config/rollback-rolling"
+	PathConfigForceCommitRolling = "config/force-commit-rolling"
+	PathClusterStatus            = "cluster/status"
+	PathClusterState             = "cluster/state"
+	PathExplorerNode             = "explorer/node"
+	PathExplorerNodeData         = "explorer/node-data"
+	PathIndexGetBackups          = "index/get-backups"
+	PathIndexRestore             = "index/restore"
+)
+
+type Client struct {
+	// Base url of the Exhibitor server, e.g. http://localhost:8080
+	Url       string
+	AuthToken string
+	Timeout   time.Duration
+
+	http *http.Client
+}
+
+func NewClient(baseUrl string) (*Client, error) {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrBadUrl
+	}
+	return &Client{
+		Url:     strings.TrimRight(baseUrl, "/"),
+		Timeout: DefaultTimeout,
+	}, nil
+}
+
+// config/get-state
+func (this *Client) GetState(ctx context.Context) (*SystemState, error) {
+	state := new(SystemState)
+	if err := this.do(ctx, "GET", PathConfigGetState, nil, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// The rolling config portion of config/get-state.
+func (this *Client) GetRollingState(ctx context.Context) (*RollingState, error) {
+	state, err := this.GetState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &state.Config.RollingState, nil
+}
+
+// config/set.  The config is the JSON document produced from the config template.
+func (this *Client) SetConfig(ctx context.Context, config []byte) error {
+	return this.post(ctx, PathConfigSet, config)
+}
+
+// config/set-rolling.  Servers are restarted one at a time with the new config.
+func (this *Client) SetConfigRolling(ctx context.Context, config []byte) error {
+	return this.post(ctx, PathConfigSetRolling, config)
+}
+
+// config/rollback-rolling.  Aborts a rolling change in progress.
+func (this *Client) RollbackRolling(ctx context.Context) error {
+	return this.post(ctx, PathConfigRollbackRolling, nil)
+}
+
+// config/force-commit-rolling.  Applies a rolling change everywhere at once.
+func (this *Client) ForceCommitRolling(ctx context.Context) error {
+	return this.post(ctx, PathConfigForceCommitRolling, nil)
+}
+
+// cluster/status
+func (this *Client) ClusterStatus(ctx context.Context) ([]ServerStatus, error) {
+	list := []ServerStatus{}
+	if err := this.do(ctx, "GET", PathClusterStatus, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// cluster/state
+func (this *Client) ServerState(ctx context.Context) (*ServerState, error) {
+	state := new(ServerState)
+	if err := this.do(ctx, "GET", PathClusterState, nil, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// explorer/node
+func (this *Client) ListNodes(ctx context.Context, path string) ([]Node, error) {
+	list := []Node{}
+	if err := this.do(ctx, "GET", PathExplorerNode+"?key="+url.QueryEscape(path), nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// explorer/node-data
+func (this *Client) NodeData(ctx context.Context, path string) (*NodeData, error) {
+	data := new(NodeData)
+	if err := this.do(ctx, "GET", PathExplorerNodeData+"?key="+url.QueryEscape(path), nil, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// index/get-backups
+func (this *Client) ListBackups(ctx context.Context) ([]Backup, error) {
+	list := []Backup{}
+	if err := this.do(ctx, "GET", PathIndexGetBackups, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// index/restore
+func (this *Client) Restore(ctx context.Context, request RestoreRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return this.post(ctx, PathIndexRestore, body)
+}
+
+// Posts and checks the ActionResult in the response.
+func (this *Client) post(ctx context.Context, path string, body []byte) error {
+	result := new(ActionResult)
+	if err := this.do(ctx, "POST", path, body, result); err != nil {
+		return err
+	}
+	if !result.Succeeded {
+		return &RejectedError{Url: this.Url + ApiPrefix + path, Message: result.Message}
+	}
+	return nil
+}
+
+func (this *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	target := this.Url + ApiPrefix + path
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	if this.AuthToken != "" {
+		req.Header.Add("Authorization", "Bearer "+this.AuthToken)
+	}
+	req.Cancel = ctx.Done()
+
+	resp, err := this.client().Do(req)
+	if err != nil {
+		if ctx.Err() != nil || isTimeout(err) {
+			return &TimeoutError{Url: target, Timeout: this.Timeout}
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Method: method, Url: target, StatusCode: resp.StatusCode, Body: string(buff)}
+	}
+	if out == nil || len(buff) == 0 {
+		return nil
+	}
+	return json.Unmarshal(buff, out)
+}
+
+func (this *Client) client() *http.Client {
+	if this.http == nil {
+		this.http = &http.Client{Timeout: this.Timeout}
+	}
+	return this.http
+}
+
+func isTimeout(err error) bool {
+	if e, is := err.(net.Error); is {
+		return e.Timeout()
+	}
+	if e, is := err.(*url.Error); is {
+		return isTimeout(e.Err)
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package exhibitor
+
+import (
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) { TestingT(t) }
+
+type TestSuiteClient struct {
+	server *httptest.Server
+	posted map[string]string
+}
+
+var _ = Suite(&TestSuiteClient{})
+
+func (suite *TestSuiteClient) SetUpSuite(c *C) {
+	suite.posted = map[string]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ApiPrefix+PathConfigGetState, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"v1.5.1","running":true,"backupActive":false,
+"config":{"rollInProgress":true,"rollStatus":"Attempting to start server 2","rollPercentDone":50,
+"hostname":"192.168.99.100","serverId":1,"serversSpec":"S:1:0.0.0.0,S:2:192.168.99.101"}}`))
+	})
+	mux.HandleFunc(ApiPrefix+PathConfigSet, func(w http.ResponseWriter, r *http.Request) {
+		buff, _ := ioutil.ReadAll(r.Body)
+		suite.posted[PathConfigSet] = string(buff)
+		w.Write([]byte(`{"message":"OK","succeeded":true}`))
+	})
+	mux.HandleFunc(ApiPrefix+PathConfigSetRolling, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"Another process has updated the config.","succeeded":false}`))
+	})
+	mux.HandleFunc(ApiPrefix+PathClusterStatus, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"hostname":"192.168.99.100","code":3,"description":"serving","isLeader":true},
+{"hostname":"192.168.99.101","code":1,"description":"down","isLeader":false}]`))
+	})
+	mux.HandleFunc(ApiPrefix+PathExplorerNode, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "/services" {
+			http.Error(w, "no such node", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"title":"a","key":"/services/a","isLazy":true}]`))
+	})
+	mux.HandleFunc(ApiPrefix+PathClusterState, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	suite.server = httptest.NewServer(mux)
+}
+
+func (suite *TestSuiteClient) TearDownSuite(c *C) {
+	suite.server.Close()
+}
+
+func (suite *TestSuiteClient) client(c *C) *Client {
+	client, err := NewClient(suite.server.URL)
+	c.Assert(err, IsNil)
+	return client
+}
+
+func (suite *TestSuiteClient) TestNewClient(c *C) {
+	_, err := NewClient("localhost:8080")
+	c.Assert(err, Equals, ErrBadUrl)
+}
+
+func (suite *TestSuiteClient) TestGetState(c *C) {
+	state, err := suite.client(c).GetState(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(state.Running, Equals, true)
+	c.Assert(state.Config.ServerId, Equals, 1)
+	c.Assert(state.Config.RollInProgress, Equals, true)
+	c.Assert(state.Config.RollPercentDone, Equals, 50)
+}
+
+func (suite *TestSuiteClient) TestSetConfig(c *C) {
+	err := suite.client(c).SetConfig(context.Background(), []byte(`{"serverId":1}`))
+	c.Assert(err, IsNil)
+	c.Assert(suite.posted[PathConfigSet], Equals, `{"serverId":1}`)
+}
+
+func (suite *TestSuiteClient) TestSetConfigRejected(c *C) {
+	err := suite.client(c).SetConfigRolling(context.Background(), []byte(`{}`))
+	rejected, is := err.(*RejectedError)
+	c.Assert(is, Equals, true)
+	c.Assert(rejected.Message, Equals, "Another process has updated the config.")
+}
+
+func (suite *TestSuiteClient) TestClusterStatus(c *C) {
+	list, err := suite.client(c).ClusterStatus(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 2)
+	c.Assert(list[0].Serving(), Equals, true)
+	c.Assert(list[0].IsLeader, Equals, true)
+	c.Assert(list[1].Serving(), Equals, false)
+}
+
+func (suite *TestSuiteClient) TestListNodes(c *C) {
+	list, err := suite.client(c).ListNodes(context.Background(), "/services")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []Node{{Title: "a", Key: "/services/a", IsLazy: true}})
+
+	_, err = suite.client(c).ListNodes(context.Background(), "/missing")
+	status, is := err.(*StatusError)
+	c.Assert(is, Equals, true)
+	c.Assert(status.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (suite *TestSuiteClient) TestTimeout(c *C) {
+	client := suite.client(c)
+	client.Timeout = 100 * time.Millisecond
+	_, err := client.ServerState(context.Background())
+	_, is := err.(*TimeoutError)
+	c.Assert(is, Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = suite.client(c).ServerState(ctx)
+	_, is = err.(*TimeoutError)
+	c.Assert(is, Equals, true)
+}
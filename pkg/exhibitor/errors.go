@@ -0,0 +1,43 @@
+package exhibitor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBadUrl = errors.New("err-bad-url")
+)
+
+// Exhibitor responded with a status other than 200.
+type StatusError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (this *StatusError) Error() string {
+	return fmt.Sprintf("err-exhibitor-status: %s %s returned %d: %s", this.Method, this.Url, this.StatusCode, this.Body)
+}
+
+// The call did not complete within the client's timeout or the context was cancelled.
+type TimeoutError struct {
+	Url     string
+	Timeout time.Duration
+}
+
+func (this *TimeoutError) Error() string {
+	return fmt.Sprintf("err-exhibitor-timeout: %s after %v", this.Url, this.Timeout)
+}
+
+// Exhibitor accepted the request but reported that it was not applied.
+type RejectedError struct {
+	Url     string
+	Message string
+}
+
+func (this *RejectedError) Error() string {
+	return fmt.Sprintf("err-exhibitor-rejected: %s: %s", this.Url, this.Message)
+}
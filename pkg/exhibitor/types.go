@@ -0,0 +1,94 @@
+package exhibitor
+
+// Instance states reported by Exhibitor for each server in the cluster.
+const (
+	StateLatent     = 0
+	StateDown       = 1
+	StateNotServing = 2
+	StateServing    = 3
+	StateUnknown    = 4
+)
+
+// Response of config/get-state.
+type SystemState struct {
+	Version              string      `json:"version"`
+	Running              bool        `json:"running"`
+	BackupActive         bool        `json:"backupActive"`
+	StandaloneMode       bool        `json:"standaloneMode"`
+	NodeMutationsAllowed bool        `json:"nodeMutationsAllowed"`
+	ExtraHeadingText     string      `json:"extraHeadingText"`
+	Config               ConfigState `json:"config"`
+}
+
+// The configuration as currently seen by Exhibitor, including the state of any rolling change.
+type ConfigState struct {
+	RollingState
+
+	Hostname                  string            `json:"hostname"`
+	ServerId                  int               `json:"serverId"`
+	ServersSpec               string            `json:"serversSpec"`
+	ZookeeperInstallDirectory string            `json:"zookeeperInstallDirectory"`
+	ZookeeperDataDirectory    string            `json:"zookeeperDataDirectory"`
+	ZooCfgExtra               map[string]string `json:"zooCfgExtra"`
+	BackupExtra               map[string]string `json:"backupExtra"`
+}
+
+// Progress of a rolling config change.
+type RollingState struct {
+	RollInProgress  bool   `json:"rollInProgress"`
+	RollStatus      string `json:"rollStatus"`
+	RollPercentDone int    `json:"rollPercentDone"`
+}
+
+// Result of calls that change state, e.g. config/set.
+type ActionResult struct {
+	Message   string `json:"message"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+// An entry of cluster/status.
+type ServerStatus struct {
+	Hostname    string `json:"hostname"`
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+	IsLeader    bool   `json:"isLeader"`
+}
+
+func (this ServerStatus) Serving() bool {
+	return this.Code == StateServing
+}
+
+// Response of cluster/state for the local server.
+type ServerState struct {
+	State       int             `json:"state"`
+	Description string          `json:"description"`
+	IsLeader    bool            `json:"isLeader"`
+	Switches    map[string]bool `json:"switches"`
+}
+
+// A child znode as listed by explorer/node.
+type Node struct {
+	Title  string `json:"title"`
+	Key    string `json:"key"`
+	IsLazy bool   `json:"isLazy"`
+}
+
+// Data of a znode as returned by explorer/node-data.
+type NodeData struct {
+	Bytes string `json:"bytes"`
+	Str   string `json:"str"`
+	Stat  string `json:"stat"`
+}
+
+// A backup as listed by index/get-backups.
+type Backup struct {
+	Name         string `json:"name"`
+	ModifiedDate int64  `json:"modifiedDate"`
+}
+
+// Request to restore a znode path from a backup.
+type RestoreRequest struct {
+	IndexName string `json:"indexName"`
+	Path      string `json:"path"`
+	Overwrite bool   `json:"overwrite"`
+}
@@ -0,0 +1,120 @@
+// Client for ZooKeeper's four letter word admin commands.
+// See https://zookeeper.apache.org/doc/r3.4.6/zookeeperAdmin.html#sc_zkCommands
+package fourletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+
+	notServing = "This ZooKeeper instance is not currently serving requests"
+)
+
+var (
+	ErrNotServing  = errors.New("err-not-serving")
+	ErrBadResponse = errors.New("err-bad-response")
+)
+
+type Client struct {
+	// host:port of the ZooKeeper client port
+	Addr    string
+	Timeout time.Duration
+}
+
+func NewClient(addr string) *Client {
+	return &Client{Addr: addr, Timeout: DefaultTimeout}
+}
+
+// Sends the four letter word and returns the raw response.
+func (this *Client) Send(word string) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", this.Addr, this.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(this.Timeout))
+	if _, err := conn.Write([]byte(word)); err != nil {
+		return nil, err
+	}
+	buff, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(buff), notServing) {
+		return nil, ErrNotServing
+	}
+	return buff, nil
+}
+
+// Returns true if the server responds imok.  This only means the server is running, not that
+// it has joined the quorum.
+func (this *Client) Ruok() (bool, error) {
+	buff, err := this.Send("ruok")
+	if err != nil {
+		return false, err
+	}
+	return string(buff) == "imok", nil
+}
+
+func (this *Client) Stat() (*Stat, error) {
+	buff, err := this.Send("stat")
+	if err != nil {
+		return nil, err
+	}
+	return ParseStat(buff)
+}
+
+func (this *Client) Srvr() (*Stat, error) {
+	buff, err := this.Send("srvr")
+	if err != nil {
+		return nil, err
+	}
+	return ParseStat(buff)
+}
+
+func (this *Client) Mntr() (*Mntr, error) {
+	buff, err := this.Send("mntr")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMntr(buff)
+}
+
+func (this *Client) Conf() (*Conf, error) {
+	buff, err := this.Send("conf")
+	if err != nil {
+		return nil, err
+	}
+	return ParseConf(buff)
+}
+
+func (this *Client) Cons() ([]Connection, error) {
+	buff, err := this.Send("cons")
+	if err != nil {
+		return nil, err
+	}
+	return ParseCons(buff)
+}
+
+func (this *Client) Envi() (Environment, error) {
+	buff, err := this.Send("envi")
+	if err != nil {
+		return nil, err
+	}
+	return ParseEnvi(buff)
+}
+
+func (this *Client) Wchs() (*Watches, error) {
+	buff, err := this.Send("wchs")
+	if err != nil {
+		return nil, err
+	}
+	return ParseWchs(buff)
+}
@@ -0,0 +1,190 @@
+package fourletter
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFourLetter(t *testing.T) { TestingT(t) }
+
+type TestSuiteFourLetter struct {
+	listener net.Listener
+}
+
+var _ = Suite(&TestSuiteFourLetter{})
+
+const (
+	statResponse = `Zookeeper version: 3.4.6-1569965, built on 02/20/2014 09:09 GMT
+Clients:
+ /127.0.0.1:54362[0](queued=0,recved=1,sent=0)
+ /10.0.0.2:40110[1](queued=0,recved=12,sent=12)
+
+Latency min/avg/max: 0/1/12
+Received: 27
+Sent: 26
+Connections: 2
+Outstanding: 0
+Zxid: 0x300000002
+Mode: follower
+Node count: 4
+`
+	mntrResponse = "zk_version\t3.4.6-1569965, built on 02/20/2014 09:09 GMT\n" +
+		"zk_avg_latency\t1\n" +
+		"zk_max_latency\t12\n" +
+		"zk_min_latency\t0\n" +
+		"zk_packets_received\t70\n" +
+		"zk_packets_sent\t69\n" +
+		"zk_num_alive_connections\t2\n" +
+		"zk_outstanding_requests\t0\n" +
+		"zk_server_state\tleader\n" +
+		"zk_znode_count\t4\n" +
+		"zk_watch_count\t1\n" +
+		"zk_ephemerals_count\t0\n" +
+		"zk_approximate_data_size\t27\n" +
+		"zk_open_file_descriptor_count\t29\n" +
+		"zk_max_file_descriptor_count\t1048576\n" +
+		"zk_followers\t2\n" +
+		"zk_synced_followers\t2\n" +
+		"zk_pending_syncs\t0\n"
+	confResponse = `clientPort=2181
+dataDir=/var/zookeeper/version-2
+dataLogDir=/var/zookeeper/version-2
+tickTime=2000
+maxClientCnxns=60
+minSessionTimeout=4000
+maxSessionTimeout=40000
+serverId=1
+initLimit=10
+syncLimit=5
+electionAlg=3
+electionPort=3888
+quorumPort=2888
+peerType=0
+`
+	consResponse = ` /127.0.0.1:54362[1](queued=0,recved=5,sent=5,sid=0x1540b5e7d2b0000,lop=PING,est=1461792839291,to=30000,lcxid=0x0,lzxid=0xffffffffffffffff,lresp=1461792840371,llat=0,minlat=0,avglat=0,maxlat=0)
+ /127.0.0.1:54363[0](queued=0,recved=1,sent=0)
+
+`
+	enviResponse = `Environment:
+zookeeper.version=3.4.6-1569965, built on 02/20/2014 09:09 GMT
+host.name=zk-1
+java.version=1.8.0_77
+`
+	wchsResponse = `1 connections watching 3 paths
+Total watches:4
+`
+)
+
+func (suite *TestSuiteFourLetter) SetUpSuite(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	suite.listener = listener
+	responses := map[string]string{
+		"ruok": "imok",
+		"srvr": statResponse,
+		"mntr": "This ZooKeeper instance is not currently serving requests\n",
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buff := make([]byte, 4)
+			if _, err := conn.Read(buff); err == nil {
+				conn.Write([]byte(responses[string(buff)]))
+			}
+			conn.Close()
+		}
+	}()
+}
+
+func (suite *TestSuiteFourLetter) TearDownSuite(c *C) {
+	suite.listener.Close()
+}
+
+func (suite *TestSuiteFourLetter) TestClient(c *C) {
+	client := NewClient(suite.listener.Addr().String())
+	client.Timeout = time.Second
+
+	ok, err := client.Ruok()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	stat, err := client.Srvr()
+	c.Assert(err, IsNil)
+	c.Assert(stat.Serving(), Equals, true)
+
+	_, err = client.Mntr()
+	c.Assert(err, Equals, ErrNotServing)
+}
+
+func (suite *TestSuiteFourLetter) TestParseStat(c *C) {
+	stat, err := ParseStat([]byte(statResponse))
+	c.Assert(err, IsNil)
+	c.Assert(stat.Version, Equals, "3.4.6-1569965, built on 02/20/2014 09:09 GMT")
+	c.Assert(stat.Clients, HasLen, 2)
+	c.Assert(stat.Latency, Equals, Latency{Min: 0, Avg: 1, Max: 12})
+	c.Assert(stat.Received, Equals, int64(27))
+	c.Assert(stat.Sent, Equals, int64(26))
+	c.Assert(stat.Connections, Equals, int64(2))
+	c.Assert(stat.Zxid, Equals, int64(0x300000002))
+	c.Assert(Epoch(stat.Zxid), Equals, int64(3))
+	c.Assert(Counter(stat.Zxid), Equals, int64(2))
+	c.Assert(stat.Mode, Equals, ModeFollower)
+	c.Assert(stat.NodeCount, Equals, int64(4))
+
+	_, err = ParseStat([]byte("garbage"))
+	c.Assert(err, Equals, ErrBadResponse)
+}
+
+func (suite *TestSuiteFourLetter) TestParseMntr(c *C) {
+	mntr, err := ParseMntr([]byte(mntrResponse))
+	c.Assert(err, IsNil)
+	c.Assert(mntr.ServerState, Equals, ModeLeader)
+	c.Assert(mntr.Latency, Equals, Latency{Min: 0, Avg: 1, Max: 12})
+	c.Assert(mntr.OutstandingRequests, Equals, int64(0))
+	c.Assert(mntr.ZnodeCount, Equals, int64(4))
+	c.Assert(mntr.WatchCount, Equals, int64(1))
+	c.Assert(mntr.OpenFileDescriptorCount, Equals, int64(29))
+	c.Assert(mntr.Followers, Equals, int64(2))
+	c.Assert(mntr.SyncedFollowers, Equals, int64(2))
+	c.Assert(mntr.Raw["zk_pending_syncs"], Equals, "0")
+}
+
+func (suite *TestSuiteFourLetter) TestParseConf(c *C) {
+	conf, err := ParseConf([]byte(confResponse))
+	c.Assert(err, IsNil)
+	c.Assert(conf.ClientPort, Equals, 2181)
+	c.Assert(conf.ServerId, Equals, 1)
+	c.Assert(conf.TickTime, Equals, 2000)
+	c.Assert(conf.QuorumPort, Equals, 2888)
+	c.Assert(conf.Raw["peerType"], Equals, "0")
+}
+
+func (suite *TestSuiteFourLetter) TestParseCons(c *C) {
+	list, err := ParseCons([]byte(consResponse))
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 2)
+	c.Assert(list[0].Addr, Equals, "127.0.0.1:54362")
+	c.Assert(list[0].Received, Equals, int64(5))
+	c.Assert(list[0].SessionId, Equals, int64(0x1540b5e7d2b0000))
+	c.Assert(list[0].Params["lop"], Equals, "PING")
+	c.Assert(list[1].Params, HasLen, 3)
+}
+
+func (suite *TestSuiteFourLetter) TestParseEnvi(c *C) {
+	env, err := ParseEnvi([]byte(enviResponse))
+	c.Assert(err, IsNil)
+	c.Assert(env["host.name"], Equals, "zk-1")
+	c.Assert(env["java.version"], Equals, "1.8.0_77")
+	c.Assert(env, HasLen, 3)
+}
+
+func (suite *TestSuiteFourLetter) TestParseWchs(c *C) {
+	watches, err := ParseWchs([]byte(wchsResponse))
+	c.Assert(err, IsNil)
+	c.Assert(*watches, Equals, Watches{Connections: 1, Paths: 3, Total: 4})
+}
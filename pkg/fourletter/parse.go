@@ -0,0 +1,371 @@
+package fourletter
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Server modes reported by stat, srvr and mntr.
+const (
+	ModeLeader     = "leader"
+	ModeFollower   = "follower"
+	ModeObserver   = "observer"
+	ModeStandalone = "standalone"
+)
+
+type Latency struct {
+	Min int64 `json:"min"`
+	Avg int64 `json:"avg"`
+	Max int64 `json:"max"`
+}
+
+// Response of stat and srvr.  Clients is only populated by stat.
+type Stat struct {
+	Version     string   `json:"version"`
+	Clients     []string `json:"clients,omitempty"`
+	Latency     Latency  `json:"latency"`
+	Received    int64    `json:"received"`
+	Sent        int64    `json:"sent"`
+	Connections int64    `json:"connections"`
+	Outstanding int64    `json:"outstanding"`
+	Zxid        int64    `json:"zxid"`
+	Mode        string   `json:"mode"`
+	NodeCount   int64    `json:"node_count"`
+}
+
+// True if the server is serving as a member of a quorum or on its own.
+func (this *Stat) Serving() bool {
+	return Serving(this.Mode)
+}
+
+func Serving(mode string) bool {
+	switch mode {
+	case ModeLeader, ModeFollower, ModeObserver, ModeStandalone:
+		return true
+	}
+	return false
+}
+
+// Epoch of the leader that produced the zxid.
+func Epoch(zxid int64) int64 {
+	return zxid >> 32
+}
+
+// Transaction counter within the epoch.
+func Counter(zxid int64) int64 {
+	return zxid & 0xffffffff
+}
+
+// Response of mntr.  Followers, SyncedFollowers and PendingSyncs are only reported by the leader.
+type Mntr struct {
+	Version                 string            `json:"version"`
+	Latency                 Latency           `json:"latency"`
+	PacketsReceived         int64             `json:"packets_received"`
+	PacketsSent             int64             `json:"packets_sent"`
+	NumAliveConnections     int64             `json:"num_alive_connections"`
+	OutstandingRequests     int64             `json:"outstanding_requests"`
+	ServerState             string            `json:"server_state"`
+	ZnodeCount              int64             `json:"znode_count"`
+	WatchCount              int64             `json:"watch_count"`
+	EphemeralsCount         int64             `json:"ephemerals_count"`
+	ApproximateDataSize     int64             `json:"approximate_data_size"`
+	OpenFileDescriptorCount int64             `json:"open_file_descriptor_count"`
+	MaxFileDescriptorCount  int64             `json:"max_file_descriptor_count"`
+	Followers               int64             `json:"followers"`
+	SyncedFollowers         int64             `json:"synced_followers"`
+	PendingSyncs            int64             `json:"pending_syncs"`
+	Raw                     map[string]string `json:"-"`
+}
+
+// Response of conf.
+type Conf struct {
+	ClientPort        int               `json:"client_port"`
+	DataDir           string            `json:"data_dir"`
+	DataLogDir        string            `json:"data_log_dir"`
+	TickTime          int               `json:"tick_time"`
+	MaxClientCnxns    int               `json:"max_client_cnxns"`
+	MinSessionTimeout int               `json:"min_session_timeout"`
+	MaxSessionTimeout int               `json:"max_session_timeout"`
+	ServerId          int               `json:"server_id"`
+	InitLimit         int               `json:"init_limit"`
+	SyncLimit         int               `json:"sync_limit"`
+	ElectionPort      int               `json:"election_port"`
+	QuorumPort        int               `json:"quorum_port"`
+	Raw               map[string]string `json:"-"`
+}
+
+// A client connection as listed by cons.
+type Connection struct {
+	Addr      string            `json:"addr"`
+	Queued    int64             `json:"queued"`
+	Received  int64             `json:"received"`
+	Sent      int64             `json:"sent"`
+	SessionId int64             `json:"session_id"`
+	Params    map[string]string `json:"params"`
+}
+
+// Response of envi.
+type Environment map[string]string
+
+// Response of wchs.
+type Watches struct {
+	Connections int64 `json:"connections"`
+	Paths       int64 `json:"paths"`
+	Total       int64 `json:"total"`
+}
+
+func ParseStat(buff []byte) (*Stat, error) {
+	stat := &Stat{}
+	inClients := false
+	found := false
+	for _, line := range lines(buff) {
+		if inClients {
+			if strings.TrimSpace(line) == "" {
+				inClients = false
+			} else {
+				stat.Clients = append(stat.Clients, strings.TrimSpace(line))
+			}
+			continue
+		}
+		key, value := split(line, ":")
+		switch key {
+		case "Zookeeper version":
+			stat.Version = value
+			found = true
+		case "Clients":
+			inClients = true
+		case "Latency min/avg/max":
+			stat.Latency = parseLatency(value)
+		case "Received":
+			stat.Received = parseInt(value)
+		case "Sent":
+			stat.Sent = parseInt(value)
+		case "Connections":
+			stat.Connections = parseInt(value)
+		case "Outstanding":
+			stat.Outstanding = parseInt(value)
+		case "Zxid":
+			stat.Zxid = parseInt(value)
+		case "Mode":
+			stat.Mode = value
+		case "Node count":
+			stat.NodeCount = parseInt(value)
+		}
+	}
+	if !found {
+		return nil, ErrBadResponse
+	}
+	return stat, nil
+}
+
+func ParseMntr(buff []byte) (*Mntr, error) {
+	mntr := &Mntr{Raw: map[string]string{}}
+	for _, line := range lines(buff) {
+		key, value := split(line, "\t")
+		if key == "" {
+			continue
+		}
+		mntr.Raw[key] = value
+		switch key {
+		case "zk_version":
+			mntr.Version = value
+		case "zk_avg_latency":
+			mntr.Latency.Avg = parseInt(value)
+		case "zk_max_latency":
+			mntr.Latency.Max = parseInt(value)
+		case "zk_min_latency":
+			mntr.Latency.Min = parseInt(value)
+		case "zk_packets_received":
+			mntr.PacketsReceived = parseInt(value)
+		case "zk_packets_sent":
+			mntr.PacketsSent = parseInt(value)
+		case "zk_num_alive_connections":
+			mntr.NumAliveConnections = parseInt(value)
+		case "zk_outstanding_requests":
+			mntr.OutstandingRequests = parseInt(value)
+		case "zk_server_state":
+			mntr.ServerState = value
+		case "zk_znode_count":
+			mntr.ZnodeCount = parseInt(value)
+		case "zk_watch_count":
+			mntr.WatchCount = parseInt(value)
+		case "zk_ephemerals_count":
+			mntr.EphemeralsCount = parseInt(value)
+		case "zk_approximate_data_size":
+			mntr.ApproximateDataSize = parseInt(value)
+		case "zk_open_file_descriptor_count":
+			mntr.OpenFileDescriptorCount = parseInt(value)
+		case "zk_max_file_descriptor_count":
+			mntr.MaxFileDescriptorCount = parseInt(value)
+		case "zk_followers":
+			mntr.Followers = parseInt(value)
+		case "zk_synced_followers":
+			mntr.SyncedFollowers = parseInt(value)
+		case "zk_pending_syncs":
+			mntr.PendingSyncs = parseInt(value)
+		}
+	}
+	if mntr.Version == "" {
+		return nil, ErrBadResponse
+	}
+	return mntr, nil
+}
+
+func ParseConf(buff []byte) (*Conf, error) {
+	conf := &Conf{Raw: map[string]string{}}
+	for _, line := range lines(buff) {
+		key, value := split(line, "=")
+		if key == "" {
+			continue
+		}
+		conf.Raw[key] = value
+		switch key {
+		case "clientPort":
+			conf.ClientPort = int(parseInt(value))
+		case "dataDir":
+			conf.DataDir = value
+		case "dataLogDir":
+			conf.DataLogDir = value
+		case "tickTime":
+			conf.TickTime = int(parseInt(value))
+		case "maxClientCnxns":
+			conf.MaxClientCnxns = int(parseInt(value))
+		case "minSessionTimeout":
+			conf.MinSessionTimeout = int(parseInt(value))
+		case "maxSessionTimeout":
+			conf.MaxSessionTimeout = int(parseInt(value))
+		case "serverId":
+			conf.ServerId = int(parseInt(value))
+		case "initLimit":
+			conf.InitLimit = int(parseInt(value))
+		case "syncLimit":
+			conf.SyncLimit = int(parseInt(value))
+		case "electionPort":
+			conf.ElectionPort = int(parseInt(value))
+		case "quorumPort":
+			conf.QuorumPort = int(parseInt(value))
+		}
+	}
+	if len(conf.Raw) == 0 {
+		return nil, ErrBadResponse
+	}
+	return conf, nil
+}
+
+// Parses lines like
+//
+//	/127.0.0.1:54362[1](queued=0,recved=5,sent=5,sid=0x1540b5e7d2b0000,lop=PING,...)
+func ParseCons(buff []byte) ([]Connection, error) {
+	list := []Connection{}
+	for _, line := range lines(buff) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		open := strings.Index(line, "(")
+		if open < 0 || !strings.HasSuffix(line, ")") {
+			return nil, ErrBadResponse
+		}
+		conn := Connection{Params: map[string]string{}}
+		conn.Addr = strings.TrimPrefix(line[:open], "/")
+		if i := strings.Index(conn.Addr, "["); i >= 0 {
+			conn.Addr = conn.Addr[:i]
+		}
+		for _, kv := range strings.Split(line[open+1:len(line)-1], ",") {
+			key, value := split(kv, "=")
+			conn.Params[key] = value
+			switch key {
+			case "queued":
+				conn.Queued = parseInt(value)
+			case "recved":
+				conn.Received = parseInt(value)
+			case "sent":
+				conn.Sent = parseInt(value)
+			case "sid":
+				conn.SessionId = parseInt(value)
+			}
+		}
+		list = append(list, conn)
+	}
+	return list, nil
+}
+
+func ParseEnvi(buff []byte) (Environment, error) {
+	env := Environment{}
+	for _, line := range lines(buff) {
+		if !strings.Contains(line, "=") {
+			continue // The Environment: heading
+		}
+		key, value := split(line, "=")
+		env[key] = value
+	}
+	if len(env) == 0 {
+		return nil, ErrBadResponse
+	}
+	return env, nil
+}
+
+// Parses
+//
+//	1 connections watching 1 paths
+//	Total watches:1
+func ParseWchs(buff []byte) (*Watches, error) {
+	watches := &Watches{}
+	found := false
+	for _, line := range lines(buff) {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 5 && fields[1] == "connections" && fields[4] == "paths":
+			watches.Connections = parseInt(fields[0])
+			watches.Paths = parseInt(fields[3])
+		case strings.HasPrefix(line, "Total watches:"):
+			watches.Total = parseInt(strings.TrimPrefix(line, "Total watches:"))
+			found = true
+		}
+	}
+	if !found {
+		return nil, ErrBadResponse
+	}
+	return watches, nil
+}
+
+func lines(buff []byte) []string {
+	list := []string{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(buff))
+	for scanner.Scan() {
+		list = append(list, scanner.Text())
+	}
+	return list
+}
+
+// Splits on the first separator and trims both sides.
+func split(line, sep string) (string, string) {
+	i := strings.Index(line, sep)
+	if i < 0 {
+		return strings.TrimSpace(line), ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+len(sep):])
+}
+
+// Parses decimal and 0x prefixed hex values.  Returns 0 if the value can't be parsed.
+func parseInt(s string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 0, 64)
+	if err != nil {
+		// Values such as lzxid=0xffffffffffffffff overflow int64
+		if u, err := strconv.ParseUint(strings.TrimSpace(s), 0, 64); err == nil {
+			return int64(u)
+		}
+		return 0
+	}
+	return v
+}
+
+func parseLatency(s string) Latency {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return Latency{}
+	}
+	return Latency{Min: parseInt(parts[0]), Avg: parseInt(parts[1]), Max: parseInt(parts[2])}
+}
@@ -0,0 +1,214 @@
+// Jute, the record serialization of ZooKeeper's client protocol and data files.  Numbers are
+// big endian, strings and buffers are prefixed with their length and vectors with their count.
+// A length of -1 is a null string, buffer or vector.
+package jute
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// Longer strings, buffers and vectors are treated as corrupt.  ZooKeeper's own limit,
+	// jute.maxbuffer, defaults to 1MB.
+	DefaultMaxLength = 16 << 20
+)
+
+var (
+	ErrBadLength = errors.New("err-bad-length")
+)
+
+// A record encodes and decodes its fields in order.
+type Record interface {
+	Encode(*Encoder)
+	Decode(*Decoder)
+}
+
+type Encoder struct {
+	buff bytes.Buffer
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (this *Encoder) WriteInt(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	this.buff.Write(b[:])
+}
+
+func (this *Encoder) WriteLong(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	this.buff.Write(b[:])
+}
+
+func (this *Encoder) WriteBool(v bool) {
+	if v {
+		this.buff.WriteByte(1)
+	} else {
+		this.buff.WriteByte(0)
+	}
+}
+
+// A nil buffer is written as null.
+func (this *Encoder) WriteBuffer(v []byte) {
+	if v == nil {
+		this.WriteInt(-1)
+		return
+	}
+	this.WriteInt(int32(len(v)))
+	this.buff.Write(v)
+}
+
+func (this *Encoder) WriteString(v string) {
+	this.WriteInt(int32(len(v)))
+	this.buff.WriteString(v)
+}
+
+// A nil slice is written as null.
+func (this *Encoder) WriteStrings(v []string) {
+	if v == nil {
+		this.WriteInt(-1)
+		return
+	}
+	this.WriteInt(int32(len(v)))
+	for _, s := range v {
+		this.WriteString(s)
+	}
+}
+
+func (this *Encoder) WriteRecord(r Record) {
+	r.Encode(this)
+}
+
+func (this *Encoder) Len() int {
+	return this.buff.Len()
+}
+
+func (this *Encoder) Bytes() []byte {
+	return this.buff.Bytes()
+}
+
+// Reads records from a stream.  The first error is kept and returned by Err; reads after it
+// return zero values.
+type Decoder struct {
+	MaxLength int
+
+	reader io.Reader
+	err    error
+	b      [8]byte
+}
+
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{MaxLength: DefaultMaxLength, reader: reader}
+}
+
+func (this *Decoder) read(n int) []byte {
+	if this.err != nil {
+		return nil
+	}
+	if _, err := io.ReadFull(this.reader, this.b[:n]); err != nil {
+		this.err = err
+		return nil
+	}
+	return this.b[:n]
+}
+
+func (this *Decoder) ReadInt() int32 {
+	if b := this.read(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (this *Decoder) ReadLong() int64 {
+	if b := this.read(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (this *Decoder) ReadBool() bool {
+	if b := this.read(1); b != nil {
+		return b[0] != 0
+	}
+	return false
+}
+
+// Reads the length of a string, buffer or vector.  Returns -1 for null.
+func (this *Decoder) ReadLength() int {
+	n := this.ReadInt()
+	if this.err != nil {
+		return -1
+	}
+	if n < -1 || int(n) > this.MaxLength {
+		this.err = ErrBadLength
+		return -1
+	}
+	return int(n)
+}
+
+// Returns nil for a null buffer.
+func (this *Decoder) ReadBuffer() []byte {
+	n := this.ReadLength()
+	if n < 0 {
+		return nil
+	}
+	v := make([]byte, n)
+	if _, err := io.ReadFull(this.reader, v); err != nil {
+		this.err = err
+		return nil
+	}
+	return v
+}
+
+func (this *Decoder) ReadString() string {
+	return string(this.ReadBuffer())
+}
+
+// Returns nil for a null vector.
+func (this *Decoder) ReadStrings() []string {
+	n := this.ReadLength()
+	if n < 0 {
+		return nil
+	}
+	v := []string{}
+	for i := 0; i < n && this.err == nil; i++ {
+		v = append(v, this.ReadString())
+	}
+	return v
+}
+
+func (this *Decoder) ReadRecord(r Record) {
+	r.Decode(this)
+}
+
+// The first error.  io.EOF if the stream ended before a value, io.ErrUnexpectedEOF if it ended
+// in the middle of one.
+func (this *Decoder) Err() error {
+	return this.err
+}
+
+func Marshal(records ...Record) []byte {
+	encoder := NewEncoder()
+	for _, r := range records {
+		r.Encode(encoder)
+	}
+	return encoder.Bytes()
+}
+
+// Decodes the records in order.  Bytes after the last record are ignored.
+func Unmarshal(buff []byte, records ...Record) error {
+	decoder := NewDecoder(bytes.NewReader(buff))
+	for _, r := range records {
+		r.Decode(decoder)
+	}
+	if decoder.Err() == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return decoder.Err()
+}
@@ -0,0 +1,100 @@
+package jute
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+	"io"
+	"testing"
+)
+
+func TestJute(t *testing.T) { TestingT(t) }
+
+type TestSuiteJute struct {
+}
+
+var _ = Suite(&TestSuiteJute{})
+
+func (suite *TestSuiteJute) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteJute) TearDownSuite(c *C) {
+}
+
+type testRecord struct {
+	i int32
+	l int64
+	b bool
+	s string
+	d []byte
+	v []string
+}
+
+func (this *testRecord) Encode(e *Encoder) {
+	e.WriteInt(this.i)
+	e.WriteLong(this.l)
+	e.WriteBool(this.b)
+	e.WriteString(this.s)
+	e.WriteBuffer(this.d)
+	e.WriteStrings(this.v)
+}
+
+func (this *testRecord) Decode(d *Decoder) {
+	this.i = d.ReadInt()
+	this.l = d.ReadLong()
+	this.b = d.ReadBool()
+	this.s = d.ReadString()
+	this.d = d.ReadBuffer()
+	this.v = d.ReadStrings()
+}
+
+func (suite *TestSuiteJute) TestEncoding(c *C) {
+	r := &testRecord{i: -2, l: 0x100000002, b: true, s: "/zk", d: []byte{0xff}, v: []string{"a", ""}}
+	buff := Marshal(r)
+	c.Assert(buff, DeepEquals, []byte{
+		0xff, 0xff, 0xff, 0xfe,
+		0, 0, 0, 1, 0, 0, 0, 2,
+		1,
+		0, 0, 0, 3, '/', 'z', 'k',
+		0, 0, 0, 1, 0xff,
+		0, 0, 0, 2, 0, 0, 0, 1, 'a', 0, 0, 0, 0,
+	})
+
+	decoded := &testRecord{}
+	c.Assert(Unmarshal(buff, decoded), IsNil)
+	c.Assert(decoded, DeepEquals, r)
+}
+
+func (suite *TestSuiteJute) TestNull(c *C) {
+	buff := Marshal(&testRecord{})
+	c.Assert(buff[len(buff)-8:], DeepEquals, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	decoded := &testRecord{d: []byte{}, v: []string{}}
+	c.Assert(Unmarshal(buff, decoded), IsNil)
+	c.Assert(decoded.d, IsNil)
+	c.Assert(decoded.v, IsNil)
+}
+
+func (suite *TestSuiteJute) TestTruncated(c *C) {
+	buff := Marshal(&testRecord{s: "hello"})
+	c.Assert(Unmarshal(buff[:20], &testRecord{}), Equals, io.ErrUnexpectedEOF)
+	c.Assert(Unmarshal(nil, &testRecord{}), Equals, io.ErrUnexpectedEOF)
+
+	decoder := NewDecoder(bytes.NewReader(nil))
+	decoder.ReadInt()
+	c.Assert(decoder.Err(), Equals, io.EOF)
+}
+
+func (suite *TestSuiteJute) TestBadLength(c *C) {
+	encoder := NewEncoder()
+	encoder.WriteInt(-2)
+	decoder := NewDecoder(bytes.NewReader(encoder.Bytes()))
+	c.Assert(decoder.ReadBuffer(), IsNil)
+	c.Assert(decoder.Err(), Equals, ErrBadLength)
+
+	encoder = NewEncoder()
+	encoder.WriteString("too long")
+	decoder = NewDecoder(bytes.NewReader(encoder.Bytes()))
+	decoder.MaxLength = 4
+	decoder.ReadString()
+	c.Assert(decoder.Err(), Equals, ErrBadLength)
+}
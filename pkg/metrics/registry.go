@@ -0,0 +1,108 @@
+// Minimal Prometheus exporter.  Metrics are read from functions at scrape time and written
+// in the text exposition format.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+
+	ContentType = "text/plain; version=0.0.4"
+)
+
+// Returns the current value, or false if there is nothing to report.
+type ValueFunc func() (float64, bool)
+
+type Metric struct {
+	Name  string
+	Help  string
+	Type  string
+	Value ValueFunc
+}
+
+type Registry struct {
+	metrics []*Metric
+	lock    sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (this *Registry) Add(metric *Metric) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.metrics = append(this.metrics, metric)
+}
+
+func (this *Registry) Counter(name, help string, value ValueFunc) {
+	this.Add(&Metric{Name: name, Help: help, Type: TypeCounter, Value: value})
+}
+
+func (this *Registry) Gauge(name, help string, value ValueFunc) {
+	this.Add(&Metric{Name: name, Help: help, Type: TypeGauge, Value: value})
+}
+
+// Writes all metrics with a value, in the order they were added.
+func (this *Registry) WriteTo(w io.Writer) (int64, error) {
+	this.lock.Lock()
+	metrics := append([]*Metric{}, this.metrics...)
+	this.lock.Unlock()
+
+	buff := new(bytes.Buffer)
+	for _, m := range metrics {
+		v, ok := m.Value()
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(buff, "# HELP %s %s\n", m.Name, escapeHelp(m.Help))
+		fmt.Fprintf(buff, "# TYPE %s %s\n", m.Name, m.Type)
+		fmt.Fprintf(buff, "%s %s\n", m.Name, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return buff.WriteTo(w)
+}
+
+func (this *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	this.WriteTo(w)
+}
+
+func escapeHelp(s string) string {
+	return strings.Replace(strings.Replace(s, `\`, `\\`, -1), "\n", `\n`, -1)
+}
+
+// Monotonic counter that's safe to share between goroutines.
+type Counter struct {
+	value int64
+}
+
+func (this *Counter) Inc() {
+	atomic.AddInt64(&this.value, 1)
+}
+
+func (this *Counter) Get() int64 {
+	return atomic.LoadInt64(&this.value)
+}
+
+// ValueFunc for the counter.
+func (this *Counter) Value() (float64, bool) {
+	return float64(this.Get()), true
+}
+
+// ValueFunc that always reports the integer.
+func Int(f func() int) ValueFunc {
+	return func() (float64, bool) {
+		return float64(f()), true
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) { TestingT(t) }
+
+type TestSuiteMetrics struct {
+}
+
+var _ = Suite(&TestSuiteMetrics{})
+
+func (suite *TestSuiteMetrics) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteMetrics) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteMetrics) TestWrite(c *C) {
+	counter := new(Counter)
+	counter.Inc()
+	counter.Inc()
+
+	registry := NewRegistry()
+	registry.Counter("zk_restarts_total", "Restarts of\nthe child", counter.Value)
+	registry.Gauge("zk_avg_latency", "Average latency", func() (float64, bool) { return 1.5, true })
+	registry.Gauge("zk_missing", "Not reported", func() (float64, bool) { return 0, false })
+	registry.Gauge("zk_followers", "Followers", Int(func() int { return 2 }))
+
+	buff := new(bytes.Buffer)
+	_, err := registry.WriteTo(buff)
+	c.Assert(err, IsNil)
+	c.Assert(buff.String(), Equals, `# HELP zk_restarts_total Restarts of\nthe child
+# TYPE zk_restarts_total counter
+zk_restarts_total 2
+# HELP zk_avg_latency Average latency
+# TYPE zk_avg_latency gauge
+zk_avg_latency 1.5
+# HELP zk_followers Followers
+# TYPE zk_followers gauge
+zk_followers 2
+`)
+}
+
+func (suite *TestSuiteMetrics) TestServeHTTP(c *C) {
+	registry := NewRegistry()
+	registry.Gauge("zk_up", "Up", Int(func() int { return 1 }))
+
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, ContentType)
+	c.Assert(w.Body.String(), Matches, "(?s).*zk_up 1\n")
+}
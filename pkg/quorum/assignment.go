@@ -0,0 +1,79 @@
+package quorum
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Written next to the myid file
+	AssignmentFileName = "ensemble.json"
+)
+
+// Server ids of the ensemble as of the last start.
+type Assignment struct {
+	Self    string         `json:"self"`
+	MyId    int            `json:"myid"`
+	Servers map[string]int `json:"servers"`
+}
+
+func (this *Config) assignmentPath() string {
+	return filepath.Join(filepath.Dir(this.MyIdPath), AssignmentFileName)
+}
+
+func (this *Config) assignment(myid int) *Assignment {
+	a := &Assignment{Self: this.self.Ip, MyId: myid, Servers: map[string]int{}}
+	for _, s := range this.ensemble {
+		a.Servers[s.Ip] = s.Id
+	}
+	return a
+}
+
+// Compares the computed id of this host with the one in an existing myid file and with the
+// last persisted assignment, then persists the current assignment.  A different id means the
+// data directory belongs to another server, so it's an error.  Other members whose ids changed
+// are only logged.
+func (this *Config) CheckAssignment() error {
+	myid, err := this.GetMyId()
+	if err != nil {
+		return err
+	}
+
+	if buff, err := ioutil.ReadFile(this.MyIdPath); err == nil {
+		if v, err := strconv.Atoi(strings.TrimSpace(string(buff))); err == nil && v != myid {
+			return newError(ErrMyIdChanged, "%s has %d but this host is now %d", this.MyIdPath, v, myid)
+		}
+	}
+
+	path := this.assignmentPath()
+	if buff, err := ioutil.ReadFile(path); err == nil {
+		prev := new(Assignment)
+		if err := json.Unmarshal(buff, prev); err != nil {
+			return newError(ErrBadAssignment, "%s: %v", path, err)
+		}
+		if prev.MyId != myid {
+			return newError(ErrMyIdChanged, "%s assigned %d to %s but this host is now %d",
+				path, prev.MyId, prev.Self, myid)
+		}
+		for host, id := range prev.Servers {
+			for _, s := range this.ensemble {
+				if s.Ip == host && s.Id != id {
+					log.Warn("Server id of ", host, " changed from ", id, " to ", s.Id)
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	buff, err := json.MarshalIndent(this.assignment(myid), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buff, 0644)
+}
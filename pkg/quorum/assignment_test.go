@@ -0,0 +1,99 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type TestSuiteAssignment struct {
+}
+
+var _ = Suite(&TestSuiteAssignment{})
+
+func (suite *TestSuiteAssignment) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteAssignment) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteAssignment) TestExplicitIds(c *C) {
+	config := &Config{
+		Servers:   []HostPort{"3@10.0.0.5", "1@10.0.0.9:2182", "2@10.0.0.10"},
+		Observers: []HostPort{"4@10.0.0.2"},
+		Hostname:  "10.0.0.5",
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 3)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.9,S:2:10.0.0.10,S:3:0.0.0.0,O:4:10.0.0.2")
+
+	// Adding a host that sorts first doesn't renumber anyone.
+	config.Servers = append(config.Servers, "5@10.0.0.1")
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 3)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.9,S:2:10.0.0.10,S:3:0.0.0.0,O:4:10.0.0.2,S:5:10.0.0.1")
+}
+
+func (suite *TestSuiteAssignment) TestMixedIds(c *C) {
+	config := &Config{
+		Servers:  []HostPort{"10.0.0.3", "2@10.0.0.1", "10.0.0.2", "10.0.0.4"},
+		Hostname: "10.0.0.4",
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 4)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.2,S:2:10.0.0.1,S:3:10.0.0.3,S:4:0.0.0.0")
+}
+
+func (suite *TestSuiteAssignment) TestBadIds(c *C) {
+	for _, servers := range [][]HostPort{
+		{"x@10.0.0.1"},
+		{"0@10.0.0.1"},
+		{"256@10.0.0.1"},
+		{"1@10.0.0.1", "1@10.0.0.2"},
+		{"1@10.0.0.1", "2@10.0.0.1"},
+	} {
+		config := &Config{Servers: servers}
+		c.Assert(config.InitEnsemble(), NotNil, Commentf("%v", servers))
+	}
+}
+
+func (suite *TestSuiteAssignment) TestPersisted(c *C) {
+	dir := c.MkDir()
+	config := &Config{
+		Servers:  []HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		Hostname: "10.0.0.2",
+		MyIdPath: filepath.Join(dir, "myid"),
+	}
+	c.Assert(config.Init(), IsNil)
+	config.Close()
+	c.Assert(myId(c, config), Equals, 2)
+
+	buff, err := ioutil.ReadFile(filepath.Join(dir, AssignmentFileName))
+	c.Assert(err, IsNil)
+	c.Assert(string(buff), Matches, `(?s).*"myid": 2.*`)
+
+	// Same ids with a new member added with an explicit id
+	config.Servers = append(config.Servers, "4@10.0.0.0")
+	c.Assert(config.Init(), IsNil)
+	config.Close()
+
+	// A new member that sorts first would renumber this host
+	config.Servers = []HostPort{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	err = config.Init()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, "err-myid-changed:.* has 2 but this host is now 3")
+}
+
+func (suite *TestSuiteAssignment) TestPersistedAssignmentOnly(c *C) {
+	dir := c.MkDir()
+	config := &Config{
+		Servers:  []HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		Hostname: "10.0.0.2",
+		MyIdPath: filepath.Join(dir, "myid"),
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, AssignmentFileName),
+		[]byte(`{"self":"10.0.0.2","myid":1,"servers":{"10.0.0.2":1}}`), 0644), IsNil)
+	err := config.Init()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, "err-myid-changed:.* assigned 1 to 10.0.0.2 but this host is now 2")
+}
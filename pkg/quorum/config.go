@@ -1,15 +1,26 @@
 package quorum
 
 import (
-	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/conductant/gohm/pkg/conf"
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/datadir"
+	"github.com/conductant/zk/pkg/discovery"
+	"golang.org/x/net/context"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	MyIdFilePath = "/var/zookeeper/myid"
+
+	ModeExhibitor = "exhibitor"
+	ModeNative    = "native"
 )
 
 type HostPort string
@@ -18,41 +29,233 @@ type Config struct {
 	conf.Conf `json:"-" yaml:"-"`
 	Exhibitor
 
-	Servers   []HostPort `json:"servers" yaml:"servers" flag:"S, Quorum members of <host>:<port>"`
-	Observers []HostPort `json:"observers" yaml:"observers" flag:"O, Quorum observers of <host>:<port>"`
+	Mode   string    `json:"mode" yaml:"mode" flag:"mode, Bootstrap mode: exhibitor or native"`
+	Native ZooKeeper `json:"native" yaml:"native" flag:"native, Native ZooKeeper settings"`
+
+	Kubernetes Kubernetes `json:"kubernetes" yaml:"kubernetes" flag:"k8s, Identity from a Kubernetes StatefulSet"`
+
+	Supervisor Supervisor `json:"supervisor" yaml:"supervisor" flag:"supervisor, Child process supervision"`
+
+	ShutdownGracePeriod time.Duration `json:"shutdown_grace_period" yaml:"shutdown_grace_period" flag:"shutdown_grace, Time to wait for ZooKeeper to exit before killing it"`
+
+	Servers   []HostPort `json:"servers" yaml:"servers" flag:"S, Quorum members of [<id>@]<host>[:<client port>[:<quorum port>:<election port>]]"`
+	Observers []HostPort `json:"observers" yaml:"observers" flag:"O, Quorum observers of [<id>@]<host>[:<client port>[:<quorum port>:<election port>]]"`
+
+	Discover         string        `json:"discover" yaml:"discover" flag:"discover, Resolve quorum members from dns://<SRV name> or <host>[:<port>] A records"`
+	DiscoverSize     int           `json:"discover_size" yaml:"discover_size" flag:"expect, Number of members to wait for when discovering"`
+	DiscoverTimeout  time.Duration `json:"discover_timeout" yaml:"discover_timeout" flag:"discover_timeout, Time to wait for the expected members to resolve"`
+	DiscoverInterval time.Duration `json:"discover_interval" yaml:"discover_interval" flag:"discover_interval, Time between DNS lookups while discovering"`
 
-	Hostname string `flag:"ip, This host's name or ip address"`
+	Hostname string `flag:"ip, This host's name or ip address.  Detected from the network interfaces if not set"`
 	MyIdPath string `flag:"myid_path, MyId location"`
 
+	DataCheck string `json:"data_check" yaml:"data_check" flag:"data_check, Before starting check the data directory and quarantine a torn log tail (repair) or refuse to start (strict) or skip the check (off)"`
+
+	Metadata        string        `json:"metadata" yaml:"metadata" flag:"metadata, Also ask the ec2 or gce metadata service for this host's addresses when -ip is not set"`
+	MetadataTimeout time.Duration `json:"metadata_timeout" yaml:"metadata_timeout" flag:"metadata_timeout, Timeout of metadata requests"`
+
+	ConfigHosts     string        `json:"config_hosts" yaml:"config_hosts" flag:"config_hosts, Write members into generated configs as given (names) or as their addresses (ips)"`
+	ResolveInterval time.Duration `json:"resolve_interval" yaml:"resolve_interval" flag:"resolve_interval, How often to check if the addresses of members changed.  0 to disable"`
+
+	Seed        string        `json:"seed" yaml:"seed" flag:"seed, Url of a YAML or JSON tree of znodes to create once the ensemble has quorum"`
+	SeedAuth    string        `json:"seed_auth" yaml:"seed_auth" flag:"seed_auth, user:password to seed as with the digest scheme"`
+	SeedTimeout time.Duration `json:"seed_timeout" yaml:"seed_timeout" flag:"seed_timeout, Time to wait for quorum and the seed lock before giving up seeding"`
+
+	HealthAddr      string        `json:"health_addr" yaml:"health_addr" flag:"http, Address to serve /healthz /readyz /status and /metrics on.  Empty to disable"`
+	MetricsInterval time.Duration `json:"metrics_interval" yaml:"metrics_interval" flag:"metrics_interval, How often to scrape ZooKeeper's mntr for /metrics"`
+
 	self     *Server
 	ensemble []*Server // de-duped, sorted
 	myid     *MyIdFile
+	draining int32
+	recent   recentErrors
+	mntr     mntrScrape
+	resolver discovery.Resolver
+	members  []*Server // generated, with ids
+	resolved resolvedHosts
+
+	localAddrs func() ([]string, error)
+	metadata   MetadataProvider
 }
 
 type Server struct {
-	Ip       string
-	Port     int
-	Observer bool
+	Id       int    `json:"id"` // 0 until numbered by position in the ensemble
+	Ip       string `json:"ip"`
+	Observer bool   `json:"observer"`
+
+	// Ports, 0 for the defaults
+	Port         int `json:"port,omitempty"`
+	QuorumPort   int `json:"quorum_port,omitempty"`
+	ElectionPort int `json:"election_port,omitempty"`
+}
+
+// host:port for ZooKeeper clients.
+func (this *Server) ClientAddr() string {
+	return net.JoinHostPort(this.Ip, strconv.Itoa(orDefault(this.Port, DefaultZkClientPort)))
+}
+
+func (this *Server) GetQuorumPort() int {
+	return orDefault(this.QuorumPort, DefaultZkQuorumPort)
+}
+
+func (this *Server) GetElectionPort() int {
+	return orDefault(this.ElectionPort, DefaultZkElectionPort)
+}
+
+func orDefault(port, def int) int {
+	if port > 0 {
+		return port
+	}
+	return def
 }
 
 func (this *Config) Close() error {
+	if this.myid == nil {
+		return nil
+	}
 	return this.myid.Close()
 }
 
 func (this *Config) Init() error {
+	if err := this.prepare(true); err != nil {
+		return err
+	}
+	if _, err := this.GetMyId(); err != nil {
+		return err
+	}
+
+	problems := this.check()
+	problems.Log()
+	if err := problems.Err(); err != nil {
+		return err
+	}
+
+	if err := this.CheckAssignment(); err != nil {
+		return err
+	}
+
+	// MyId
+	myid, err := this.GetMyId()
+	if err != nil {
+		return err
+	}
+	this.myid = &MyIdFile{
+		Path:  this.MyIdPath,
+		Value: myid,
+	}
+
+	if err := this.myid.EnsureState(); err != nil {
+		return err
+	}
+	log.Info("MyID file ready")
+
+	return nil
+}
+
+// Builds the ensemble from the settings, discovery or the StatefulSet.  This host is detected
+// from its addresses if detect is set and no Hostname is given.
+func (this *Config) prepare(detect bool) error {
+	switch this.Mode {
+	case "":
+		this.Mode = ModeExhibitor
+	case ModeExhibitor, ModeNative:
+	default:
+		return newError(ErrBadMode, "%s", this.Mode)
+	}
+	// ZooKeeper reads myid from its data directory.
+	if this.Mode == ModeNative && (this.MyIdPath == "" || this.MyIdPath == MyIdFilePath) && this.Native.DataDirectory != "" {
+		this.MyIdPath = filepath.Join(this.Native.DataDirectory, datadir.MyIdFile)
+	}
+	switch this.ConfigHosts {
+	case "":
+		this.ConfigHosts = ConfigHostsNames
+	case ConfigHostsNames, ConfigHostsIps:
+	default:
+		return newError(ErrBadConfigHosts, "%s", this.ConfigHosts)
+	}
+
+	if err := this.Kubernetes.fromEnv(); err != nil {
+		return err
+	}
+	if this.Kubernetes.Enabled() {
+		self, members, err := this.Kubernetes.Members()
+		if err != nil {
+			return err
+		}
+		if this.Hostname != "" && this.Hostname != self {
+			log.Warn("Using ", self, " from the StatefulSet instead of ", this.Hostname)
+		}
+		this.Hostname = self
+		this.members = members
+	}
+
+	if this.Discover != "" {
+		ctx := context.Background()
+		if this.DiscoverTimeout > 0 {
+			c, cancel := context.WithTimeout(ctx, this.DiscoverTimeout)
+			defer cancel()
+			ctx = c
+		}
+		if err := this.DiscoverServers(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := this.InitEnsemble(); err != nil {
+		return err
+	}
+
+	if this.Hostname == "" && detect {
+		if this.Metadata != "" && this.metadata == nil {
+			provider, err := NewMetadataProvider(this.Metadata)
+			if err != nil {
+				return err
+			}
+			this.metadata = provider
+		}
+		if err := this.DetectSelf(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Builds the de-duped, sorted ensemble from the servers and observers.  This is all that's
+// needed to look at the ensemble from outside, without being a member.
+func (this *Config) InitEnsemble() error {
 	all := map[string]*Server{}
+	add := func(s *Server) error {
+		if prev, has := all[s.Ip]; has && s.Id == 0 {
+			s.Id = prev.Id
+		} else if has && prev.Id > 0 && prev.Id != s.Id {
+			return newError(ErrConflictingIds, "%s has ids %d and %d", s.Ip, prev.Id, s.Id)
+		}
+		all[s.Ip] = s
+		return nil
+	}
 	for _, hp := range this.Observers {
-		if s, err := hp.toServer(); err == nil {
-			s.Observer = true
-			all[s.Ip] = s
-		} else {
+		s, err := hp.toServer()
+		if err != nil {
+			err.(*BadHostPortError).Flag = "O"
+			return err
+		}
+		s.Observer = true
+		if err := add(s); err != nil {
 			return err
 		}
 	}
 	for _, hp := range this.Servers {
-		if s, err := hp.toServer(); err == nil {
-			all[s.Ip] = s
-		} else {
+		s, err := hp.toServer()
+		if err != nil {
+			err.(*BadHostPortError).Flag = "S"
+			return err
+		}
+		if err := add(s); err != nil {
+			return err
+		}
+	}
+	for _, s := range this.members {
+		if err := add(s); err != nil {
 			return err
 		}
 	}
@@ -62,25 +265,107 @@ func (this *Config) Init() error {
 		sorter.Add(s)
 	}
 	sorter.Sort()
+	hosts := map[int]string{}
+	for _, s := range sorter.servers {
+		if s.Id == 0 {
+			continue
+		}
+		if other, has := hosts[s.Id]; has {
+			return newError(ErrDuplicateId, "%d is used by %s and %s", s.Id, other, s.Ip)
+		}
+		hosts[s.Id] = s.Ip
+	}
+	// Servers without an explicit id are numbered in sorted order with the ids left over.
+	next := 1
+	for _, s := range sorter.servers {
+		if s.Id > 0 {
+			continue
+		}
+		for hosts[next] != "" {
+			next++
+		}
+		s.Id = next
+		hosts[next] = s.Ip
+	}
+	sort.Sort(byId(sorter.servers))
 	this.ensemble = sorter.servers
-	this.self = &Server{Ip: this.Hostname}
-
-	// MyId
-	this.myid = &MyIdFile{
-		Path:  this.MyIdPath,
-		Value: this.GetMyId(),
+	this.self = &Server{Ip: canonicalHost(this.Hostname)}
+	if this.Hostname != "" {
+		s, err := this.findSelf()
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			this.self = &Server{Ip: s.Ip}
+		}
 	}
+	return nil
+}
 
-	if err := this.myid.EnsureState(); err != nil {
-		return err
+func (this *Config) GenerateConfig() ([]byte, error) {
+	// Exhibitor uses the same ports on every member.
+	for _, s := range this.ensemble {
+		if s.GetQuorumPort() != this.GetQuorumPort() || s.GetElectionPort() != this.GetElectionPort() {
+			log.Warn("Exhibitor uses this host's quorum and election ports for all members, not the ports of ", s.Ip)
+		}
 	}
-	log.Info("MyID file ready")
+	return this.Exhibitor.GenerateConfig(this, this.templateFuncs())
+}
 
+// Starts the child process for the configured mode under supervision.
+func (this *Config) Start() error {
+	if this.ShuttingDown() {
+		return ErrShuttingDown
+	}
+	if this.Mode == ModeNative {
+		this.Native.zkAddr = this.LocalZkAddr()
+		if err := this.Native.Start(&this.Supervisor); err != nil {
+			return err
+		}
+		this.collectEvents("zookeeper", this.Native.Events(context.Background()))
+	} else {
+		this.Exhibitor.zkAddr = this.LocalZkAddr()
+		if err := this.Exhibitor.Start(&this.Supervisor); err != nil {
+			return err
+		}
+		this.collectEvents("exhibitor", this.Exhibitor.Events(context.Background()))
+	}
+	if this.myid != nil {
+		this.collectErrors("myid", this.myid.Error)
+	}
+	this.scrapeMntr()
+	this.watchAddresses()
 	return nil
 }
 
-func (this *Config) GenerateConfig() ([]byte, error) {
-	return this.Exhibitor.GenerateConfig(this, this.templateFuncs())
+// Blocks until the local ZooKeeper serves clients.  See ZooKeeper.WaitZkRunning and
+// Exhibitor.WaitZkRunning.
+func (this *Config) WaitZkRunning(ctx context.Context) error {
+	if this.Mode == ModeNative {
+		return this.Native.WaitZkRunning(ctx)
+	}
+	return this.Exhibitor.WaitZkRunning(ctx)
+}
+
+// State changes of the child process of the mode until the context is done or it stops.
+func (this *Config) Events(ctx context.Context) <-chan StateChange {
+	if this.Mode == ModeNative {
+		return this.Native.Events(ctx)
+	}
+	return this.Exhibitor.Events(ctx)
+}
+
+// State of the child process of the mode and the last probe error.
+func (this *Config) State() (State, error) {
+	if this.Mode == ModeNative {
+		return this.Native.State()
+	}
+	return this.Exhibitor.State()
+}
+
+// Generates the zoo.cfg used when running ZooKeeper directly.
+func (this *Config) GenerateZooCfg() ([]byte, error) {
+	return this.Native.GenerateConfig(this, this.templateFuncs())
 }
 
 func (this *Config) templateFuncs() map[string]interface{} {
@@ -94,38 +379,131 @@ func (this *Config) templateFuncs() map[string]interface{} {
 		"zk_default_template": func() string {
 			return DefaultZkExhibitorConfigTemplate
 		},
-		"server_id": func() string {
-			return fmt.Sprintf("%d", this.GetMyId())
+		"apply_all_at_once": func() string {
+			if this.Rolling {
+				return "0"
+			}
+			return "1"
+		},
+		"server_id": func() (string, error) {
+			myid, err := this.GetMyId()
+			return fmt.Sprintf("%d", myid), err
+		},
+		"zk_servers": func() string {
+			return this.GetZkServers()
+		},
+		"client_port": func() string {
+			return fmt.Sprintf("%d", this.GetClientPort())
+		},
+		"quorum_port": func() string {
+			return fmt.Sprintf("%d", this.GetQuorumPort())
+		},
+		"election_port": func() string {
+			return fmt.Sprintf("%d", this.GetElectionPort())
+		},
+		"peer_type": func() string {
+			if s := this.selfServer(); s != nil && s.Observer {
+				return "observer"
+			}
+			return "participant"
 		},
 	}
 }
 
-func (this *Config) GetMyId() int {
-	for id, s := range this.ensemble {
+// Server id of this host.  Returns ErrSelfNotInEnsemble if this host isn't a member.
+func (this *Config) GetMyId() (int, error) {
+	if s := this.selfServer(); s != nil {
+		return s.Id, nil
+	}
+	return 0, newError(ErrSelfNotInEnsemble, "%s", this.Hostname)
+}
+
+func (this *Config) selfServer() *Server {
+	for _, s := range this.ensemble {
 		if this.self.Ip == s.Ip {
-			return id + 1
+			return s
 		}
 	}
-	panic(errors.New("err-cannot-determine-myid"))
+	return nil
+}
+
+// Port this host's ZooKeeper listens on for clients.
+func (this *Config) GetClientPort() int {
+	if s := this.selfServer(); s != nil && s.Port > 0 {
+		return s.Port
+	}
+	if this.Native.ClientPort > 0 {
+		return this.Native.ClientPort
+	}
+	return DefaultZkClientPort
+}
+
+// Port this host's ZooKeeper listens on for followers.
+func (this *Config) GetQuorumPort() int {
+	if s := this.selfServer(); s != nil {
+		return s.GetQuorumPort()
+	}
+	return DefaultZkQuorumPort
+}
+
+// Port this host's ZooKeeper listens on for leader election.
+func (this *Config) GetElectionPort() int {
+	if s := this.selfServer(); s != nil {
+		return s.GetElectionPort()
+	}
+	return DefaultZkElectionPort
+}
+
+// Host of the server as written in generated configs.  This host binds to all interfaces.  The
+// JVM listens on IPv6 too when bound to 0.0.0.0, unless java.net.preferIPv4Stack is set.
+func (this *Config) specHost(s *Server) string {
+	if this.self.Ip == s.Ip {
+		return "0.0.0.0"
+	}
+	return this.configHost(s)
+}
+
+// Address of this host's ZooKeeper client port, for local probing.
+func (this *Config) LocalZkAddr() string {
+	loopback := "127.0.0.1"
+	addrs := this.resolved.get(this.self.Ip)
+	if isIPv6(this.self.Ip) || len(addrs) > 0 && isIPv6(addrs[0]) {
+		loopback = "::1"
+	}
+	return net.JoinHostPort(loopback, strconv.Itoa(this.GetClientPort()))
+}
+
+// Members of the ensemble, sorted by id.  Empty until the ensemble is initialized.
+func (this *Config) Ensemble() []*Server {
+	return this.ensemble
 }
 
 // Generates the quorum server list
 func (this *Config) GetZkServersSpec() string {
 	list := []string{}
-	for id, s := range this.ensemble {
+	for _, s := range this.ensemble {
 		serverType := "S"
 		if s.Observer {
 			serverType = "O"
 		}
-		host := s.Ip
-		if this.self.Ip == s.Ip {
-			host = "0.0.0.0"
-		}
-		list = append(list, fmt.Sprintf("%s:%d:%s", serverType, id+1, host))
+		list = append(list, fmt.Sprintf("%s:%d:%s", serverType, s.Id, this.specHost(s)))
 	}
 	return strings.Join(list, ",")
 }
 
+// Generates the server.N entries of zoo.cfg
+func (this *Config) GetZkServers() string {
+	list := []string{}
+	for _, s := range this.ensemble {
+		line := fmt.Sprintf("server.%d=%s:%d:%d", s.Id, this.specHost(s), s.GetQuorumPort(), s.GetElectionPort())
+		if s.Observer {
+			line += ":observer"
+		}
+		list = append(list, line)
+	}
+	return strings.Join(list, "\n")
+}
+
 // Generates the client connection hosts string
 func (this *Config) GetZkHosts() string {
 	minHosts := 3
@@ -146,12 +524,12 @@ func (this *Config) GetZkHosts() string {
 	list := []string{}
 	// Get from observers if any
 	for _, s := range hosts {
-		host := s.Ip
-		port := ":2181"
-		if s.Port > 0 {
-			port = fmt.Sprintf(":%d", s.Port)
-		}
-		list = append(list, host+port)
+		list = append(list, s.ClientAddr())
 	}
 	return strings.Join(list, ",")
 }
+
+// A client of the ensemble, connecting to the hosts of GetZkHosts.  Call Connect to start it.
+func (this *Config) NewClient() (*client.Client, error) {
+	return client.NewClient(this.GetZkHosts())
+}
@@ -0,0 +1,75 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"path/filepath"
+	"strings"
+)
+
+type TestSuiteConfig struct {
+}
+
+var _ = Suite(&TestSuiteConfig{})
+
+func (suite *TestSuiteConfig) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteConfig) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteConfig) TestGenerateZooCfg(c *C) {
+	dir := c.MkDir()
+	config := &Config{
+		Servers:   []HostPort{"192.168.99.101", "192.168.99.100", "192.168.99.102"},
+		Observers: []HostPort{"192.168.99.103"},
+		Hostname:  "192.168.99.101",
+		Mode:      ModeNative,
+		Native: ZooKeeper{
+			DataDirectory: dir,
+			TickTime:      2000,
+			InitLimit:     10,
+			SyncLimit:     5,
+		},
+	}
+	c.Assert(config.Init(), IsNil)
+	defer config.Close()
+
+	c.Assert(myId(c, config), Equals, 2)
+	c.Assert(config.MyIdPath, Equals, filepath.Join(dir, "myid"))
+
+	buff, err := config.GenerateZooCfg()
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(string(buff), "\n")
+	c.Assert(lines, DeepEquals, []string{
+		"# Generated by zk bootstrap",
+		"tickTime=2000",
+		"initLimit=10",
+		"syncLimit=5",
+		"dataDir=" + dir,
+		"clientPort=2181",
+		"peerType=participant",
+		"server.1=192.168.99.100:2888:3888",
+		"server.2=0.0.0.0:2888:3888",
+		"server.3=192.168.99.102:2888:3888",
+		"server.4=192.168.99.103:2888:3888:observer",
+		"",
+	})
+}
+
+func (suite *TestSuiteConfig) TestGenerateZooCfgObserver(c *C) {
+	config := &Config{
+		Servers:   []HostPort{"192.168.99.100"},
+		Observers: []HostPort{"192.168.99.103:2182"},
+		Hostname:  "192.168.99.103",
+		Mode:      ModeNative,
+		Native:    ZooKeeper{DataDirectory: c.MkDir(), TickTime: 2000, InitLimit: 10, SyncLimit: 5},
+	}
+	c.Assert(config.Init(), IsNil)
+	defer config.Close()
+
+	buff, err := config.GenerateZooCfg()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(buff), "clientPort=2182\n"), Equals, true)
+	c.Assert(strings.Contains(string(buff), "peerType=observer\n"), Equals, true)
+}
@@ -0,0 +1,159 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	MetadataEC2 = "ec2"
+	MetadataGCE = "gce"
+
+	EC2MetadataUrl = "http://169.254.169.254/latest/meta-data/"
+	GCEMetadataUrl = "http://metadata.google.internal/computeMetadata/v1/instance/"
+
+	DefaultMetadataTimeout = 2 * time.Second
+)
+
+// Source of this host's addresses other than its network interfaces, such as a cloud
+// provider's metadata service.
+type MetadataProvider interface {
+	Addrs(ctx context.Context) ([]string, error)
+}
+
+// Instance metadata of EC2.  Both the private and the public address are returned.
+type EC2Metadata struct {
+	Url string
+}
+
+func (this *EC2Metadata) Addrs(ctx context.Context) ([]string, error) {
+	return getMetadata(ctx, this.Url, nil, "local-ipv4", "public-ipv4")
+}
+
+// Instance metadata of Google Compute Engine.  Returns the address of the first network
+// interface and its external address.
+type GCEMetadata struct {
+	Url string
+}
+
+func (this *GCEMetadata) Addrs(ctx context.Context) ([]string, error) {
+	return getMetadata(ctx, this.Url, map[string]string{"Metadata-Flavor": "Google"},
+		"network-interfaces/0/ip", "network-interfaces/0/access-configs/0/external-ip")
+}
+
+func NewMetadataProvider(name string) (MetadataProvider, error) {
+	switch name {
+	case MetadataEC2:
+		return &EC2Metadata{Url: EC2MetadataUrl}, nil
+	case MetadataGCE:
+		return &GCEMetadata{Url: GCEMetadataUrl}, nil
+	}
+	return nil, newError(ErrBadMetadataProvider, "%s", name)
+}
+
+// Gets the paths as addresses.  Only the first path is required, since instances may not
+// have a public address.
+func getMetadata(ctx context.Context, base string, headers map[string]string, paths ...string) ([]string, error) {
+	list := []string{}
+	for i, path := range paths {
+		req, err := http.NewRequest("GET", strings.TrimSuffix(base, "/")+"/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		req.Cancel = ctx.Done()
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = newError(ErrMetadata, "%s returned %d", req.URL, resp.StatusCode)
+		}
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			continue
+		}
+		buff, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(strings.TrimSpace(string(buff))); ip != nil {
+			list = append(list, ip.String())
+		}
+	}
+	return list, nil
+}
+
+// Addresses this host may be known by: those of the local interfaces, except loopback and
+// link-local ones, and those from the metadata provider, if any.
+func (this *Config) candidateAddrs() ([]string, error) {
+	list, err := this.interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	if this.metadata != nil {
+		timeout := this.MetadataTimeout
+		if timeout <= 0 {
+			timeout = DefaultMetadataTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if addrs, err := this.metadata.Addrs(ctx); err == nil {
+			list = append(list, addrs...)
+		} else {
+			log.Warn("Cannot get addresses from ", this.Metadata, " metadata: ", err)
+		}
+	}
+	return list, nil
+}
+
+// Addresses of the local interfaces that other hosts can reach, so not loopback or link-local.
+func (this *Config) interfaceAddrs() ([]string, error) {
+	local := this.localAddrs
+	if local == nil {
+		local = localAddrs
+	}
+	addrs, err := local()
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		list = append(list, ip.String())
+	}
+	return list, nil
+}
+
+// Finds this host in the ensemble by its candidate addresses when no Hostname is given.
+func (this *Config) DetectSelf() error {
+	candidates, err := this.candidateAddrs()
+	if err != nil {
+		return err
+	}
+	this.resolveMembers()
+
+	self, err := this.matchAddrs(candidates)
+	if err != nil {
+		return err
+	}
+	if self == nil {
+		return newError(ErrSelfNotInEnsemble, "none of this host's addresses %s is in the ensemble.  Use -ip",
+			strings.Join(candidates, ","))
+	}
+	this.Hostname = self.Ip
+	this.self = &Server{Ip: self.Ip}
+	return nil
+}
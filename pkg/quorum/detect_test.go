@@ -0,0 +1,117 @@
+package quorum
+
+import (
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+type TestSuiteDetect struct {
+}
+
+var _ = Suite(&TestSuiteDetect{})
+
+func (suite *TestSuiteDetect) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteDetect) TearDownSuite(c *C) {
+}
+
+type stubMetadata []string
+
+func (this stubMetadata) Addrs(ctx context.Context) ([]string, error) {
+	return this, nil
+}
+
+func localAddrsOf(addrs ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		return addrs, nil
+	}
+}
+
+func (suite *TestSuiteDetect) TestInterfaces(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"10.0.0.1", "10.0.0.2", "zk-3.internal"},
+		MyIdPath:   filepath.Join(c.MkDir(), "myid"),
+		resolver:   newResolver(),
+		localAddrs: localAddrsOf("127.0.0.1", "::1", "fe80::1", "172.17.0.2", "10.0.0.3"),
+	}
+	c.Assert(config.Init(), IsNil)
+	defer config.Close()
+	c.Assert(config.Hostname, Equals, "zk-3.internal")
+	c.Assert(myId(c, config), Equals, 3)
+}
+
+func (suite *TestSuiteDetect) TestMetadata(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"54.1.1.1", "54.1.1.2", "54.1.1.3"},
+		resolver:   newResolver(),
+		localAddrs: localAddrsOf("172.17.0.2"),
+		metadata:   stubMetadata{"10.0.0.9", "54.1.1.2"},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.DetectSelf(), IsNil)
+	c.Assert(myId(c, config), Equals, 2)
+}
+
+func (suite *TestSuiteDetect) TestNoMatch(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"10.0.0.1", "10.0.0.2"},
+		resolver:   newResolver(),
+		localAddrs: localAddrsOf("127.0.0.1", "172.17.0.2", "fd00::5"),
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	err := config.DetectSelf()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals,
+		"err-self-not-in-ensemble:none of this host's addresses 172.17.0.2,fd00::5 is in the ensemble.  Use -ip")
+}
+
+func (suite *TestSuiteDetect) TestSeveralMatch(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		resolver:   newResolver(),
+		localAddrs: localAddrsOf("10.0.0.1", "10.0.0.3"),
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	err := config.DetectSelf()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals,
+		"err-ambiguous-self:this host at 10.0.0.1,10.0.0.3 matches 10.0.0.1,10.0.0.3")
+}
+
+func (suite *TestSuiteDetect) TestProviders(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ec2/local-ipv4":
+			w.Write([]byte("10.0.0.7"))
+		case "/gce/network-interfaces/0/ip":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing header", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("10.128.0.7"))
+		case "/gce/network-interfaces/0/access-configs/0/external-ip":
+			w.Write([]byte("35.1.1.7\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	addrs, err := (&EC2Metadata{Url: server.URL + "/ec2/"}).Addrs(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(addrs, DeepEquals, []string{"10.0.0.7"})
+
+	addrs, err = (&GCEMetadata{Url: server.URL + "/gce"}).Addrs(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(addrs, DeepEquals, []string{"10.128.0.7", "35.1.1.7"})
+
+	_, err = (&EC2Metadata{Url: server.URL + "/none/"}).Addrs(context.Background())
+	c.Assert(err, NotNil)
+
+	_, err = NewMetadataProvider("azure")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,57 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/discovery"
+	"golang.org/x/net/context"
+	"time"
+)
+
+const (
+	DefaultDiscoverTimeout  = 10 * time.Minute
+	DefaultDiscoverInterval = 5 * time.Second
+)
+
+// Resolves the members at Discover, polling until at least DiscoverSize members are found,
+// and adds them to Servers.
+func (this *Config) DiscoverServers(ctx context.Context) error {
+	resolver := this.resolver
+	if resolver == nil {
+		resolver = discovery.DefaultResolver
+	}
+	expect := this.DiscoverSize
+	if expect < 1 {
+		expect = 1
+	}
+	interval := this.DiscoverInterval
+	if interval <= 0 {
+		interval = DefaultDiscoverInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	found := 0
+	for {
+		list, err := discovery.Resolve(resolver, this.Discover)
+		if err == nil && len(list) >= expect {
+			log.Info("Discovered ", len(list), " members at ", this.Discover, ": ", list)
+			for _, hp := range list {
+				this.Servers = append(this.Servers, HostPort(hp))
+			}
+			return nil
+		}
+		if err != nil {
+			log.Warn("Cannot resolve ", this.Discover, ": ", err)
+		} else {
+			found = len(list)
+			log.Info("Discovered ", found, " of ", expect, " members at ", this.Discover, ".  Waiting.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return newError(ErrDiscoveryTimeout, "found %d of %d members at %s", found, expect, this.Discover)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package quorum
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"net"
+	"sync"
+	"time"
+)
+
+type TestSuiteDiscover struct {
+}
+
+var _ = Suite(&TestSuiteDiscover{})
+
+func (suite *TestSuiteDiscover) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteDiscover) TearDownSuite(c *C) {
+}
+
+// Headless service whose members come up one lookup at a time.
+type growingResolver struct {
+	addrs   []string
+	lookups int
+	lock    sync.Mutex
+}
+
+func (this *growingResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return "", nil, errors.New("no such host")
+}
+
+func (this *growingResolver) LookupHost(host string) ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.lookups++
+	if this.lookups > len(this.addrs) {
+		return this.addrs, nil
+	}
+	return this.addrs[:this.lookups], nil
+}
+
+func (suite *TestSuiteDiscover) TestWaitForMembers(c *C) {
+	resolver := &growingResolver{addrs: []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}}
+	config := &Config{
+		Discover:         "dns://zk.example.svc.cluster.local:2181",
+		DiscoverSize:     3,
+		DiscoverInterval: 10 * time.Millisecond,
+		Hostname:         "10.0.0.2",
+		resolver:         resolver,
+	}
+	c.Assert(config.DiscoverServers(context.Background()), IsNil)
+	c.Assert(resolver.lookups, Equals, 3)
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.1,S:2:0.0.0.0,S:3:10.0.0.3")
+	c.Assert(config.GetZkHosts(), Equals, "10.0.0.1:2181,10.0.0.2:2181,10.0.0.3:2181")
+	c.Assert(myId(c, config), Equals, 2)
+}
+
+func (suite *TestSuiteDiscover) TestTimeout(c *C) {
+	config := &Config{
+		Discover:         "zk.example.svc.cluster.local",
+		DiscoverSize:     5,
+		DiscoverInterval: 10 * time.Millisecond,
+		resolver:         &growingResolver{addrs: []string{"10.0.0.1", "10.0.0.2"}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := config.DiscoverServers(ctx)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "err-discovery-timeout:found 2 of 5 members at zk.example.svc.cluster.local")
+	c.Assert(config.Servers, HasLen, 0)
+}
@@ -0,0 +1,118 @@
+package quorum
+
+import (
+	"errors"
+	"fmt"
+	"github.com/conductant/zk/pkg/exhibitor"
+)
+
+// Kinds of errors returned by this package.  Errors with detail are an *Error, a
+// *BadHostPortError or a *ConfigRejectedError; use Cause to get the kind:
+//
+//	if quorum.Cause(err) == quorum.ErrSelfNotInEnsemble {
+var (
+	// Bad settings
+	ErrBadMode             = errors.New("err-bad-mode")
+	ErrBadConfigHosts      = errors.New("err-bad-config-hosts")
+	ErrBadHostPort         = errors.New("err-bad-host-port")
+	ErrConflictingIds      = errors.New("err-conflicting-ids")
+	ErrDuplicateId         = errors.New("err-duplicate-id")
+	ErrBadMetadataProvider = errors.New("err-bad-metadata-provider")
+	ErrBadReplicas         = errors.New("err-bad-replicas")
+	ErrBadPodName          = errors.New("err-bad-pod-name")
+	ErrNoService           = errors.New("err-no-service")
+	ErrOrdinalOutOfRange   = errors.New("err-ordinal-out-of-range")
+	ErrInvalidConfig       = errors.New("err-invalid-config")
+	ErrBadDataCheck        = errors.New("err-bad-data-check")
+	ErrBadEndpoint         = errors.New("err-bad-endpoint")
+
+	// Identity of this host
+	ErrSelfNotInEnsemble = errors.New("err-self-not-in-ensemble")
+	ErrAmbiguousSelf     = errors.New("err-ambiguous-self")
+	ErrMyIdChanged       = errors.New("err-myid-changed")
+	ErrBadAssignment     = errors.New("err-bad-assignment")
+	ErrMetadata          = errors.New("err-metadata")
+	ErrDiscoveryTimeout  = errors.New("err-discovery-timeout")
+	ErrAddressChanged    = errors.New("err-address-changed")
+
+	// Data directory
+	ErrBadDataDir = errors.New("err-bad-data-dir")
+
+	// Running the child process
+	ErrShuttingDown     = errors.New("err-shutting-down")
+	ErrNotRunning       = errors.New("err-not-running")
+	ErrAlreadyStarted   = errors.New("err-already-started")
+	ErrNoCommand        = errors.New("err-no-command")
+	ErrKilled           = errors.New("err-killed")
+	ErrCrashLoop        = errors.New("err-crash-loop")
+	ErrExhibitorTimeout = errors.New("err-exhibitor-timeout")
+	ErrZkTimeout        = errors.New("err-zk-timeout")
+
+	// State of the ensemble
+	ErrNoQuorum = errors.New("err-no-quorum")
+
+	// Changing the config
+	ErrConfigRejected = errors.New("err-config-rejected")
+	ErrQuorumLost     = errors.New("err-quorum-lost")
+	ErrRollingTimeout = errors.New("err-rolling-timeout")
+
+	// Seeding znodes
+	ErrBadSeed    = errors.New("err-bad-seed")
+	ErrSeedFailed = errors.New("err-seed-failed")
+)
+
+// An error of one of the kinds above, with detail.
+type Error struct {
+	Err    error
+	Detail string
+}
+
+func (this *Error) Error() string {
+	return this.Err.Error() + ":" + this.Detail
+}
+
+func newError(err error, format string, args ...interface{}) *Error {
+	return &Error{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Exhibitor didn't accept the config.  StatusCode and Body are set if it responded with an
+// error status, Message if it responded but reported failure.
+type ConfigRejectedError struct {
+	Url        string
+	StatusCode int
+	Body       string
+	Message    string
+}
+
+func (this *ConfigRejectedError) Error() string {
+	if this.StatusCode > 0 {
+		return fmt.Sprintf("%v:%s returned %d: %s", ErrConfigRejected, this.Url, this.StatusCode, this.Body)
+	}
+	return fmt.Sprintf("%v:%s: %s", ErrConfigRejected, this.Url, this.Message)
+}
+
+// Kind of the error.  Errors of other packages are returned as is.
+func Cause(err error) error {
+	switch err := err.(type) {
+	case *Error:
+		return err.Err
+	case *BadHostPortError:
+		return ErrBadHostPort
+	case *ConfigRejectedError:
+		return ErrConfigRejected
+	}
+	return err
+}
+
+// Maps errors of the Exhibitor client to this package's.
+func exhibitorError(err error) error {
+	switch err := err.(type) {
+	case *exhibitor.StatusError:
+		return &ConfigRejectedError{Url: err.Url, StatusCode: err.StatusCode, Body: err.Body}
+	case *exhibitor.RejectedError:
+		return &ConfigRejectedError{Url: err.Url, Message: err.Message}
+	case *exhibitor.TimeoutError:
+		return newError(ErrExhibitorTimeout, "%s after %v", err.Url, err.Timeout)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package quorum
+
+import (
+	"errors"
+	"github.com/conductant/zk/pkg/exhibitor"
+	. "gopkg.in/check.v1"
+	"time"
+)
+
+type TestSuiteErrors struct {
+}
+
+var _ = Suite(&TestSuiteErrors{})
+
+func (suite *TestSuiteErrors) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteErrors) TearDownSuite(c *C) {
+}
+
+// Id of this host, failing the test if there is none.
+func myId(c *C, config *Config) int {
+	myid, err := config.GetMyId()
+	c.Assert(err, IsNil)
+	return myid
+}
+
+func (suite *TestSuiteErrors) TestCause(c *C) {
+	other := errors.New("err-other")
+	for _, t := range []struct {
+		err   error
+		cause error
+	}{
+		{ErrNoService, ErrNoService},
+		{newError(ErrMyIdChanged, "%d", 2), ErrMyIdChanged},
+		{&BadHostPortError{Flag: "S", Value: "x:y", Reason: "bad"}, ErrBadHostPort},
+		{&ConfigRejectedError{Url: "http://zk-1:8080", StatusCode: 500}, ErrConfigRejected},
+		{other, other},
+		{nil, nil},
+	} {
+		c.Assert(Cause(t.err), Equals, t.cause, Commentf("%v", t.err))
+	}
+	c.Assert(newError(ErrMyIdChanged, "%s has %d", "myid", 2).Error(), Equals, "err-myid-changed:myid has 2")
+}
+
+func (suite *TestSuiteErrors) TestExhibitorError(c *C) {
+	err := exhibitorError(&exhibitor.StatusError{Method: "POST", Url: "http://zk-1:8080/config", StatusCode: 500, Body: "boom"})
+	c.Assert(Cause(err), Equals, ErrConfigRejected)
+	c.Assert(err.(*ConfigRejectedError).StatusCode, Equals, 500)
+	c.Assert(err.(*ConfigRejectedError).Body, Equals, "boom")
+	c.Assert(err.Error(), Equals, "err-config-rejected:http://zk-1:8080/config returned 500: boom")
+
+	err = exhibitorError(&exhibitor.RejectedError{Url: "http://zk-1:8080/config", Message: "no"})
+	c.Assert(Cause(err), Equals, ErrConfigRejected)
+	c.Assert(err.Error(), Equals, "err-config-rejected:http://zk-1:8080/config: no")
+
+	err = exhibitorError(&exhibitor.TimeoutError{Url: "http://zk-1:8080/state", Timeout: time.Second})
+	c.Assert(Cause(err), Equals, ErrExhibitorTimeout)
+
+	c.Assert(exhibitorError(nil), IsNil)
+}
+
+func (suite *TestSuiteErrors) TestNotInEnsemble(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"10.0.0.1", "10.0.0.2"},
+		Hostname:   "10.0.0.9",
+		resolver:   newResolver(),
+		localAddrs: noLocalAddrs,
+	}
+	err := config.InitEnsemble()
+	c.Assert(Cause(err), Equals, ErrSelfNotInEnsemble)
+	c.Assert(err.Error(), Equals, "err-self-not-in-ensemble:-ip 10.0.0.9 matches no member")
+	_, err = config.GetMyId()
+	c.Assert(Cause(err), Equals, ErrSelfNotInEnsemble)
+	c.Assert(err.Error(), Equals, "err-self-not-in-ensemble:10.0.0.9")
+}
@@ -1,145 +1,166 @@
 package quorum
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/conductant/gohm/pkg/encoding"
 	"github.com/conductant/gohm/pkg/resource"
 	"github.com/conductant/gohm/pkg/template"
+	"github.com/conductant/zk/pkg/exhibitor"
+	"github.com/conductant/zk/pkg/metrics"
 	"golang.org/x/net/context"
 	"io/ioutil"
-	"net/http"
-	"os"
-	"os/exec"
 	"strings"
-	"syscall"
 	"time"
 )
 
 const (
-	ZkLocalExhibitorConfigEndpoint      = "http://localhost:8080/exhibitor/v1/config/set"
-	ZkLocalExhibitorCheckStatusEndpoint = "http://localhost:8080/exhibitor/v1/config/get-state"
-	ZkLocalExhibitorStartCommand        = "java -jar /usr/local/exhibitor-1.5.1/exhibitor-1.5.1.jar -c file"
+	ZkLocalExhibitorEndpoint     = "http://localhost:8080"
+	ZkLocalExhibitorStartCommand = "java -jar /usr/local/exhibitor-1.5.1/exhibitor-1.5.1.jar -c file"
 )
 
 type Exhibitor struct {
-	ReadyTimeout        encoding.Duration  `json:"zk_ready_timeout" yaml:"zk_ready_timeout"`
-	ReadyPollInterval   encoding.Duration  `json:"zk_ready_poll_interval" yaml:"zk_ready_poll_interval"`
-	ConfigTemplateUrl   string             `json:"config_url" yaml:"config_url" flag:"t, Url of config template."`
-	ConfigEndpoint      string             `json:"config_endpoint" yaml:"config_endpoint"`
-	CheckStatusEndpoint string             `json:"status_endpoint" yaml:"status_endpoint"`
-	Ready               <-chan interface{} `json:"-" yaml:"-"`
-	Error               <-chan error       `json:"-" yaml:"-"`
-	ZkRunning           <-chan interface{} `json:"-" yaml:"-"`
-
-	cmd *exec.Cmd
-}
-
-func (this *Exhibitor) Start() {
-	this.checkReady()
-	go func() {
-		err := this.exec()
-		if err != nil {
-			panic(err)
-		}
-	}()
+	ReadyTimeout         encoding.Duration `json:"zk_ready_timeout" yaml:"zk_ready_timeout"`
+	ReadyPollInterval    encoding.Duration `json:"zk_ready_poll_interval" yaml:"zk_ready_poll_interval"`
+	ReadyPollIntervalMax time.Duration     `json:"zk_ready_poll_interval_max" yaml:"zk_ready_poll_interval_max" flag:"ready_poll_max, Maximum time between readiness checks.  The interval doubles while nothing changes"`
+	RequestTimeout       encoding.Duration `json:"request_timeout" yaml:"request_timeout"`
+	ConfigTemplateUrl    string            `json:"config_url" yaml:"config_url" flag:"t, Url of config template."`
+	Endpoint             string            `json:"endpoint" yaml:"endpoint" flag:"exhibitor, Url of the Exhibitor server"`
+	ConfigEndpoint       string            `json:"config_endpoint" yaml:"config_endpoint"` // Optional file:// url to save config to instead, or the url of config/set
+	StatusEndpoint       string            `json:"status_endpoint" yaml:"status_endpoint"` // Optional url of config/get-state
+	Rolling              bool              `json:"rolling" yaml:"rolling" flag:"rolling, Apply config changes one server at a time"`
+	RollingTimeout       time.Duration     `json:"rolling_timeout" yaml:"rolling_timeout" flag:"rolling_timeout, Time allowed for a rolling config change"`
+
+	supervisor    *Supervisor
+	monitor       *monitor
+	stopMonitor   context.CancelFunc
+	zkAddr        string
+	applyAttempts metrics.Counter
+	applyFailures metrics.Counter
 }
 
-func (this *Exhibitor) Stop() error {
-	if this.cmd == nil {
-		return errors.New("err-not-running")
+// Returns a REST client for the Exhibitor endpoint.
+func (this *Exhibitor) Client() (*exhibitor.Client, error) {
+	endpoint, err := this.endpoint()
+	if err != nil {
+		return nil, err
 	}
-	err := this.cmd.Process.Signal(syscall.SIGTERM)
+	client, err := exhibitor.NewClient(endpoint)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	state, err := this.cmd.Process.Wait()
-	log.Info("Process exited=", state.Exited(), "state=", state.String())
-	return err
+	if this.RequestTimeout.Duration > 0 {
+		client.Timeout = this.RequestTimeout.Duration
+	}
+	return client, nil
 }
 
-func (this *Exhibitor) exec() error {
-	command := strings.Split(ZkLocalExhibitorStartCommand, " ")
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	log.Info("Starting Exhibitor:", cmd.Path, strings.Join(cmd.Args, " "))
-	err := cmd.Start()
-	if err != nil {
+// Base url of the Exhibitor server.  Settings from before the REST client give the urls of
+// config/set and config/get-state as config_endpoint and status_endpoint instead.  These take
+// precedence and must be on the same server.
+func (this *Exhibitor) endpoint() (string, error) {
+	endpoint := ""
+	for _, setting := range []struct{ name, url, path string }{
+		{"config_endpoint", this.ConfigEndpoint, exhibitor.PathConfigSet},
+		{"status_endpoint", this.StatusEndpoint, exhibitor.PathConfigGetState},
+	} {
+		if setting.url == "" || setting.name == "config_endpoint" && strings.HasPrefix(setting.url, "file://") {
+			continue
+		}
+		suffix := exhibitor.ApiPrefix + setting.path
+		if !strings.HasSuffix(setting.url, suffix) {
+			return "", newError(ErrBadEndpoint, "%s %s is not the url of %s", setting.name, setting.url, suffix)
+		}
+		base := strings.TrimSuffix(setting.url, suffix)
+		if endpoint != "" && base != endpoint {
+			return "", newError(ErrBadEndpoint, "config_endpoint and status_endpoint are on %s and %s", endpoint, base)
+		}
+		endpoint = base
+	}
+	if endpoint == "" {
+		return this.Endpoint, nil
+	}
+	if _, err := exhibitor.NewClient(endpoint); err != nil {
+		return "", newError(ErrBadEndpoint, "%s: %v", endpoint, err)
+	}
+	return endpoint, nil
+}
+
+// Starts Exhibitor under the given supervisor.
+func (this *Exhibitor) Start(supervisor *Supervisor) error {
+	supervisor.Name = "Exhibitor"
+	supervisor.Command = strings.Split(ZkLocalExhibitorStartCommand, " ")
+	if err := supervisor.Start(); err != nil {
 		return err
 	}
-	this.cmd = cmd
+	this.supervisor = supervisor
+	this.monitor, this.stopMonitor = startMonitor("Exhibitor", this.probe,
+		this.ReadyPollInterval.Duration, this.ReadyPollIntervalMax, supervisor)
 	return nil
 }
 
-func (this *Exhibitor) Running() (exhibitorUp bool, zkUp bool, err error) {
-	client := &http.Client{}
-	resp, err := client.Get(this.CheckStatusEndpoint)
-	if err != nil {
-		return false, false, err
-	}
-	exhibitorUp = resp.StatusCode == http.StatusOK
-	if exhibitorUp {
-		if buff, err := ioutil.ReadAll(resp.Body); err == nil {
-			log.Debug("Status=", string(buff), "err=", err)
-			status := new(struct {
-				Running bool `json:"running"`
-			})
-			if err = json.Unmarshal(buff, status); err == nil {
-				zkUp = status.Running
-			}
-		}
+func (this *Exhibitor) Stop() error {
+	if this.supervisor == nil {
+		return ErrNotRunning
 	}
-	return
+	defer this.stopMonitor()
+	return this.supervisor.Stop()
 }
 
-func (this *Exhibitor) checkReady() {
-	defer log.Info("Started monitoring for Exhibitor to come up.")
-
-	ready := make(chan interface{})
-	error := make(chan error, 10)
-	running := make(chan interface{})
-
-	this.Ready = ready
-	this.Error = error
-	this.ZkRunning = running
-
-	go func() {
-
-		ticker := time.Tick(this.ReadyPollInterval.Duration)
-		timeout := time.Tick(this.ReadyTimeout.Duration)
-		closed := false
-		for {
-			select {
-
-			case <-timeout:
+func (this *Exhibitor) Running() (exhibitorUp bool, zkUp bool, err error) {
+	state, err := this.probe(context.Background())
+	return state != StateStarting, state == StateInQuorum, err
+}
 
-				log.Warn("Timeout polling Exhibitor")
-				error <- errors.New("err-timeout-zk-startup")
+func (this *Exhibitor) probe(ctx context.Context) (State, error) {
+	client, err := this.Client()
+	if err != nil {
+		return StateStarting, err
+	}
+	state, err := client.GetState(ctx)
+	if err != nil {
+		return StateStarting, err
+	}
+	log.Debug("Status=", state)
+	if !state.Running {
+		return StateExhibitorUp, nil
+	}
+	// Exhibitor reports running while ZooKeeper is still syncing with the leader.
+	return probeZk(this.zkAddr, this.ReadyPollInterval.Duration, StateExhibitorUp)
+}
 
-			case <-ticker:
+// Blocks until Exhibitor answers.  Returns an error of kind ErrExhibitorTimeout if it doesn't
+// within ReadyTimeout of starting, or ErrNotRunning if it stops first.
+func (this *Exhibitor) WaitReady(ctx context.Context) error {
+	if this.monitor == nil {
+		return ErrNotRunning
+	}
+	return this.monitor.wait(ctx, exhibitorUp, this.ReadyTimeout.Duration, ErrExhibitorTimeout)
+}
 
-				log.Info("CheckReady: ", this.CheckStatusEndpoint)
+// Blocks until the ZooKeeper started by Exhibitor serves clients.  Returns an error of kind
+// ErrExhibitorTimeout if it doesn't within ReadyTimeout of starting, or ErrNotRunning if it
+// stops first.
+func (this *Exhibitor) WaitZkRunning(ctx context.Context) error {
+	if this.monitor == nil {
+		return ErrNotRunning
+	}
+	return this.monitor.wait(ctx, zkInQuorum, this.ReadyTimeout.Duration, ErrExhibitorTimeout)
+}
 
-				exhibitorUp, zkUp, err := this.Running()
-				log.Info("Ready: exhibitor=", exhibitorUp, ",zk=", zkUp, ",err=", err)
+// State changes until the context is done or Exhibitor stops.
+func (this *Exhibitor) Events(ctx context.Context) <-chan StateChange {
+	if this.monitor == nil {
+		return closedEvents()
+	}
+	return this.monitor.events(ctx)
+}
 
-				if exhibitorUp && !closed {
-					close(ready)
-					closed = true
-				}
-				if zkUp {
-					close(running)
-					return
-				}
-				if err != nil {
-					error <- err
-				}
-			}
-		}
-	}()
+// Current state and the last probe error.
+func (this *Exhibitor) State() (State, error) {
+	if this.monitor == nil {
+		return StateStopped, nil
+	}
+	return this.monitor.get()
 }
 
 func (this *Exhibitor) GenerateConfig(data interface{}, funcs map[string]interface{}) ([]byte, error) {
@@ -151,39 +172,27 @@ func (this *Exhibitor) GenerateConfig(data interface{}, funcs map[string]interfa
 }
 
 func (this *Exhibitor) ApplyConfig(authToken string, config []byte) error {
-	// now apply the config, based on the url of the destination
-	parts := strings.Split(this.ConfigEndpoint, "://")
-	if len(parts) == 1 {
-		return errors.New("err-bad-url:" + this.ConfigEndpoint)
-	}
-	switch parts[0] {
-	case "http", "https":
-		return do_post(this.ConfigEndpoint, config, authToken)
-	case "file":
-		return do_save(parts[1], config)
-	default:
-		return errors.New("err-not-supported:" + parts[0])
-	}
-	return nil
+	return this.countApply(exhibitorError(this.applyConfig(authToken, config)))
 }
 
-func do_post(url string, body []byte, authToken string) error {
-	client := &http.Client{}
-	post, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	post.Header.Add("Content-Type", "application/json")
-	if authToken != "" {
-		post.Header.Add("Authorization", "Bearer "+authToken)
+func (this *Exhibitor) applyConfig(authToken string, config []byte) error {
+	if strings.HasPrefix(this.ConfigEndpoint, "file://") {
+		return do_save(strings.TrimPrefix(this.ConfigEndpoint, "file://"), config)
 	}
-	resp, err := client.Do(post)
+	client, err := this.Client()
 	if err != nil {
 		return err
 	}
-	switch resp.StatusCode {
-	case http.StatusOK:
-		return nil
-	default:
-		return errors.New("err-post-failed:" + url)
+	client.AuthToken = authToken
+	return client.SetConfig(context.Background(), config)
+}
+
+func (this *Exhibitor) countApply(err error) error {
+	this.applyAttempts.Inc()
+	if err != nil {
+		this.applyFailures.Inc()
 	}
+	return err
 }
 
 func do_save(path string, body []byte) error {
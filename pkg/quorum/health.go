@@ -0,0 +1,213 @@
+package quorum
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/exhibitor"
+	"github.com/conductant/zk/pkg/fourletter"
+	"golang.org/x/net/context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHealthAddr = ":8181"
+
+	// Number of errors kept for /status
+	MaxRecentErrors = 10
+)
+
+// An error reported by the child process monitor or the myid watcher.
+type RecentError struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Error  string    `json:"error"`
+}
+
+type recentErrors struct {
+	list []RecentError
+	lock sync.Mutex
+}
+
+func (this *recentErrors) add(source string, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.list = append(this.list, RecentError{Time: time.Now(), Source: source, Error: err.Error()})
+	if len(this.list) > MaxRecentErrors {
+		this.list = this.list[len(this.list)-MaxRecentErrors:]
+	}
+}
+
+func (this *recentErrors) get() []RecentError {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]RecentError{}, this.list...)
+}
+
+// Child process as seen by /status
+type ChildStatus struct {
+	Name     string `json:"name"`
+	Alive    bool   `json:"alive"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Response of /status
+type LocalStatus struct {
+	MyId         int                    `json:"myid"`
+	Mode         string                 `json:"mode"`
+	State        State                  `json:"state"`
+	Ensemble     []*Server              `json:"ensemble"`
+	ShuttingDown bool                   `json:"shutting_down"`
+	Child        ChildStatus            `json:"child"`
+	ZooKeeper    *fourletter.Stat       `json:"zookeeper,omitempty"`
+	Exhibitor    *exhibitor.SystemState `json:"exhibitor,omitempty"`
+	Errors       []RecentError          `json:"errors"`
+}
+
+// Keeps the last errors sent on the channel until the supervised child is done.
+func (this *Config) collectErrors(source string, errs <-chan error) {
+	if errs == nil {
+		return
+	}
+	done := this.Supervisor.Done
+	go func() {
+		for {
+			select {
+			case err := <-errs:
+				log.Warn("Error from ", source, ": ", err)
+				this.recent.add(source, err)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Logs the state changes of the child process.  Changes with a probe error and losing quorum
+// are kept as recent errors.
+func (this *Config) collectEvents(source string, events <-chan StateChange) {
+	go func() {
+		for change := range events {
+			switch {
+			case change.To == StateDegraded && change.Error != "":
+				this.recent.add(source, fmt.Errorf("%s -> %s: %s", change.From, change.To, change.Error))
+			case change.To == StateDegraded:
+				this.recent.add(source, fmt.Errorf("%s -> %s", change.From, change.To))
+			case change.Error != "":
+				this.recent.add(source, fmt.Errorf("%s: %s", change.To, change.Error))
+			}
+		}
+	}()
+}
+
+// Errors recently reported by the child process monitor and the myid watcher, oldest first.
+func (this *Config) RecentErrors() []RecentError {
+	return this.recent.get()
+}
+
+// Starts serving /healthz, /readyz, /status and /metrics on HealthAddr.  Close the listener to stop.
+func (this *Config) ServeHealth() (net.Listener, error) {
+	listener, err := net.Listen("tcp", this.HealthAddr)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Serving health endpoints at ", listener.Addr())
+	go http.Serve(listener, this.HealthHandler())
+	return listener, nil
+}
+
+func (this *Config) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", this.serveHealthz)
+	mux.HandleFunc("/readyz", this.serveReadyz)
+	mux.HandleFunc("/status", this.serveStatus)
+	mux.Handle("/metrics", this.Metrics())
+	return mux
+}
+
+// Healthy as long as the child process is under supervision.
+func (this *Config) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if !this.Supervisor.Alive() {
+		reason := "child not started"
+		if err := this.Supervisor.Err(); err != nil {
+			reason = err.Error()
+		} else if this.Supervisor.Started() {
+			reason = "child stopped"
+		}
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Ready once the local ZooKeeper serves clients, which for a member of an ensemble means
+// it's in quorum.  Not ready while shutting down.
+func (this *Config) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	if this.ShuttingDown() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	stat, err := this.localStat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !stat.Serving() {
+		http.Error(w, "not serving: mode="+stat.Mode, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, stat.Mode)
+}
+
+func (this *Config) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := &LocalStatus{
+		Mode:         this.Mode,
+		Ensemble:     this.ensemble,
+		ShuttingDown: this.ShuttingDown(),
+		Child: ChildStatus{
+			Name:     this.Supervisor.Name,
+			Alive:    this.Supervisor.Alive(),
+			Restarts: this.Supervisor.Restarts(),
+		},
+		Errors: this.RecentErrors(),
+	}
+	if myid, err := this.GetMyId(); err == nil {
+		status.MyId = myid
+	}
+	status.State, _ = this.State()
+	if err := this.Supervisor.Err(); err != nil {
+		status.Child.Error = err.Error()
+	}
+	if stat, err := this.localStat(); err == nil {
+		status.ZooKeeper = stat
+	}
+	if this.Mode == ModeExhibitor {
+		if client, err := this.Exhibitor.Client(); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), client.Timeout)
+			if state, err := client.GetState(ctx); err == nil {
+				status.Exhibitor = state
+			}
+			cancel()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	buff, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(buff)
+}
+
+func (this *Config) localStat() (*fourletter.Stat, error) {
+	client := fourletter.NewClient(this.LocalZkAddr())
+	if this.ReadyPollInterval.Duration > 0 {
+		client.Timeout = this.ReadyPollInterval.Duration
+	}
+	return client.Srvr()
+}
@@ -0,0 +1,116 @@
+package quorum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+type TestSuiteHealth struct {
+	listener net.Listener
+}
+
+var _ = Suite(&TestSuiteHealth{})
+
+func (suite *TestSuiteHealth) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteHealth) TearDownTest(c *C) {
+	if suite.listener != nil {
+		suite.listener.Close()
+		suite.listener = nil
+	}
+}
+
+// Config for a single member whose local ZooKeeper answers srvr in the given mode.
+func (suite *TestSuiteHealth) member(c *C, mode string) *Config {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	suite.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 4))
+			fmt.Fprintf(conn, "Zookeeper version: 3.4.6\nZxid: 0x100000005\nMode: %s\n", mode)
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	config := &Config{
+		Mode:     ModeNative,
+		Hostname: "127.0.0.1",
+		Servers:  []HostPort{HostPort("127.0.0.1:" + port)},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.GetClientPort(), Equals, p)
+	return config
+}
+
+func get(handler http.Handler, path string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func (suite *TestSuiteHealth) TestHealthz(c *C) {
+	config := suite.member(c, "standalone")
+	c.Assert(get(config.HealthHandler(), "/healthz").Code, Equals, http.StatusServiceUnavailable)
+
+	config.Supervisor.Command = []string{"sleep", "10"}
+	c.Assert(config.Supervisor.Start(), IsNil)
+	defer config.Supervisor.Stop()
+	c.Assert(get(config.HealthHandler(), "/healthz").Code, Equals, http.StatusOK)
+}
+
+func (suite *TestSuiteHealth) TestReadyz(c *C) {
+	config := suite.member(c, "follower")
+	w := get(config.HealthHandler(), "/readyz")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(w.Body.String()), Equals, "follower")
+
+	config.drain()
+	w = get(config.HealthHandler(), "/readyz")
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Body.String(), Matches, "shutting down\n")
+}
+
+func (suite *TestSuiteHealth) TestReadyzNotServing(c *C) {
+	config := suite.member(c, "looking")
+	w := get(config.HealthHandler(), "/readyz")
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Body.String(), Matches, "not serving: mode=looking\n")
+}
+
+func (suite *TestSuiteHealth) TestStatus(c *C) {
+	config := suite.member(c, "standalone")
+	for i := 0; i < MaxRecentErrors+2; i++ {
+		config.recent.add("zookeeper", errors.New(fmt.Sprintf("err-%d", i)))
+	}
+
+	w := get(config.HealthHandler(), "/status")
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	status := new(LocalStatus)
+	c.Assert(json.Unmarshal(w.Body.Bytes(), status), IsNil)
+	c.Assert(status.MyId, Equals, 1)
+	c.Assert(status.Mode, Equals, ModeNative)
+	c.Assert(status.Ensemble, HasLen, 1)
+	c.Assert(status.Ensemble[0].Ip, Equals, "127.0.0.1")
+	c.Assert(status.ZooKeeper, NotNil)
+	c.Assert(status.ZooKeeper.Mode, Equals, "standalone")
+	c.Assert(status.Exhibitor, IsNil)
+	c.Assert(status.Errors, HasLen, MaxRecentErrors)
+	c.Assert(status.Errors[0].Error, Equals, "err-2")
+}
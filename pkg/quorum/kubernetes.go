@@ -0,0 +1,106 @@
+package quorum
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read when the flags aren't set.  POD_NAME is usually set from the
+// downward API (fieldRef metadata.name).
+const (
+	EnvPodName     = "POD_NAME"
+	EnvStatefulSet = "ZK_STATEFULSET"
+	EnvService     = "ZK_SERVICE"
+	EnvReplicas    = "ZK_REPLICAS"
+	EnvDomain      = "ZK_DOMAIN"
+)
+
+// Identity of a member of a Kubernetes StatefulSet.  The myid is the pod's ordinal plus one
+// and the members are the stable names <statefulset>-<ordinal>.<service>, so ids don't change
+// when pods are rescheduled with new IPs.
+type Kubernetes struct {
+	PodName     string `json:"pod_name" yaml:"pod_name" flag:"pod_name, This pod's name such as zk-2.  Defaults to $POD_NAME"`
+	StatefulSet string `json:"statefulset" yaml:"statefulset" flag:"statefulset, Name of the StatefulSet.  Defaults to the pod name without the ordinal"`
+	Service     string `json:"service" yaml:"service" flag:"service, Headless service governing the StatefulSet.  Defaults to $ZK_SERVICE"`
+	Replicas    int    `json:"replicas" yaml:"replicas" flag:"replicas, Number of voting members in the StatefulSet.  Defaults to $ZK_REPLICAS"`
+	Domain      string `json:"domain" yaml:"domain" flag:"domain, Optional suffix of member names such as default.svc.cluster.local"`
+}
+
+// Fills in unset fields from the environment.
+func (this *Kubernetes) fromEnv() error {
+	if this.PodName == "" {
+		this.PodName = os.Getenv(EnvPodName)
+	}
+	if this.StatefulSet == "" {
+		this.StatefulSet = os.Getenv(EnvStatefulSet)
+	}
+	if this.Service == "" {
+		this.Service = os.Getenv(EnvService)
+	}
+	if this.Domain == "" {
+		this.Domain = os.Getenv(EnvDomain)
+	}
+	if this.Replicas == 0 && os.Getenv(EnvReplicas) != "" {
+		replicas, err := strconv.Atoi(os.Getenv(EnvReplicas))
+		if err != nil {
+			return newError(ErrBadReplicas, "%s", os.Getenv(EnvReplicas))
+		}
+		this.Replicas = replicas
+	}
+	return nil
+}
+
+// True if the members are generated from the StatefulSet.
+func (this *Kubernetes) Enabled() bool {
+	return this.Replicas > 0
+}
+
+// Ordinal of this pod, from the suffix of the pod name.
+func (this *Kubernetes) Ordinal() (int, error) {
+	i := strings.LastIndex(this.PodName, "-")
+	if i < 0 {
+		return 0, newError(ErrBadPodName, "%s", this.PodName)
+	}
+	ordinal, err := strconv.Atoi(this.PodName[i+1:])
+	if err != nil || ordinal < 0 {
+		return 0, newError(ErrBadPodName, "%s", this.PodName)
+	}
+	if this.StatefulSet != "" && this.PodName[:i] != this.StatefulSet {
+		return 0, newError(ErrBadPodName, "%s is not in statefulset %s", this.PodName, this.StatefulSet)
+	}
+	return ordinal, nil
+}
+
+// Stable network name of the member with the ordinal.
+func (this *Kubernetes) Host(ordinal int) string {
+	host := fmt.Sprintf("%s-%d.%s", this.StatefulSet, ordinal, this.Service)
+	if this.Domain != "" {
+		host += "." + strings.Trim(this.Domain, ".")
+	}
+	return host
+}
+
+// Validates the settings and returns this pod's name and the members of the StatefulSet, with
+// ids from their ordinals.
+func (this *Kubernetes) Members() (string, []*Server, error) {
+	ordinal, err := this.Ordinal()
+	if err != nil {
+		return "", nil, err
+	}
+	if this.StatefulSet == "" {
+		this.StatefulSet = this.PodName[:strings.LastIndex(this.PodName, "-")]
+	}
+	if this.Service == "" {
+		return "", nil, ErrNoService
+	}
+	if ordinal >= this.Replicas {
+		return "", nil, newError(ErrOrdinalOutOfRange, "%s is not one of %d replicas", this.PodName, this.Replicas)
+	}
+	servers := []*Server{}
+	for i := 0; i < this.Replicas; i++ {
+		servers = append(servers, &Server{Id: i + 1, Ip: this.Host(i)})
+	}
+	return this.Host(ordinal), servers, nil
+}
@@ -0,0 +1,77 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"os"
+	"strings"
+)
+
+type TestSuiteKubernetes struct {
+}
+
+var _ = Suite(&TestSuiteKubernetes{})
+
+func (suite *TestSuiteKubernetes) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteKubernetes) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteKubernetes) TestMembers(c *C) {
+	k8s := &Kubernetes{PodName: "zk-2", Service: "zk-hs", Replicas: 3}
+	self, members, err := k8s.Members()
+	c.Assert(err, IsNil)
+	c.Assert(self, Equals, "zk-2.zk-hs")
+	c.Assert(k8s.StatefulSet, Equals, "zk")
+	c.Assert(members, DeepEquals, []*Server{
+		{Id: 1, Ip: "zk-0.zk-hs"},
+		{Id: 2, Ip: "zk-1.zk-hs"},
+		{Id: 3, Ip: "zk-2.zk-hs"},
+	})
+
+	k8s = &Kubernetes{PodName: "my-zk-0", Service: "zk-hs", Replicas: 1, Domain: "default.svc.cluster.local."}
+	self, _, err = k8s.Members()
+	c.Assert(err, IsNil)
+	c.Assert(self, Equals, "my-zk-0.zk-hs.default.svc.cluster.local")
+}
+
+func (suite *TestSuiteKubernetes) TestMembersErrors(c *C) {
+	for _, k8s := range []*Kubernetes{
+		{PodName: "zk", Service: "zk-hs", Replicas: 3},
+		{PodName: "zk-x", Service: "zk-hs", Replicas: 3},
+		{PodName: "other-1", StatefulSet: "zk", Service: "zk-hs", Replicas: 3},
+		{PodName: "zk-3", Service: "zk-hs", Replicas: 3},
+		{PodName: "zk-1", Replicas: 3},
+	} {
+		_, _, err := k8s.Members()
+		c.Assert(err, NotNil, Commentf("%v", k8s))
+	}
+}
+
+func (suite *TestSuiteKubernetes) TestFromEnv(c *C) {
+	os.Setenv(EnvPodName, "zk-1")
+	os.Setenv(EnvService, "zk-hs")
+	os.Setenv(EnvReplicas, "3")
+	defer func() {
+		os.Unsetenv(EnvPodName)
+		os.Unsetenv(EnvService)
+		os.Unsetenv(EnvReplicas)
+	}()
+
+	config := &Config{
+		Hostname: "10.1.2.3",
+		Mode:     ModeNative,
+		Native:   ZooKeeper{DataDirectory: c.MkDir(), TickTime: 2000, InitLimit: 10, SyncLimit: 5},
+	}
+	c.Assert(config.Init(), IsNil)
+	defer config.Close()
+
+	c.Assert(config.Hostname, Equals, "zk-1.zk-hs")
+	c.Assert(myId(c, config), Equals, 2)
+
+	buff, err := config.GenerateZooCfg()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(buff),
+		"server.1=zk-0.zk-hs:2888:3888\nserver.2=0.0.0.0:2888:3888\nserver.3=zk-2.zk-hs:2888:3888\n"), Equals, true)
+	c.Assert(config.GetZkHosts(), Equals, "zk-0.zk-hs:2181,zk-1.zk-hs:2181,zk-2.zk-hs:2181")
+}
@@ -0,0 +1,55 @@
+package quorum
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultLogTailLines = 50
+)
+
+// Keeps the last lines written to it, so the child's output can be reported when it fails.
+type logTail struct {
+	max     int
+	lines   []string
+	partial string
+	lock    sync.Mutex
+}
+
+func newLogTail(max int) *logTail {
+	if max <= 0 {
+		max = DefaultLogTailLines
+	}
+	return &logTail{max: max}
+}
+
+func (this *logTail) Write(p []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	text := this.partial + string(p)
+	lines := strings.Split(text, "\n")
+	this.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		this.lines = append(this.lines, strings.TrimSuffix(line, "\r"))
+	}
+	if len(this.lines) > this.max {
+		this.lines = append([]string{}, this.lines[len(this.lines)-this.max:]...)
+	}
+	return len(p), nil
+}
+
+// The last lines, oldest first, including a line not yet terminated.
+func (this *logTail) get() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	lines := append([]string{}, this.lines...)
+	if this.partial != "" {
+		lines = append(lines, this.partial)
+	}
+	if len(lines) > this.max {
+		lines = lines[len(lines)-this.max:]
+	}
+	return lines
+}
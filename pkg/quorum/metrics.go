@@ -0,0 +1,146 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/fourletter"
+	"github.com/conductant/zk/pkg/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMetricsInterval = 15 * time.Second
+)
+
+// Last mntr response of the local ZooKeeper.
+type mntrScrape struct {
+	value  *fourletter.Mntr
+	errors metrics.Counter
+	lock   sync.Mutex
+}
+
+func (this *mntrScrape) get() *fourletter.Mntr {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.value
+}
+
+func (this *mntrScrape) set(value *fourletter.Mntr) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.value = value
+}
+
+// Asks the local ZooKeeper for mntr and keeps the response for /metrics.
+func (this *Config) ScrapeMntr() error {
+	client := fourletter.NewClient(this.LocalZkAddr())
+	if this.ReadyPollInterval.Duration > 0 {
+		client.Timeout = this.ReadyPollInterval.Duration
+	}
+	mntr, err := client.Mntr()
+	if err != nil {
+		this.mntr.errors.Inc()
+		this.mntr.set(nil)
+		return err
+	}
+	this.mntr.set(mntr)
+	return nil
+}
+
+// Scrapes mntr every MetricsInterval until the supervised child is done.
+func (this *Config) scrapeMntr() {
+	if this.MetricsInterval <= 0 {
+		return
+	}
+	done := this.Supervisor.Done
+	go func() {
+		ticker := time.NewTicker(this.MetricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.ScrapeMntr(); err != nil {
+					log.Debug("Cannot scrape mntr: ", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Metrics of the local ZooKeeper and of the bootstrapper itself.
+func (this *Config) Metrics() *metrics.Registry {
+	registry := metrics.NewRegistry()
+
+	registry.Gauge("zk_up", "1 if the last mntr scrape of the local ZooKeeper succeeded",
+		func() (float64, bool) {
+			if this.mntr.get() == nil {
+				return 0, true
+			}
+			return 1, true
+		})
+	registry.Counter("zk_mntr_scrape_errors_total", "Failed mntr scrapes of the local ZooKeeper", this.mntr.errors.Value)
+
+	mntr := func(name, help string, value func(*fourletter.Mntr) int64) {
+		registry.Gauge(name, help, func() (float64, bool) {
+			m := this.mntr.get()
+			if m == nil {
+				return 0, false
+			}
+			return float64(value(m)), true
+		})
+	}
+	mntr("zk_min_latency", "Minimum request latency in ms", func(m *fourletter.Mntr) int64 { return m.Latency.Min })
+	mntr("zk_avg_latency", "Average request latency in ms", func(m *fourletter.Mntr) int64 { return m.Latency.Avg })
+	mntr("zk_max_latency", "Maximum request latency in ms", func(m *fourletter.Mntr) int64 { return m.Latency.Max })
+	mntr("zk_outstanding_requests", "Queued requests", func(m *fourletter.Mntr) int64 { return m.OutstandingRequests })
+	mntr("zk_num_alive_connections", "Client connections", func(m *fourletter.Mntr) int64 { return m.NumAliveConnections })
+	mntr("zk_znode_count", "Number of znodes", func(m *fourletter.Mntr) int64 { return m.ZnodeCount })
+	mntr("zk_watch_count", "Number of watches", func(m *fourletter.Mntr) int64 { return m.WatchCount })
+	mntr("zk_ephemerals_count", "Number of ephemeral znodes", func(m *fourletter.Mntr) int64 { return m.EphemeralsCount })
+	mntr("zk_approximate_data_size", "Approximate size of the data in bytes", func(m *fourletter.Mntr) int64 { return m.ApproximateDataSize })
+	mntr("zk_open_file_descriptor_count", "Open file descriptors", func(m *fourletter.Mntr) int64 { return m.OpenFileDescriptorCount })
+	mntr("zk_max_file_descriptor_count", "Maximum file descriptors", func(m *fourletter.Mntr) int64 { return m.MaxFileDescriptorCount })
+
+	// Left out unless the local ZooKeeper leads, rather than reported as 0 by the followers.
+	leader := func(name, help string, value func(*fourletter.Mntr) int64) {
+		registry.Gauge(name, help, func() (float64, bool) {
+			m := this.mntr.get()
+			if m == nil || m.ServerState != fourletter.ModeLeader {
+				return 0, false
+			}
+			return float64(value(m)), true
+		})
+	}
+	leader("zk_followers", "Followers of the leader.  Only reported by the leader", func(m *fourletter.Mntr) int64 { return m.Followers })
+	leader("zk_synced_followers", "Followers in sync with the leader.  Only reported by the leader", func(m *fourletter.Mntr) int64 { return m.SyncedFollowers })
+	leader("zk_pending_syncs", "Pending syncs.  Only reported by the leader", func(m *fourletter.Mntr) int64 { return m.PendingSyncs })
+	registry.Gauge("zk_leader", "1 if the local ZooKeeper is the leader", func() (float64, bool) {
+		m := this.mntr.get()
+		if m == nil {
+			return 0, false
+		}
+		if m.ServerState == fourletter.ModeLeader {
+			return 1, true
+		}
+		return 0, true
+	})
+
+	registry.Counter("zk_bootstrap_child_restarts_total", "Restarts of ZooKeeper or Exhibitor by the supervisor",
+		metrics.Int(this.Supervisor.Restarts))
+	registry.Counter("zk_bootstrap_myid_recreations_total", "Times the myid file was recreated after removal",
+		func() (float64, bool) {
+			if this.myid == nil {
+				return 0, true
+			}
+			return float64(this.myid.Recreations()), true
+		})
+	registry.Counter("zk_bootstrap_address_changes_total", "Times a member's name resolved to new addresses",
+		this.resolved.changes.Value)
+	registry.Counter("zk_bootstrap_config_apply_attempts_total", "Attempts to apply config through Exhibitor",
+		this.Exhibitor.applyAttempts.Value)
+	registry.Counter("zk_bootstrap_config_apply_failures_total", "Failed attempts to apply config through Exhibitor",
+		this.Exhibitor.applyFailures.Value)
+	return registry
+}
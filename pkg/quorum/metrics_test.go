@@ -0,0 +1,134 @@
+package quorum
+
+import (
+	"bytes"
+	"errors"
+	. "gopkg.in/check.v1"
+	"net"
+	"strings"
+)
+
+type TestSuiteMetrics struct {
+	listener net.Listener
+}
+
+var _ = Suite(&TestSuiteMetrics{})
+
+func (suite *TestSuiteMetrics) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteMetrics) TearDownTest(c *C) {
+	if suite.listener != nil {
+		suite.listener.Close()
+		suite.listener = nil
+	}
+}
+
+const leaderMntr = "zk_version\t3.4.6-1569965, built on 02/20/2014 09:09 GMT\n" +
+	"zk_avg_latency\t1\n" +
+	"zk_max_latency\t12\n" +
+	"zk_min_latency\t0\n" +
+	"zk_outstanding_requests\t3\n" +
+	"zk_server_state\tleader\n" +
+	"zk_znode_count\t42\n" +
+	"zk_watch_count\t7\n" +
+	"zk_ephemerals_count\t2\n" +
+	"zk_open_file_descriptor_count\t30\n" +
+	"zk_followers\t2\n" +
+	"zk_synced_followers\t2\n"
+
+// Config whose local ZooKeeper answers mntr as the leader.
+func (suite *TestSuiteMetrics) leader(c *C) *Config {
+	return suite.answering(c, leaderMntr)
+}
+
+// Config whose local ZooKeeper answers mntr with the body.
+func (suite *TestSuiteMetrics) answering(c *C, body string) *Config {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	suite.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 4))
+			conn.Write([]byte(body))
+			conn.Close()
+		}
+	}()
+	config := &Config{
+		Hostname: "127.0.0.1",
+		Servers:  []HostPort{HostPort(listener.Addr().String())},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	return config
+}
+
+func scrape(config *Config) string {
+	buff := new(bytes.Buffer)
+	config.Metrics().WriteTo(buff)
+	return buff.String()
+}
+
+func (suite *TestSuiteMetrics) TestMntr(c *C) {
+	config := suite.leader(c)
+	c.Assert(strings.Contains(scrape(config), "zk_up 0\n"), Equals, true)
+	c.Assert(strings.Contains(scrape(config), "zk_znode_count"), Equals, false)
+
+	c.Assert(config.ScrapeMntr(), IsNil)
+	out := scrape(config)
+	for _, line := range []string{
+		"zk_up 1",
+		"zk_avg_latency 1",
+		"zk_max_latency 12",
+		"zk_outstanding_requests 3",
+		"zk_znode_count 42",
+		"zk_watch_count 7",
+		"zk_ephemerals_count 2",
+		"zk_open_file_descriptor_count 30",
+		"zk_followers 2",
+		"zk_synced_followers 2",
+		"zk_leader 1",
+		"# TYPE zk_znode_count gauge",
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing %s", line))
+	}
+
+	suite.listener.Close()
+	c.Assert(config.ScrapeMntr(), NotNil)
+	out = scrape(config)
+	c.Assert(strings.Contains(out, "zk_up 0\n"), Equals, true)
+	c.Assert(strings.Contains(out, "zk_mntr_scrape_errors_total 1\n"), Equals, true)
+}
+
+func (suite *TestSuiteMetrics) TestFollower(c *C) {
+	config := suite.answering(c, "zk_version\t3.4.6-1569965\nzk_server_state\tfollower\nzk_znode_count\t42\n")
+	c.Assert(config.ScrapeMntr(), IsNil)
+	out := scrape(config)
+	c.Assert(strings.Contains(out, "zk_leader 0\n"), Equals, true)
+	c.Assert(strings.Contains(out, "zk_znode_count 42\n"), Equals, true)
+	for _, name := range []string{"zk_followers ", "zk_synced_followers ", "zk_pending_syncs "} {
+		c.Assert(strings.Contains(out, name), Equals, false, Commentf("%s reported by a follower", name))
+	}
+}
+
+func (suite *TestSuiteMetrics) TestBootstrapCounters(c *C) {
+	config := &Config{}
+	config.Exhibitor.countApply(nil)
+	config.Exhibitor.countApply(errors.New("err-rejected"))
+	config.myid = &MyIdFile{}
+	config.myid.recreated.Inc()
+
+	out := scrape(config)
+	for _, line := range []string{
+		"zk_bootstrap_child_restarts_total 0",
+		"zk_bootstrap_myid_recreations_total 1",
+		"zk_bootstrap_config_apply_attempts_total 2",
+		"zk_bootstrap_config_apply_failures_total 1",
+		"# TYPE zk_bootstrap_config_apply_attempts_total counter",
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing %s", line))
+	}
+}
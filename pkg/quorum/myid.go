@@ -3,6 +3,7 @@ package quorum
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/metrics"
 	"github.com/fsnotify/fsnotify"
 	"io/ioutil"
 	"strconv"
@@ -18,8 +19,9 @@ type MyIdFile struct {
 
 	Error <-chan error
 
-	stop chan<- interface{}
-	lock sync.Mutex
+	stop      chan<- interface{}
+	lock      sync.Mutex
+	recreated metrics.Counter
 }
 
 // Reads the file at the path and compares the read value with self.
@@ -43,11 +45,17 @@ func (this *MyIdFile) Close() error {
 	this.lock.Lock()
 	defer this.lock.Unlock()
 	if this.stop != nil {
-		this.stop <- 1
+		close(this.stop)
+		this.stop = nil
 	}
 	return nil
 }
 
+// Number of times the file was recreated after it was removed.
+func (this *MyIdFile) Recreations() int64 {
+	return this.recreated.Get()
+}
+
 // Continuously watching the path and ensures that the file matches the state of the id.
 func (this *MyIdFile) EnsureState() error {
 	this.lock.Lock()
@@ -91,6 +99,7 @@ func (this *MyIdFile) EnsureState() error {
 						error <- err
 						break
 					}
+					this.recreated.Inc()
 				case fsnotify.Write:
 				default:
 				}
@@ -98,10 +107,10 @@ func (this *MyIdFile) EnsureState() error {
 				log.Warn("Error:", err)
 				error <- err
 			case <-stop:
-				break
+				log.Info("Stopped watching ", this.Path)
+				return
 			}
 		}
-		log.Info("Stopped")
 	}()
 
 	this.Error = error
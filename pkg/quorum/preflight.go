@@ -0,0 +1,163 @@
+package quorum
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/datadir"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DataCheckRepair = "repair"
+	DataCheckStrict = "strict"
+	DataCheckOff    = "off"
+
+	// Where torn log tails are moved, in the data directory
+	QuarantineDirName = "quarantine"
+)
+
+// ZooKeeper's data and transaction log directories, as set in the generated zoo.cfg or Exhibitor
+// config.  The log directory is empty if the logs are kept with the snapshots.
+func (this *Config) dataDirectories(generated []byte) (string, string, error) {
+	if this.Mode == ModeNative {
+		settings, _ := parseZooCfg(generated)
+		if settings["dataDir"] == "" {
+			return "", "", newError(ErrInvalidConfig, "zoo.cfg has no dataDir")
+		}
+		return settings["dataDir"], settings["dataLogDir"], nil
+	}
+	config := struct {
+		DataDirectory string `json:"zookeeperDataDirectory"`
+		LogDirectory  string `json:"zookeeperLogDirectory"`
+	}{}
+	if err := json.Unmarshal(generated, &config); err != nil {
+		return "", "", newError(ErrInvalidConfig, "the Exhibitor config is not JSON: %v", err)
+	}
+	if config.DataDirectory == "" {
+		return "", "", newError(ErrInvalidConfig, "the Exhibitor config has no zookeeperDataDirectory")
+	}
+	return config.DataDirectory, config.LogDirectory, nil
+}
+
+// Checks the data directory of the generated config before ZooKeeper starts.  Every transaction
+// log must match its checksums, and in an ensemble the epochs must be consistent with each other
+// and with the last zxid, as ZooKeeper requires to load its database.  The newest log may end in
+// a torn record, written only in part when the server stopped and so never acknowledged.  With
+// DataCheck repair the tail is moved into the quarantine directory and the log is truncated.
+// Older logs were synced before ZooKeeper rolled to the next, so a bad record in them is
+// corruption.  Nothing is repaired if there are other errors.  Returns the problems found, which
+// are logged, and an error of kind ErrBadDataDir if ZooKeeper must not start.  The myid file is
+// checked by Init.
+func (this *Config) CheckDataDir(generated []byte) (Problems, error) {
+	switch this.DataCheck {
+	case "":
+		this.DataCheck = DataCheckRepair
+	case DataCheckOff:
+		return nil, nil
+	case DataCheckRepair, DataCheckStrict:
+	default:
+		return nil, newError(ErrBadDataCheck, "%s", this.DataCheck)
+	}
+
+	dir, logDir, err := this.dataDirectories(generated)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := datadir.Open(dir, logDir)
+	if os.IsNotExist(err) {
+		log.Info("No data directory at ", dir, " to check")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	problems := Problems{}
+	defer func() {
+		for _, p := range problems {
+			if p.Severity == SeverityError {
+				log.Error("Data directory (", p.Check, "): ", p.Message)
+			} else {
+				log.Warn("Data directory (", p.Check, "): ", p.Message)
+			}
+		}
+	}()
+
+	// Like ZooKeeper, fall back to older snapshots if the latest is bad.
+	last := datadir.Zxid(0)
+	readable := false
+	for i := len(dataDir.Snapshots) - 1; i >= 0 && !readable; i-- {
+		file := dataDir.Snapshots[i]
+		if _, err := datadir.ReadSnapshot(file, nil); err != nil {
+			problems.add(SeverityWarning, "snapshot", "%v", err)
+			continue
+		}
+		last = file.Zxid
+		readable = true
+	}
+	if len(dataDir.Snapshots) > 0 && !readable {
+		problems.add(SeverityError, "snapshot", "none of the %d snapshots can be read", len(dataDir.Snapshots))
+	}
+
+	var torn *datadir.LogCheck
+	for i, file := range dataDir.Logs {
+		check, err := datadir.CheckLog(file)
+		if err != nil {
+			return problems, err
+		}
+		if check.LastZxid > last {
+			last = check.LastZxid
+		}
+		newest := i == len(dataDir.Logs)-1
+		switch {
+		case check.Err == nil:
+		case check.Torn && newest && this.DataCheck == DataCheckRepair:
+			torn = check
+		case check.Torn && newest:
+			problems.add(SeverityError, "log", "%s is torn at offset %d after %d txns up to %v.  "+
+				"Use -data_check repair to quarantine the tail", file.Path, check.End, check.Txns, check.LastZxid)
+		default:
+			problems.add(SeverityError, "log", "%v after %d txns up to %v.  The txns after it can't be read",
+				check.Err, check.Txns, check.LastZxid)
+		}
+	}
+
+	// Standalone servers don't use the epochs.
+	if len(this.Voters()) > 1 {
+		accepted, err := dataDir.Epoch(datadir.AcceptedEpochFile)
+		if err != nil {
+			problems.add(SeverityError, "epoch", "%v", err)
+		}
+		current, err := dataDir.Epoch(datadir.CurrentEpochFile)
+		if err != nil {
+			problems.add(SeverityError, "epoch", "%v", err)
+		}
+		if current >= 0 && current < last.Epoch() {
+			problems.add(SeverityError, "epoch", "currentEpoch %d is older than the last zxid %v of epoch %d",
+				current, last, last.Epoch())
+		}
+		if current >= 0 && accepted >= 0 && accepted < current {
+			problems.add(SeverityError, "epoch", "currentEpoch %d is after acceptedEpoch %d", current, accepted)
+		}
+	}
+
+	if errors := problems.errors(); len(errors) > 0 {
+		if torn != nil {
+			problems.add(SeverityWarning, "log", "Not repairing the torn tail of %s because of the errors", torn.Path)
+		}
+		return problems, newError(ErrBadDataDir, "%s: %s", dir, strings.Join(errors, "; "))
+	}
+
+	if torn != nil {
+		path, err := datadir.Quarantine(torn, filepath.Join(dir, QuarantineDirName))
+		if err != nil {
+			return problems, newError(ErrBadDataDir, "quarantining %s: %v", torn.Path, err)
+		}
+		problems.add(SeverityWarning, "log", "%v.  Moved the tail to %s and kept %d txns up to %v",
+			torn.Err, path, torn.Txns, torn.LastZxid)
+	}
+	log.Info("Data directory ", dir, " checked: ", len(dataDir.Snapshots), " snapshots, ",
+		len(dataDir.Logs), " logs, last zxid ", last)
+	return problems, nil
+}
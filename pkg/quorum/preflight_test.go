@@ -0,0 +1,224 @@
+package quorum
+
+import (
+	"fmt"
+	"github.com/conductant/zk/pkg/datadir"
+	"github.com/conductant/zk/pkg/datadir/datadirtest"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type TestSuitePreflight struct {
+}
+
+var _ = Suite(&TestSuitePreflight{})
+
+func (suite *TestSuitePreflight) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuitePreflight) TearDownSuite(c *C) {
+}
+
+func preflightConfig(c *C, servers ...HostPort) *Config {
+	config := &Config{
+		Mode:     ModeNative,
+		Servers:  servers,
+		Hostname: "10.0.0.2",
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	return config
+}
+
+func zooCfg(dir string) []byte {
+	return []byte("tickTime=2000\ndataDir=" + dir + "\nclientPort=2181\n")
+}
+
+// A log of createSession txns with the zxids.
+func writeLog(c *C, f *datadirtest.Fixture, zxids ...int64) string {
+	txns := []*datadir.Txn{}
+	for _, zxid := range zxids {
+		txns = append(txns, &datadir.Txn{Session: 0x100, Zxid: datadir.Zxid(zxid), Type: datadir.TxnCreateSession, Timeout: 30000})
+	}
+	return f.Log(c, txns, 0)
+}
+
+func txnRecord(zxid int64) []byte {
+	return datadirtest.LogRecord(&datadir.Txn{Session: 0x100, Zxid: datadir.Zxid(zxid), Type: datadir.TxnCreateSession, Timeout: 30000})
+}
+
+func appendTo(c *C, path string, buff []byte) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, IsNil)
+	_, err = f.Write(buff)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+}
+
+func size(c *C, path string) int64 {
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	return info.Size()
+}
+
+func (suite *TestSuitePreflight) TestDataDirectories(c *C) {
+	config := preflightConfig(c, "10.0.0.2")
+	dir, logDir, err := config.dataDirectories([]byte("dataDir=/data\ndataLogDir=/logs\n"))
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, "/data")
+	c.Assert(logDir, Equals, "/logs")
+	_, _, err = config.dataDirectories([]byte("tickTime=2000\n"))
+	c.Assert(Cause(err), Equals, ErrInvalidConfig)
+
+	config.Mode = ModeExhibitor
+	dir, logDir, err = config.dataDirectories([]byte(`{"zookeeperDataDirectory":"/data","zookeeperLogDirectory":""}`))
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, "/data")
+	c.Assert(logDir, Equals, "")
+	_, _, err = config.dataDirectories([]byte(`{"serverId":2}`))
+	c.Assert(Cause(err), Equals, ErrInvalidConfig)
+}
+
+func (suite *TestSuitePreflight) TestClean(c *C) {
+	config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+
+	// Nothing to check before the first start
+	problems, err := config.CheckDataDir(zooCfg(filepath.Join(c.MkDir(), "missing")))
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+
+	f := datadirtest.NewFixture(c)
+	f.Write(c, datadir.MyIdFile, []byte("1"))
+	f.Epochs(c, "2", "2")
+	f.Snapshot(c, 0x100000000, nil, nil)
+	writeLog(c, f, 0x100000001, 0x100000002)
+	writeLog(c, f, 0x200000001)
+	problems, err = config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+	c.Assert(config.DataCheck, Equals, DataCheckRepair)
+
+	config.DataCheck = "fix"
+	_, err = config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(Cause(err), Equals, ErrBadDataCheck)
+}
+
+func (suite *TestSuitePreflight) TestExhibitorDataDir(c *C) {
+	f := datadirtest.NewFixture(c)
+	path := writeLog(c, f, 0x100000001)
+	appendTo(c, path, txnRecord(0x100000002)[:19])
+
+	// The directory comes from the config, not from where the myid file is.
+	config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	config.Mode = ModeExhibitor
+	config.MyIdPath = filepath.Join(c.MkDir(), "myid")
+	config.DataCheck = DataCheckStrict
+	_, err := config.CheckDataDir([]byte(fmt.Sprintf(`{"zookeeperDataDirectory":%q}`, f.Dir)))
+	c.Assert(Cause(err), Equals, ErrBadDataDir)
+}
+
+func (suite *TestSuitePreflight) TestTornTail(c *C) {
+	f := datadirtest.NewFixture(c)
+	writeLog(c, f, 0x100000001)
+	path := writeLog(c, f, 0x100000002, 0x100000003)
+	good := size(c, path)
+	torn := txnRecord(0x100000004)[:19] // Ends in a byte that is not zero
+	appendTo(c, path, append(append([]byte{}, torn...), make([]byte, 512)...))
+
+	config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	config.DataCheck = DataCheckStrict
+	problems, err := config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(Cause(err), Equals, ErrBadDataDir)
+	c.Assert(problems, HasLen, 1)
+	c.Assert(problems[0].Message, Matches, ".*torn at offset.*")
+
+	config.DataCheck = DataCheckRepair
+	problems, err = config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 1)
+	c.Assert(problems[0].Severity, Equals, SeverityWarning)
+
+	quarantined := filepath.Join(f.Dir, QuarantineDirName, fmt.Sprintf("%s.%d", filepath.Base(path), good))
+	buff, err := ioutil.ReadFile(quarantined)
+	c.Assert(err, IsNil)
+	c.Assert(buff, DeepEquals, torn)
+	c.Assert(size(c, path), Equals, good)
+
+	// Clean once repaired
+	problems, err = config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+}
+
+func (suite *TestSuitePreflight) TestTornOlderLog(c *C) {
+	f := datadirtest.NewFixture(c)
+	older := writeLog(c, f, 0x100000001)
+	appendTo(c, older, append(txnRecord(0x100000002)[:19], make([]byte, 512)...))
+	before := size(c, older)
+	writeLog(c, f, 0x100000003)
+
+	// ZooKeeper synced the older log before starting the newer, so its last record was committed.
+	config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	problems, err := config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(Cause(err), Equals, ErrBadDataDir)
+	c.Assert(problems, HasLen, 1)
+	c.Assert(problems[0].Message, Matches, "err-truncated:.*"+filepath.Base(older)+" at offset .*")
+	c.Assert(size(c, older), Equals, before)
+	_, err = os.Stat(filepath.Join(f.Dir, QuarantineDirName))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (suite *TestSuitePreflight) TestCorrupt(c *C) {
+	f := datadirtest.NewFixture(c)
+	bad := txnRecord(0x100000002)
+	bad[20] ^= 0xff
+	path := writeLog(c, f, 0x100000001)
+	appendTo(c, path, append(bad, txnRecord(0x100000003)...))
+	torn := writeLog(c, f, 0x200000001)
+	appendTo(c, torn, txnRecord(0x200000002)[:19])
+	before := size(c, torn)
+
+	config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	problems, err := config.CheckDataDir(zooCfg(f.Dir))
+	c.Assert(Cause(err), Equals, ErrBadDataDir)
+	c.Assert(problems.Count(SeverityError), Equals, 1)
+	c.Assert(problems[0].Message, Matches, "err-bad-crc:.*"+filepath.Base(path)+" at offset .*")
+
+	// Nothing is repaired while there are errors.
+	c.Assert(size(c, torn), Equals, before)
+}
+
+func (suite *TestSuitePreflight) TestEpochs(c *C) {
+	for _, t := range []struct {
+		accepted, current string
+		ok                bool
+	}{
+		{"2", "2", true},
+		{"3", "2", true},
+		{"", "", true},
+		{"2", "1", false},
+		{"1", "2", false},
+		{"2", "x", false},
+	} {
+		f := datadirtest.NewFixture(c)
+		if t.accepted != "" {
+			f.Epochs(c, t.accepted, t.current)
+		}
+		writeLog(c, f, 0x200000001)
+
+		config := preflightConfig(c, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+		problems, err := config.CheckDataDir(zooCfg(f.Dir))
+		if t.ok {
+			c.Assert(err, IsNil, Commentf("%v", t))
+			continue
+		}
+		c.Assert(Cause(err), Equals, ErrBadDataDir, Commentf("%v", t))
+		c.Assert(problems[0].Check, Equals, "epoch")
+
+		// Standalone servers don't use the epochs.
+		config = preflightConfig(c, "10.0.0.2")
+		_, err = config.CheckDataDir(zooCfg(f.Dir))
+		c.Assert(err, IsNil, Commentf("%v", t))
+	}
+}
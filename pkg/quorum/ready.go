@@ -0,0 +1,279 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/fourletter"
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReadyPollInterval    = 5 * time.Second
+	DefaultReadyPollIntervalMax = 30 * time.Second
+
+	// Events buffered per subscriber.  Events are dropped for subscribers that fall behind.
+	EventBufferSize = 16
+)
+
+// State of the child process as seen by the readiness monitor.
+type State string
+
+const (
+	StateStarting    State = "starting"     // Nothing answers yet
+	StateExhibitorUp State = "exhibitor-up" // Exhibitor answers, ZooKeeper doesn't
+	StateZkUp        State = "zk-up"        // ZooKeeper answers but doesn't serve clients
+	StateInQuorum    State = "in-quorum"    // ZooKeeper serves as leader, follower, observer or standalone
+	StateDegraded    State = "degraded"     // Was in quorum, isn't anymore
+	StateStopped     State = "stopped"      // Monitoring stopped with the child
+)
+
+// A transition of the readiness monitor.  Error is the last probe error, if any.
+type StateChange struct {
+	Time  time.Time `json:"time"`
+	From  State     `json:"from"`
+	To    State     `json:"to"`
+	Error string    `json:"error,omitempty"`
+}
+
+type probeFunc func(ctx context.Context) (State, error)
+
+// Polls the child process until its context is cancelled.  The poll interval starts at
+// interval and doubles up to max while the state doesn't change.
+type monitor struct {
+	name     string
+	probe    probeFunc
+	interval time.Duration
+	max      time.Duration
+
+	started     time.Time
+	state       State
+	err         error
+	inQuorum    bool
+	changed     chan interface{} // Closed and replaced on every change
+	stopped     chan interface{}
+	subscribers map[chan StateChange]bool
+	lock        sync.Mutex
+}
+
+func newMonitor(name string, probe probeFunc, interval, max time.Duration) *monitor {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if max < interval {
+		max = interval
+	}
+	return &monitor{
+		name:        name,
+		probe:       probe,
+		interval:    interval,
+		max:         max,
+		started:     time.Now(),
+		state:       StateStarting,
+		changed:     make(chan interface{}),
+		stopped:     make(chan interface{}),
+		subscribers: map[chan StateChange]bool{},
+	}
+}
+
+func (this *monitor) run(ctx context.Context) {
+	log.Info("Started monitoring for ", this.name, " to come up.")
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	backoff := this.interval
+	for {
+		select {
+		case <-ctx.Done():
+			this.set(StateStopped, nil)
+			log.Info("Stopped monitoring ", this.name, ".")
+			return
+		case <-timer.C:
+		}
+
+		state, err := this.probe(ctx)
+		if ctx.Err() != nil {
+			continue
+		}
+		if this.set(state, err) {
+			backoff = this.interval
+		} else if backoff *= 2; backoff > this.max {
+			backoff = this.max
+		}
+		timer.Reset(backoff)
+	}
+}
+
+// Records the probed state.  Returns true if the state changed.
+func (this *monitor) set(state State, err error) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.err = err
+	if state == StateInQuorum {
+		this.inQuorum = true
+	} else if this.inQuorum && state != StateStopped {
+		state = StateDegraded
+	}
+	if state == this.state {
+		return false
+	}
+
+	change := StateChange{Time: time.Now(), From: this.state, To: state}
+	if err != nil {
+		change.Error = err.Error()
+	}
+	log.Info(this.name, ": ", change.From, " -> ", change.To)
+
+	this.state = state
+	close(this.changed)
+	this.changed = make(chan interface{})
+	for ch := range this.subscribers {
+		select {
+		case ch <- change:
+		default:
+		}
+		if state == StateStopped {
+			delete(this.subscribers, ch)
+			close(ch)
+		}
+	}
+	if state == StateStopped {
+		close(this.stopped)
+	}
+	return true
+}
+
+func (this *monitor) get() (State, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.state, this.err
+}
+
+// Blocks until reached returns true for the state.  Returns an error of kind timeoutErr if
+// timeout elapses since monitoring started, ErrNotRunning if monitoring stops first, or the
+// context's error.
+func (this *monitor) wait(ctx context.Context, reached func(State) bool, timeout time.Duration, timeoutErr error) error {
+	parent := ctx
+	if timeout > 0 {
+		c, cancel := context.WithDeadline(ctx, this.started.Add(timeout))
+		defer cancel()
+		ctx = c
+	}
+	for {
+		this.lock.Lock()
+		state, changed := this.state, this.changed
+		this.lock.Unlock()
+
+		if reached(state) {
+			return nil
+		}
+		if state == StateStopped {
+			return newError(ErrNotRunning, "%s stopped", this.name)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			state, err := this.get()
+			if err != nil {
+				return newError(timeoutErr, "%s after %v: %v", this.describe(state), timeout, err)
+			}
+			return newError(timeoutErr, "%s after %v", this.describe(state), timeout)
+		}
+	}
+}
+
+// Why the child isn't ready in the state.
+func (this *monitor) describe(state State) string {
+	switch state {
+	case StateStarting:
+		return this.name + " never answered"
+	case StateExhibitorUp:
+		return "ZooKeeper did not start"
+	case StateZkUp:
+		return "ZooKeeper did not join the quorum"
+	case StateDegraded:
+		return "ZooKeeper lost the quorum"
+	}
+	return this.name + " " + string(state)
+}
+
+// Subscribes to state changes until the context is done or monitoring stops, when the
+// channel is closed.
+func (this *monitor) events(ctx context.Context) <-chan StateChange {
+	ch := make(chan StateChange, EventBufferSize)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.state == StateStopped {
+		close(ch)
+		return ch
+	}
+	this.subscribers[ch] = true
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-this.stopped:
+		}
+		this.lock.Lock()
+		defer this.lock.Unlock()
+		if this.subscribers[ch] {
+			delete(this.subscribers, ch)
+			close(ch)
+		}
+	}()
+	return ch
+}
+
+// Starts a monitor that stops when the supervisor is done or cancel is called.
+func startMonitor(name string, probe probeFunc, interval, max time.Duration,
+	supervisor *Supervisor) (*monitor, context.CancelFunc) {
+
+	m := newMonitor(name, probe, interval, max)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-supervisor.Done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go m.run(ctx)
+	return m, cancel
+}
+
+func closedEvents() <-chan StateChange {
+	ch := make(chan StateChange)
+	close(ch)
+	return ch
+}
+
+func exhibitorUp(state State) bool {
+	return state != StateStarting && state != StateStopped
+}
+
+func zkInQuorum(state State) bool {
+	return state == StateInQuorum
+}
+
+// Asks the ZooKeeper at addr for its mode.  down is the state if it doesn't answer.
+func probeZk(addr string, timeout time.Duration, down State) (State, error) {
+	client := fourletter.NewClient(addr)
+	if timeout > 0 {
+		client.Timeout = timeout
+	}
+	stat, err := client.Srvr()
+	if err == fourletter.ErrNotServing {
+		return StateZkUp, nil
+	}
+	if err != nil {
+		return down, err
+	}
+	log.Debug("ZooKeeper mode=", stat.Mode, ",zxid=", stat.Zxid)
+	if stat.Serving() {
+		return StateInQuorum, nil
+	}
+	return StateZkUp, nil
+}
@@ -0,0 +1,157 @@
+package quorum
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"sync"
+	"time"
+)
+
+type TestSuiteReady struct {
+}
+
+var _ = Suite(&TestSuiteReady{})
+
+func (suite *TestSuiteReady) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteReady) TearDownSuite(c *C) {
+}
+
+// Probe returning the states in turn, then the last one forever.
+type scriptedProbe struct {
+	states []State
+	err    error
+	calls  []time.Time
+	lock   sync.Mutex
+}
+
+func (this *scriptedProbe) probe(ctx context.Context) (State, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.calls = append(this.calls, time.Now())
+	state := this.states[0]
+	if len(this.states) > 1 {
+		this.states = this.states[1:]
+	}
+	return state, this.err
+}
+
+func (this *scriptedProbe) set(err error, states ...State) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.states = states
+	this.err = err
+}
+
+func startScripted(probe *scriptedProbe, interval, max time.Duration) (*monitor, context.CancelFunc) {
+	m := newMonitor("test", probe.probe, interval, max)
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.run(ctx)
+	return m, cancel
+}
+
+func (suite *TestSuiteReady) TestTransitions(c *C) {
+	probe := &scriptedProbe{states: []State{StateStarting, StateExhibitorUp, StateZkUp, StateInQuorum}}
+	m := newMonitor("test", probe.probe, time.Millisecond, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := m.events(context.Background())
+	go m.run(ctx)
+
+	c.Assert(m.wait(context.Background(), exhibitorUp, time.Second, ErrExhibitorTimeout), IsNil)
+	c.Assert(m.wait(context.Background(), zkInQuorum, time.Second, ErrExhibitorTimeout), IsNil)
+
+	probe.set(errors.New("err-connection-refused"), StateExhibitorUp)
+	c.Assert(m.wait(context.Background(), func(s State) bool { return s == StateDegraded }, time.Second, ErrZkTimeout), IsNil)
+	state, err := m.get()
+	c.Assert(state, Equals, StateDegraded)
+	c.Assert(err, ErrorMatches, "err-connection-refused")
+
+	// Back in quorum
+	probe.set(nil, StateInQuorum)
+	c.Assert(m.wait(context.Background(), zkInQuorum, time.Second, ErrZkTimeout), IsNil)
+
+	cancel()
+	changes := []StateChange{}
+	for change := range events {
+		changes = append(changes, change)
+	}
+	transitions := []State{}
+	for _, change := range changes {
+		transitions = append(transitions, change.To)
+	}
+	c.Assert(transitions, DeepEquals, []State{
+		StateExhibitorUp, StateZkUp, StateInQuorum, StateDegraded, StateInQuorum, StateStopped,
+	})
+	c.Assert(changes[3].From, Equals, StateInQuorum)
+	c.Assert(changes[3].Error, Equals, "err-connection-refused")
+
+	err = m.wait(context.Background(), zkInQuorum, time.Second, ErrZkTimeout)
+	c.Assert(Cause(err), Equals, ErrNotRunning)
+}
+
+func (suite *TestSuiteReady) TestTimeout(c *C) {
+	probe := &scriptedProbe{states: []State{StateStarting}, err: errors.New("err-connection-refused")}
+	m, cancel := startScripted(probe, time.Millisecond, 5*time.Millisecond)
+	defer cancel()
+
+	err := m.wait(context.Background(), exhibitorUp, 50*time.Millisecond, ErrExhibitorTimeout)
+	c.Assert(Cause(err), Equals, ErrExhibitorTimeout)
+	c.Assert(err, ErrorMatches, "err-exhibitor-timeout:test never answered after 50ms: err-connection-refused")
+}
+
+func (suite *TestSuiteReady) TestCancel(c *C) {
+	probe := &scriptedProbe{states: []State{StateStarting}}
+	m, cancel := startScripted(probe, time.Millisecond, 5*time.Millisecond)
+	defer cancel()
+
+	ctx, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	err := m.wait(ctx, exhibitorUp, time.Minute, ErrExhibitorTimeout)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+func (suite *TestSuiteReady) TestBackoff(c *C) {
+	probe := &scriptedProbe{states: []State{StateStarting}}
+	m, cancel := startScripted(probe, 10*time.Millisecond, 40*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	m.wait(context.Background(), func(s State) bool { return s == StateStopped }, 0, nil)
+
+	probe.lock.Lock()
+	defer probe.lock.Unlock()
+	// Polls at 0, 10, 30, 70, 110, 150, 190ms instead of every 10ms
+	c.Assert(len(probe.calls) >= 5 && len(probe.calls) <= 8, Equals, true, Commentf("%d polls", len(probe.calls)))
+	c.Assert(probe.calls[3].Sub(probe.calls[2]) >= 40*time.Millisecond, Equals, true)
+}
+
+func (suite *TestSuiteReady) TestSupervisorStopped(c *C) {
+	supervisor := &Supervisor{
+		Name:            "sleeper",
+		Command:         []string{"sleep", "60"},
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	probe := &scriptedProbe{states: []State{StateStarting}}
+	m, cancel := startMonitor("test", probe.probe, time.Millisecond, 5*time.Millisecond, supervisor)
+	defer cancel()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		supervisor.Stop()
+	}()
+	err := m.wait(context.Background(), exhibitorUp, time.Minute, ErrExhibitorTimeout)
+	c.Assert(Cause(err), Equals, ErrNotRunning)
+}
+
+func (suite *TestSuiteReady) TestNotStarted(c *C) {
+	e := &Exhibitor{}
+	c.Assert(e.WaitReady(context.Background()), Equals, ErrNotRunning)
+	_, open := <-e.Events(context.Background())
+	c.Assert(open, Equals, false)
+
+	z := &ZooKeeper{}
+	c.Assert(z.WaitZkRunning(context.Background()), Equals, ErrNotRunning)
+}
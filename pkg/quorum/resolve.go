@@ -0,0 +1,223 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/discovery"
+	"github.com/conductant/zk/pkg/metrics"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConfigHostsNames = "names"
+	ConfigHostsIps   = "ips"
+
+	DefaultResolveInterval = time.Minute
+)
+
+// Addresses of the members, by host as given.
+type resolvedHosts struct {
+	addrs   map[string][]string
+	changes metrics.Counter
+	lock    sync.Mutex
+}
+
+func (this *resolvedHosts) get(host string) []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.addrs[host]
+}
+
+// Records the addresses and returns the previous ones.
+func (this *resolvedHosts) set(host string, addrs []string) []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.addrs == nil {
+		this.addrs = map[string][]string{}
+	}
+	prev := this.addrs[host]
+	this.addrs[host] = addrs
+	return prev
+}
+
+func (this *Config) getResolver() discovery.Resolver {
+	if this.resolver == nil {
+		return discovery.DefaultResolver
+	}
+	return this.resolver
+}
+
+// Sorted addresses of the host.  An address resolves to itself.
+func (this *Config) resolveHost(host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	addrs, err := this.getResolver().LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, addr := range addrs {
+		list = append(list, canonicalHost(addr))
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Addresses of the local network interfaces.
+func localAddrs() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			list = append(list, ipnet.IP.String())
+		}
+	}
+	return list, nil
+}
+
+// Resolves the names of the members.  Members that don't resolve are logged and left out, so
+// they can't be matched as this host.
+func (this *Config) resolveMembers() {
+	for _, s := range this.ensemble {
+		addrs, err := this.resolveHost(s.Ip)
+		if err != nil {
+			log.Warn("Cannot resolve ", s.Ip, ": ", err)
+			continue
+		}
+		this.resolved.set(s.Ip, addrs)
+	}
+}
+
+// Finds the member that is this host.  Hostname is matched against the members as given,
+// then by the addresses it resolves to, then by the addresses of the local interfaces other
+// than loopback and link-local ones.  Returns an error of kind ErrSelfNotInEnsemble if no
+// member matches.
+func (this *Config) findSelf() (*Server, error) {
+	host := canonicalHost(this.Hostname)
+	for _, s := range this.ensemble {
+		if s.Ip == host {
+			return s, nil
+		}
+	}
+
+	this.resolveMembers()
+	if addrs, err := this.resolveHost(host); err == nil {
+		if s, err := this.matchAddrs(addrs); s != nil || err != nil {
+			return s, err
+		}
+	} else {
+		log.Warn("Cannot resolve ", host, ": ", err)
+	}
+
+	addrs, err := this.interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	if s, err := this.matchAddrs(addrs); s != nil || err != nil {
+		return s, err
+	}
+	return nil, newError(ErrSelfNotInEnsemble, "-ip %s matches no member", this.Hostname)
+}
+
+// The one member with any of the addresses.
+func (this *Config) matchAddrs(addrs []string) (*Server, error) {
+	who := this.Hostname
+	if who == "" {
+		who = "this host at " + strings.Join(addrs, ",")
+	}
+	mine := map[string]bool{}
+	for _, addr := range addrs {
+		mine[addr] = true
+	}
+	matches := []*Server{}
+	for _, s := range this.ensemble {
+		for _, addr := range this.resolved.get(s.Ip) {
+			if mine[addr] {
+				matches = append(matches, s)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		log.Info("This host ", who, " is ", matches[0].Ip)
+		return matches[0], nil
+	}
+	hosts := []string{}
+	for _, s := range matches {
+		hosts = append(hosts, s.Ip)
+	}
+	return nil, newError(ErrAmbiguousSelf, "%s matches %s", who, strings.Join(hosts, ","))
+}
+
+// Host of the member for generated configs, as given or its address depending on ConfigHosts.
+func (this *Config) configHost(s *Server) string {
+	if this.ConfigHosts != ConfigHostsIps {
+		return s.Ip
+	}
+	if addrs := this.resolved.get(s.Ip); len(addrs) > 0 {
+		return addrs[0]
+	}
+	if addrs, err := this.resolveHost(s.Ip); err == nil && len(addrs) > 0 {
+		this.resolved.set(s.Ip, addrs)
+		return addrs[0]
+	}
+	log.Warn("Cannot resolve ", s.Ip, ".  Using the name.")
+	return s.Ip
+}
+
+// Re-resolves the members every ResolveInterval until the supervised child is done, and
+// reports members whose addresses changed.
+func (this *Config) watchAddresses() {
+	if this.ResolveInterval <= 0 {
+		return
+	}
+	done := this.Supervisor.Done
+	go func() {
+		ticker := time.NewTicker(this.ResolveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				this.CheckAddresses()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Re-resolves the members and returns those whose addresses changed since the last time.
+func (this *Config) CheckAddresses() []string {
+	changed := []string{}
+	for _, s := range this.ensemble {
+		if net.ParseIP(s.Ip) != nil {
+			continue
+		}
+		addrs, err := this.resolveHost(s.Ip)
+		if err != nil {
+			log.Warn("Cannot resolve ", s.Ip, ": ", err)
+			continue
+		}
+		prev := this.resolved.set(s.Ip, addrs)
+		if prev != nil && !reflect.DeepEqual(prev, addrs) {
+			err := newError(ErrAddressChanged, "%s moved from %s to %s", s.Ip,
+				strings.Join(prev, ","), strings.Join(addrs, ","))
+			log.Warn(err)
+			this.recent.add("dns", err)
+			this.resolved.changes.Inc()
+			changed = append(changed, s.Ip)
+		}
+	}
+	return changed
+}
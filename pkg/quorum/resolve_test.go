@@ -0,0 +1,149 @@
+package quorum
+
+import (
+	"errors"
+	. "gopkg.in/check.v1"
+	"net"
+	"sync"
+)
+
+type TestSuiteResolve struct {
+}
+
+var _ = Suite(&TestSuiteResolve{})
+
+func (suite *TestSuiteResolve) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteResolve) TearDownSuite(c *C) {
+}
+
+type staticResolver struct {
+	hosts map[string][]string
+	lock  sync.Mutex
+}
+
+func (this *staticResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return "", nil, errors.New("no such host")
+}
+
+func (this *staticResolver) LookupHost(host string) ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if addrs, has := this.hosts[host]; has {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host: " + host)
+}
+
+func (this *staticResolver) set(host string, addrs ...string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.hosts[host] = addrs
+}
+
+func noLocalAddrs() ([]string, error) {
+	return nil, nil
+}
+
+func newResolver() *staticResolver {
+	return &staticResolver{hosts: map[string][]string{
+		"zk-1.internal": []string{"10.0.0.1"},
+		"zk-2.internal": []string{"10.0.0.2"},
+		"zk-3.internal": []string{"10.0.0.3", "fd00::3"},
+	}}
+}
+
+func (suite *TestSuiteResolve) TestNameForIp(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		Hostname:   "zk-2.internal",
+		resolver:   newResolver(),
+		localAddrs: noLocalAddrs,
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 2)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.1,S:2:0.0.0.0,S:3:10.0.0.3")
+}
+
+func (suite *TestSuiteResolve) TestIpForName(c *C) {
+	config := &Config{
+		Servers:    []HostPort{"zk-1.internal", "zk-2.internal", "zk-3.internal"},
+		Hostname:   "fd00::3",
+		resolver:   newResolver(),
+		localAddrs: noLocalAddrs,
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 3)
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:zk-1.internal,S:2:zk-2.internal,S:3:0.0.0.0")
+	c.Assert(config.GetZkHosts(), Equals, "zk-1.internal:2181,zk-2.internal:2181,zk-3.internal:2181")
+
+	config.ConfigHosts = ConfigHostsIps
+	c.Assert(config.GetZkServersSpec(), Equals, "S:1:10.0.0.1,S:2:10.0.0.2,S:3:0.0.0.0")
+	c.Assert(config.GetZkServers(), Equals,
+		"server.1=10.0.0.1:2888:3888\nserver.2=10.0.0.2:2888:3888\nserver.3=0.0.0.0:2888:3888")
+}
+
+func (suite *TestSuiteResolve) TestLocalInterfaces(c *C) {
+	config := &Config{
+		Servers:  []HostPort{"zk-1.internal", "zk-2.internal", "zk-3.internal"},
+		Hostname: "public.example.com",
+		resolver: newResolver(),
+		localAddrs: func() ([]string, error) {
+			return []string{"127.0.0.1", "10.0.0.1"}, nil
+		},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(myId(c, config), Equals, 1)
+}
+
+func (suite *TestSuiteResolve) TestNotLoopback(c *C) {
+	resolver := newResolver()
+	resolver.set("localhost", "127.0.0.1")
+	config := &Config{
+		Servers:  []HostPort{"localhost", "zk-2.internal", "zk-3.internal"},
+		Hostname: "10.0.0.11", // Mistyped
+		resolver: resolver,
+		localAddrs: func() ([]string, error) {
+			return []string{"127.0.0.1", "fe80::1", "10.0.0.9"}, nil
+		},
+	}
+	c.Assert(Cause(config.InitEnsemble()), Equals, ErrSelfNotInEnsemble)
+}
+
+func (suite *TestSuiteResolve) TestAmbiguous(c *C) {
+	resolver := newResolver()
+	resolver.set("zk-2.internal", "10.0.0.1")
+	config := &Config{
+		Servers:    []HostPort{"zk-1.internal", "zk-2.internal"},
+		Hostname:   "10.0.0.1",
+		resolver:   resolver,
+		localAddrs: noLocalAddrs,
+	}
+	err := config.InitEnsemble()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "err-ambiguous-self:10.0.0.1 matches zk-1.internal,zk-2.internal")
+}
+
+func (suite *TestSuiteResolve) TestCheckAddresses(c *C) {
+	resolver := newResolver()
+	config := &Config{
+		Servers:    []HostPort{"zk-1.internal", "zk-2.internal", "10.0.0.5"},
+		Hostname:   "zk-1.internal",
+		resolver:   resolver,
+		localAddrs: noLocalAddrs,
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.CheckAddresses(), HasLen, 0)
+	c.Assert(config.CheckAddresses(), HasLen, 0)
+
+	resolver.set("zk-2.internal", "10.0.0.22")
+	c.Assert(config.CheckAddresses(), DeepEquals, []string{"zk-2.internal"})
+	c.Assert(config.CheckAddresses(), HasLen, 0)
+	c.Assert(config.resolved.changes.Get(), Equals, int64(1))
+
+	errs := config.RecentErrors()
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].Source, Equals, "dns")
+	c.Assert(errs[0].Error, Equals, "err-address-changed:zk-2.internal moved from 10.0.0.2 to 10.0.0.22")
+}
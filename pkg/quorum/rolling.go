@@ -0,0 +1,160 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/exhibitor"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRollingTimeout = 30 * time.Minute
+)
+
+// Voting members of the ensemble, by the host names the other members know them by.  Unlike in
+// the generated configs, this host is not replaced by the address to bind to.
+func (this *Config) Voters() []string {
+	list := []string{}
+	for _, s := range this.ensemble {
+		if !s.Observer {
+			list = append(list, this.configHost(s))
+		}
+	}
+	return list
+}
+
+// Applies the config as a rolling change across the ensemble.
+func (this *Config) ApplyConfigRolling(ctx context.Context, authToken string, config []byte) error {
+	return this.Exhibitor.ApplyConfigRolling(ctx, authToken, config, this.Voters())
+}
+
+// Applies the config through Exhibitor's config/set-rolling so that servers restart one at a
+// time.  Blocks until the roll is complete and every server is serving again.  If fewer than a
+// majority of the voters before the change are serving at any point, the roll is rolled back and
+// an error of kind ErrQuorumLost is returned.  voters, those of the new config, are only used if
+// Exhibitor doesn't report its current servers.
+func (this *Exhibitor) ApplyConfigRolling(ctx context.Context, authToken string, config []byte, voters []string) error {
+	return this.countApply(exhibitorError(this.applyConfigRolling(ctx, authToken, config, voters)))
+}
+
+func (this *Exhibitor) applyConfigRolling(ctx context.Context, authToken string, config []byte, voters []string) error {
+	client, err := this.Client()
+	if err != nil {
+		return err
+	}
+	client.AuthToken = authToken
+
+	// Members being added don't serve until they are rolled, so the quorum to keep is that of
+	// the ensemble before the change.
+	if current, err := client.GetState(ctx); err != nil {
+		log.Warn("Cannot get the current servers: ", err)
+	} else if spec := specVoters(current.Config.ServersSpec); len(spec) > 0 {
+		voters = spec
+	}
+
+	if err := client.SetConfigRolling(ctx, config); err != nil {
+		return err
+	}
+	log.Info("Rolling config change started.")
+
+	interval := this.ReadyPollInterval.Duration
+	if interval <= 0 {
+		interval = DefaultReadyPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn("Timed out waiting for rolling config change.  Rolling back.")
+			if err := client.RollbackRolling(context.Background()); err != nil {
+				log.Warn("Rollback failed: ", err)
+			}
+			return newError(ErrRollingTimeout, "%v", ctx.Err())
+
+		case <-ticker.C:
+		}
+
+		state, err := client.GetRollingState(ctx)
+		if err != nil {
+			log.Warn("Cannot get rolling state: ", err)
+			continue
+		}
+		statuses, err := client.ClusterStatus(ctx)
+		if err != nil {
+			log.Warn("Cannot get cluster status: ", err)
+			continue
+		}
+
+		serving, total := countServing(statuses, voters)
+		log.Info("Rolling: inProgress=", state.RollInProgress, ",done=", state.RollPercentDone,
+			"%,status=", state.RollStatus, ",serving=", serving, "/", total)
+
+		if serving < total/2+1 {
+			log.Warn("Quorum lost during rolling config change.  Rolling back.")
+			if err := client.RollbackRolling(ctx); err != nil {
+				log.Warn("Rollback failed: ", err)
+			}
+			return newError(ErrQuorumLost, "%d of %d voters serving", serving, total)
+		}
+
+		if !state.RollInProgress && allServing(statuses) {
+			log.Info("Rolling config change complete.")
+			return nil
+		}
+	}
+}
+
+// Counts the voters that are serving.  If none of the reported hosts match the voters, all
+// reported hosts are counted.
+func countServing(statuses []exhibitor.ServerStatus, voters []string) (serving, total int) {
+	isVoter := map[string]bool{}
+	for _, v := range voters {
+		isVoter[v] = true
+	}
+	matched := 0
+	for _, s := range statuses {
+		if isVoter[s.Hostname] {
+			matched++
+		}
+	}
+	for _, s := range statuses {
+		if matched > 0 && !isVoter[s.Hostname] {
+			continue
+		}
+		total++
+		if s.Serving() {
+			serving++
+		}
+	}
+	if matched > 0 {
+		total = len(voters)
+	}
+	return
+}
+
+// Voting members in an Exhibitor servers spec, e.g. S:1:zk1,S:2:zk2,O:3:zk3.
+func specVoters(spec string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		switch {
+		case len(parts) == 2:
+			list = append(list, parts[1])
+		case len(parts) == 3 && parts[0] != "O":
+			list = append(list, parts[2])
+		}
+	}
+	return list
+}
+
+func allServing(statuses []exhibitor.ServerStatus) bool {
+	for _, s := range statuses {
+		if !s.Serving() {
+			return false
+		}
+	}
+	return len(statuses) > 0
+}
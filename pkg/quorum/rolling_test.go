@@ -0,0 +1,166 @@
+package quorum
+
+import (
+	"fmt"
+	"github.com/conductant/gohm/pkg/encoding"
+	"github.com/conductant/zk/pkg/exhibitor"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+type TestSuiteRolling struct {
+}
+
+var _ = Suite(&TestSuiteRolling{})
+
+func (suite *TestSuiteRolling) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteRolling) TearDownSuite(c *C) {
+}
+
+// Fake Exhibitor that replays a list of cluster statuses, one per poll.
+type fakeRollingExhibitor struct {
+	spec       string
+	statuses   []string
+	polls      int
+	rolledBack bool
+	lock       sync.Mutex
+}
+
+func (this *fakeRollingExhibitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	switch r.URL.Path {
+	case "/exhibitor/v1/config/set-rolling":
+		w.Write([]byte(`{"message":"OK","succeeded":true}`))
+	case "/exhibitor/v1/config/rollback-rolling":
+		this.rolledBack = true
+		w.Write([]byte(`{"message":"OK","succeeded":true}`))
+	case "/exhibitor/v1/config/get-state":
+		if this.polls < len(this.statuses)-1 {
+			fmt.Fprintf(w, `{"running":true,"config":{"serversSpec":%q,"rollInProgress":true,"rollPercentDone":50}}`, this.spec)
+		} else {
+			fmt.Fprintf(w, `{"running":true,"config":{"serversSpec":%q,"rollInProgress":false}}`, this.spec)
+		}
+	case "/exhibitor/v1/cluster/status":
+		i := this.polls
+		if i >= len(this.statuses) {
+			i = len(this.statuses) - 1
+		}
+		this.polls++
+		w.Write([]byte(this.statuses[i]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func rollingExhibitor(url string) *Exhibitor {
+	return &Exhibitor{
+		Endpoint:          url,
+		ReadyPollInterval: encoding.Duration{Duration: 10 * time.Millisecond},
+	}
+}
+
+func (suite *TestSuiteRolling) TestRollingComplete(c *C) {
+	fake := &fakeRollingExhibitor{
+		statuses: []string{
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":1},{"hostname":"10.0.0.3","code":3}]`,
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":3},{"hostname":"10.0.0.3","code":3}]`,
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := rollingExhibitor(server.URL).ApplyConfigRolling(ctx, "", []byte(`{}`),
+		[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+	c.Assert(err, IsNil)
+	c.Assert(fake.rolledBack, Equals, false)
+}
+
+func (suite *TestSuiteRolling) TestRollingQuorumLost(c *C) {
+	fake := &fakeRollingExhibitor{
+		statuses: []string{
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":1},{"hostname":"10.0.0.3","code":2}]`,
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":3},{"hostname":"10.0.0.3","code":3}]`,
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := rollingExhibitor(server.URL).ApplyConfigRolling(ctx, "", []byte(`{}`),
+		[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+	c.Assert(Cause(err), Equals, ErrQuorumLost)
+	c.Assert(fake.rolledBack, Equals, true)
+}
+
+func (suite *TestSuiteRolling) TestRollingGrow(c *C) {
+	// From 3 to 5 voters.  The new members are down until rolled, and quorum is kept by 2 of the
+	// 3 current members while 10.0.0.2 restarts.
+	fake := &fakeRollingExhibitor{
+		spec: "S:1:10.0.0.1,S:2:10.0.0.2,S:3:10.0.0.3",
+		statuses: []string{
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":1},{"hostname":"10.0.0.3","code":3},` +
+				`{"hostname":"10.0.0.4","code":1},{"hostname":"10.0.0.5","code":1}]`,
+			`[{"hostname":"10.0.0.1","code":3},{"hostname":"10.0.0.2","code":3},{"hostname":"10.0.0.3","code":3},` +
+				`{"hostname":"10.0.0.4","code":3},{"hostname":"10.0.0.5","code":3}]`,
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := rollingExhibitor(server.URL).ApplyConfigRolling(ctx, "", []byte(`{}`),
+		[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"})
+	c.Assert(err, IsNil)
+	c.Assert(fake.rolledBack, Equals, false)
+}
+
+func (suite *TestSuiteRolling) TestSpecVoters(c *C) {
+	c.Assert(specVoters("S:1:zk1, S:2:zk2,O:3:zk3,4:zk4"), DeepEquals, []string{"zk1", "zk2", "zk4"})
+	c.Assert(specVoters(""), HasLen, 0)
+}
+
+func (suite *TestSuiteRolling) TestVoters(c *C) {
+	config := &Config{
+		Servers:   []HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		Observers: []HostPort{"10.0.0.4"},
+		Hostname:  "10.0.0.1",
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.Voters(), DeepEquals, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+
+	// The observer serving doesn't make up for the voters that are down.
+	statuses := []exhibitor.ServerStatus{
+		{Hostname: "10.0.0.1", Code: exhibitor.StateServing},
+		{Hostname: "10.0.0.2", Code: exhibitor.StateDown},
+		{Hostname: "10.0.0.3", Code: exhibitor.StateDown},
+		{Hostname: "10.0.0.4", Code: exhibitor.StateServing},
+	}
+	serving, total := countServing(statuses, config.Voters())
+	c.Assert(serving, Equals, 1)
+	c.Assert(total, Equals, 3)
+}
+
+func (suite *TestSuiteRolling) TestNoPollInterval(c *C) {
+	fake := &fakeRollingExhibitor{statuses: []string{`[{"hostname":"10.0.0.1","code":3}]`}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := rollingExhibitor(server.URL)
+	e.ReadyPollInterval.Duration = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := e.ApplyConfigRolling(ctx, "", []byte(`{}`), []string{"10.0.0.1"})
+	c.Assert(Cause(err), Equals, ErrRollingTimeout)
+}
@@ -0,0 +1,377 @@
+package quorum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/gohm/pkg/resource"
+	"github.com/conductant/zk/pkg/client"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSeedTimeout = 5 * time.Minute
+
+	// Seeding state kept in ZooKeeper.  The lock is ephemeral and holds the host seeding.  The
+	// marker holds the digest of the last tree applied.
+	SeedRootPath   = "/zk-bootstrap"
+	SeedLockPath   = SeedRootPath + "/seed-lock"
+	SeedMarkerPath = SeedRootPath + "/seeded"
+)
+
+// Znodes to create once the ensemble has quorum, e.g.
+//
+//	acl: [world:anyone:r, "digest:admin:x1nq8J5GOJVPY6zgzhtTtA9izLc=:cdrwa"]
+//	nodes:
+//	  /services: {}
+//	  /config:
+//	    children:
+//	      app: {data: "debug=false"}
+//
+// ACL is the default for created nodes and is world:anyone:cdrwa if not set.
+type SeedTree struct {
+	ACL   []string             `json:"acl" yaml:"acl"`
+	Nodes map[string]*SeedNode `json:"nodes" yaml:"nodes"`
+}
+
+// A znode and its children by name.  Data and ACL are set on existing nodes only if given.
+type SeedNode struct {
+	Data     *string              `json:"data" yaml:"data"`
+	ACL      []string             `json:"acl" yaml:"acl"`
+	Children map[string]*SeedNode `json:"children" yaml:"children"`
+}
+
+// A node of the tree by its full path, with the ACLs parsed.
+type seedEntry struct {
+	path string
+	data *string
+	acl  []client.ACL // nil to keep the ACL of an existing node
+}
+
+// The operations of the ZooKeeper client used for seeding
+type znodes interface {
+	Create(ctx context.Context, path string, data []byte, flags int32, acl []client.ACL) (string, error)
+	Delete(ctx context.Context, path string, version int32) error
+	ExistsW(ctx context.Context, path string) (bool, *client.Stat, <-chan client.Event, error)
+	Get(ctx context.Context, path string) ([]byte, *client.Stat, error)
+	Set(ctx context.Context, path string, data []byte, version int32) (*client.Stat, error)
+	GetACL(ctx context.Context, path string) ([]client.ACL, *client.Stat, error)
+	SetACL(ctx context.Context, path string, acl []client.ACL, version int32) (*client.Stat, error)
+}
+
+// Parses a YAML or JSON tree.
+func ParseSeed(buff []byte) (*SeedTree, error) {
+	tree := &SeedTree{}
+	if err := yaml.Unmarshal(buff, tree); err != nil {
+		return nil, newError(ErrBadSeed, "%v", err)
+	}
+	if _, _, err := tree.entries(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Fetches and parses the tree at Seed.  Returns the tree and the digest of its source.
+func (this *Config) fetchSeed() (*SeedTree, string, error) {
+	buff, err := resource.Fetch(context.Background(), this.Seed)
+	if err != nil {
+		return nil, "", newError(ErrBadSeed, "cannot fetch %s: %v", this.Seed, err)
+	}
+	tree, err := ParseSeed(buff)
+	if err != nil {
+		return nil, "", err
+	}
+	digest := sha256.Sum256(buff)
+	return tree, hex.EncodeToString(digest[:]), nil
+}
+
+// Flattens the tree, parents first.  Also returns the default ACL.
+func (this *SeedTree) entries() ([]seedEntry, []client.ACL, error) {
+	defaultACL := client.OpenACL
+	if this.ACL != nil {
+		acl, err := ParseACL(this.ACL)
+		if err != nil {
+			return nil, nil, err
+		}
+		defaultACL = acl
+	}
+	list := []seedEntry{}
+	var add func(p string, node *SeedNode) error
+	add = func(p string, node *SeedNode) error {
+		if p == "/" || path.Clean(p) != p || !strings.HasPrefix(p, "/") {
+			return newError(ErrBadSeed, "bad path %q", p)
+		}
+		if p == "/zookeeper" || strings.HasPrefix(p, "/zookeeper/") ||
+			p == SeedRootPath || strings.HasPrefix(p, SeedRootPath+"/") {
+			return newError(ErrBadSeed, "%s is reserved", p)
+		}
+		if node == nil {
+			node = &SeedNode{}
+		}
+		entry := seedEntry{path: p, data: node.Data}
+		if node.ACL != nil {
+			acl, err := ParseACL(node.ACL)
+			if err != nil {
+				return err
+			}
+			entry.acl = acl
+		}
+		list = append(list, entry)
+		for name, child := range node.Children {
+			if name == "" || strings.Contains(name, "/") {
+				return newError(ErrBadSeed, "bad child %q of %s", name, p)
+			}
+			if err := add(p+"/"+name, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for p, node := range this.Nodes {
+		if err := add(p, node); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Sort(byPath(list))
+	for i := 1; i < len(list); i++ {
+		if list[i].path == list[i-1].path {
+			return nil, nil, newError(ErrBadSeed, "%s is listed more than once", list[i].path)
+		}
+	}
+	return list, defaultACL, nil
+}
+
+type byPath []seedEntry
+
+func (this byPath) Len() int           { return len(this) }
+func (this byPath) Less(i, j int) bool { return this[i].path < this[j].path }
+func (this byPath) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+
+var permLetters = map[rune]int32{
+	'c': client.PermCreate,
+	'd': client.PermDelete,
+	'r': client.PermRead,
+	'w': client.PermWrite,
+	'a': client.PermAdmin,
+}
+
+// Parses ACLs written like in zkCli, scheme:id:perms, e.g. ip:10.0.0.0/8:rw.  The id may contain
+// colons.
+func ParseACL(list []string) ([]client.ACL, error) {
+	acl := []client.ACL{}
+	for _, s := range list {
+		first, last := strings.Index(s, ":"), strings.LastIndex(s, ":")
+		if first <= 0 || last == first || last == len(s)-1 {
+			return nil, newError(ErrBadSeed, "bad acl %q.  Use scheme:id:perms", s)
+		}
+		a := client.ACL{Scheme: s[:first], Id: s[first+1 : last]}
+		for _, letter := range s[last+1:] {
+			perm, has := permLetters[letter]
+			if !has {
+				return nil, newError(ErrBadSeed, "bad permission %q in acl %q.  Use cdrwa", letter, s)
+			}
+			a.Perms |= perm
+		}
+		acl = append(acl, a)
+	}
+	return acl, nil
+}
+
+// Seeds the tree at Seed in the background once the local ZooKeeper serves clients.  Gives up
+// after SeedTimeout or when the child stops.  Failures are logged and kept as recent errors.
+func (this *Config) StartSeeding() {
+	if this.Seed == "" {
+		return
+	}
+	timeout := this.SeedTimeout
+	if timeout <= 0 {
+		timeout = DefaultSeedTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-this.Supervisor.Done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		if err := this.seed(ctx); err != nil {
+			log.Error("Seeding failed: ", err)
+			this.recent.add("seed", err)
+		}
+	}()
+}
+
+func (this *Config) seed(ctx context.Context) error {
+	tree, digest, err := this.fetchSeed()
+	if err != nil {
+		return err
+	}
+	zk, err := client.NewClient(this.LocalZkAddr())
+	if err != nil {
+		return err
+	}
+	if err := zk.Connect(ctx); err != nil {
+		return newError(ErrSeedFailed, "cannot connect to %s: %v", this.LocalZkAddr(), err)
+	}
+	defer zk.Close()
+	if this.SeedAuth != "" {
+		if err := zk.AddAuth(ctx, "digest", []byte(this.SeedAuth)); err != nil {
+			return newError(ErrSeedFailed, "cannot authenticate: %v", err)
+		}
+	}
+	_, err = applySeed(ctx, zk, tree, digest, this.Hostname)
+	return err
+}
+
+// Applies the tree unless the marker says it already was.  Members seed one at a time, holding
+// the lock.  Returns true if the tree was applied.
+func applySeed(ctx context.Context, zk znodes, tree *SeedTree, digest, holder string) (bool, error) {
+	entries, defaultACL, err := tree.entries()
+	if err != nil {
+		return false, err
+	}
+	if err := createIfMissing(ctx, zk, SeedRootPath, client.OpenACL); err != nil {
+		return false, seedError("create", SeedRootPath, err)
+	}
+	if err := lockSeed(ctx, zk, holder); err != nil {
+		return false, err
+	}
+	defer zk.Delete(ctx, SeedLockPath, client.AnyVersion)
+
+	marker, _, err := zk.Get(ctx, SeedMarkerPath)
+	switch {
+	case err == nil && string(marker) == digest:
+		log.Info("Seed ", digest, " already applied.")
+		return false, nil
+	case err != nil && err != client.ErrNoNode:
+		return false, seedError("get", SeedMarkerPath, err)
+	}
+
+	log.Info("Seeding ", len(entries), " znodes.")
+	for _, entry := range entries {
+		if err := applySeedEntry(ctx, zk, entry, defaultACL); err != nil {
+			return false, err
+		}
+	}
+	if _, err := zk.Create(ctx, SeedMarkerPath, []byte(digest), 0, client.OpenACL); err == client.ErrNodeExists {
+		_, err = zk.Set(ctx, SeedMarkerPath, []byte(digest), client.AnyVersion)
+		if err != nil {
+			return false, seedError("set", SeedMarkerPath, err)
+		}
+	} else if err != nil {
+		return false, seedError("create", SeedMarkerPath, err)
+	}
+	log.Info("Seeded ", digest, ".")
+	return true, nil
+}
+
+// Takes the lock, waiting for other members holding it.
+func lockSeed(ctx context.Context, zk znodes, holder string) error {
+	for {
+		_, err := zk.Create(ctx, SeedLockPath, []byte(holder), client.FlagEphemeral, client.OpenACL)
+		if err == nil {
+			return nil
+		}
+		if err != client.ErrNodeExists {
+			return seedError("lock", SeedLockPath, err)
+		}
+		exists, _, watch, err := zk.ExistsW(ctx, SeedLockPath)
+		if err != nil {
+			return seedError("lock", SeedLockPath, err)
+		}
+		if !exists {
+			continue
+		}
+		if other, _, err := zk.Get(ctx, SeedLockPath); err == nil {
+			log.Info("Waiting for ", string(other), " to finish seeding.")
+		}
+		select {
+		case <-watch:
+		case <-ctx.Done():
+			return newError(ErrSeedFailed, "waiting for the seed lock: %v", ctx.Err())
+		}
+	}
+}
+
+// Creates the node, or sets the data and ACL of an existing node where they differ.
+func applySeedEntry(ctx context.Context, zk znodes, entry seedEntry, defaultACL []client.ACL) error {
+	if err := createParents(ctx, zk, entry.path, defaultACL); err != nil {
+		return err
+	}
+	data := []byte{}
+	if entry.data != nil {
+		data = []byte(*entry.data)
+	}
+	acl := entry.acl
+	if acl == nil {
+		acl = defaultACL
+	}
+	_, err := zk.Create(ctx, entry.path, data, 0, acl)
+	if err == nil {
+		log.Info("Seed: created ", entry.path)
+		return nil
+	}
+	if err != client.ErrNodeExists {
+		return seedError("create", entry.path, err)
+	}
+
+	if entry.data != nil {
+		current, _, err := zk.Get(ctx, entry.path)
+		if err != nil {
+			return seedError("get", entry.path, err)
+		}
+		if !bytes.Equal(current, data) {
+			if _, err := zk.Set(ctx, entry.path, data, client.AnyVersion); err != nil {
+				return seedError("set", entry.path, err)
+			}
+			log.Info("Seed: updated data of ", entry.path)
+		}
+	}
+	if entry.acl != nil {
+		current, _, err := zk.GetACL(ctx, entry.path)
+		if err != nil {
+			return seedError("get acl", entry.path, err)
+		}
+		if !reflect.DeepEqual(current, entry.acl) {
+			if _, err := zk.SetACL(ctx, entry.path, entry.acl, client.AnyVersion); err != nil {
+				return seedError("set acl", entry.path, err)
+			}
+			log.Info("Seed: updated acl of ", entry.path)
+		}
+	}
+	return nil
+}
+
+// Creates the missing ancestors of the path, empty and with the ACL.
+func createParents(ctx context.Context, zk znodes, p string, acl []client.ACL) error {
+	parts := strings.Split(p, "/")
+	for i := 2; i < len(parts); i++ {
+		parent := strings.Join(parts[:i], "/")
+		if err := createIfMissing(ctx, zk, parent, acl); err != nil {
+			return seedError("create", parent, err)
+		}
+	}
+	return nil
+}
+
+func createIfMissing(ctx context.Context, zk znodes, p string, acl []client.ACL) error {
+	_, err := zk.Create(ctx, p, []byte{}, 0, acl)
+	if err == client.ErrNodeExists {
+		return nil
+	}
+	return err
+}
+
+func seedError(op, p string, err error) error {
+	return newError(ErrSeedFailed, "%s %s: %v", op, p, err)
+}
@@ -0,0 +1,178 @@
+package quorum
+
+import (
+	"github.com/conductant/zk/pkg/client"
+	"github.com/conductant/zk/pkg/client/clienttest"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+type TestSuiteSeed struct {
+}
+
+var _ = Suite(&TestSuiteSeed{})
+
+func (suite *TestSuiteSeed) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteSeed) TearDownSuite(c *C) {
+}
+
+const seedYaml = `
+acl: ["world:anyone:r", "digest:admin:x1nq8J5GOJVPY6zgzhtTtA9izLc=:cdrwa"]
+nodes:
+  /services:
+  /config/app:
+    data: debug=false
+    acl: ["ip:10.0.0.0/8:rw"]
+    children:
+      flags: {data: "{}"}
+`
+
+const seedJson = `{
+  "acl": ["world:anyone:r", "digest:admin:x1nq8J5GOJVPY6zgzhtTtA9izLc=:cdrwa"],
+  "nodes": {
+    "/services": null,
+    "/config/app": {"data": "debug=false", "acl": ["ip:10.0.0.0/8:rw"], "children": {"flags": {"data": "{}"}}}
+  }
+}`
+
+func (suite *TestSuiteSeed) TestParse(c *C) {
+	fromYaml, err := ParseSeed([]byte(seedYaml))
+	c.Assert(err, IsNil)
+	fromJson, err := ParseSeed([]byte(seedJson))
+	c.Assert(err, IsNil)
+	c.Assert(fromJson, DeepEquals, fromYaml)
+
+	entries, acl, err := fromYaml.entries()
+	c.Assert(err, IsNil)
+	c.Assert(acl, DeepEquals, []client.ACL{
+		{Perms: client.PermRead, Scheme: "world", Id: "anyone"},
+		{Perms: client.PermAll, Scheme: "digest", Id: "admin:x1nq8J5GOJVPY6zgzhtTtA9izLc="},
+	})
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.path)
+	}
+	c.Assert(paths, DeepEquals, []string{"/config/app", "/config/app/flags", "/services"})
+	c.Assert(*entries[0].data, Equals, "debug=false")
+	c.Assert(entries[0].acl, DeepEquals, []client.ACL{{Perms: client.PermRead | client.PermWrite, Scheme: "ip", Id: "10.0.0.0/8"}})
+	c.Assert(entries[2].data, IsNil)
+	c.Assert(entries[2].acl, IsNil)
+}
+
+func (suite *TestSuiteSeed) TestParseErrors(c *C) {
+	for _, t := range []struct {
+		tree string
+		err  string
+	}{
+		{"nodes: [a]", "(?s)err-bad-seed:yaml: .*"},
+		{"nodes: {services: {}}", `err-bad-seed:bad path "services"`},
+		{"nodes: {/a/../b: {}}", `err-bad-seed:bad path "/a/../b"`},
+		{"nodes: {/zookeeper/quota: {}}", "err-bad-seed:/zookeeper/quota is reserved"},
+		{"nodes: {/a: {children: {b/c: {}}}}", `err-bad-seed:bad child "b/c" of /a`},
+		{"nodes: {/a/b: {}, /a: {children: {b: {}}}}", "err-bad-seed:/a/b is listed more than once"},
+		{"acl: [\"world:anyone\"]", `err-bad-seed:bad acl "world:anyone".  Use scheme:id:perms`},
+		{`nodes: {/a: {acl: ["world:anyone:rx"]}}`, `err-bad-seed:bad permission 'x' in acl "world:anyone:rx".  Use cdrwa`},
+	} {
+		_, err := ParseSeed([]byte(t.tree))
+		c.Assert(err, ErrorMatches, t.err, Commentf(t.tree))
+		c.Assert(Cause(err), Equals, ErrBadSeed)
+	}
+}
+
+func (suite *TestSuiteSeed) TestApply(c *C) {
+	tree, err := ParseSeed([]byte(seedYaml))
+	c.Assert(err, IsNil)
+	zk := clienttest.NewZnodes()
+	ctx := context.Background()
+
+	applied, err := applySeed(ctx, zk, tree, "digest-1", "zk-1")
+	c.Assert(err, IsNil)
+	c.Assert(applied, Equals, true)
+	c.Assert(zk.Data("/config"), Equals, "")
+	c.Assert(zk.Data("/config/app"), Equals, "debug=false")
+	c.Assert(zk.Data("/config/app/flags"), Equals, "{}")
+	c.Assert(zk.Data(SeedMarkerPath), Equals, "digest-1")
+	c.Assert(zk.Data(SeedLockPath), Equals, clienttest.NoData)
+	c.Assert(zk.ACL("/config"), DeepEquals, zk.ACL("/services"))
+	c.Assert(zk.ACL("/config/app")[0].Scheme, Equals, "ip")
+
+	// Already applied
+	zk.Set(ctx, "/config/app", []byte("debug=true"), client.AnyVersion)
+	applied, err = applySeed(ctx, zk, tree, "digest-1", "zk-2")
+	c.Assert(err, IsNil)
+	c.Assert(applied, Equals, false)
+	c.Assert(zk.Data("/config/app"), Equals, "debug=true")
+
+	// A changed tree sets what it lists and leaves the rest
+	zk.Set(ctx, "/services", []byte("registry"), client.AnyVersion)
+	zk.SetACL(ctx, "/config/app", client.OpenACL, client.AnyVersion)
+	applied, err = applySeed(ctx, zk, tree, "digest-2", "zk-2")
+	c.Assert(err, IsNil)
+	c.Assert(applied, Equals, true)
+	c.Assert(zk.Data("/config/app"), Equals, "debug=false")
+	c.Assert(zk.ACL("/config/app")[0].Scheme, Equals, "ip")
+	c.Assert(zk.Data("/services"), Equals, "registry")
+	c.Assert(zk.Data(SeedMarkerPath), Equals, "digest-2")
+}
+
+func (suite *TestSuiteSeed) TestLock(c *C) {
+	tree, err := ParseSeed([]byte(seedYaml))
+	c.Assert(err, IsNil)
+	zk := clienttest.NewZnodes()
+	ctx := context.Background()
+	zk.Create(ctx, SeedRootPath, nil, 0, client.OpenACL)
+	zk.Create(ctx, SeedLockPath, []byte("zk-1"), client.FlagEphemeral, client.OpenACL)
+
+	done := make(chan bool)
+	go func() {
+		applied, err := applySeed(ctx, zk, tree, "digest-1", "zk-2")
+		c.Check(err, IsNil)
+		done <- applied
+	}()
+	select {
+	case <-done:
+		c.Fatal("Seeded while the lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Assert(zk.Data("/services"), Equals, clienttest.NoData)
+
+	// zk-1 finishes seeding
+	zk.Create(ctx, "/services", nil, 0, client.OpenACL)
+	zk.Create(ctx, SeedMarkerPath, []byte("digest-1"), 0, client.OpenACL)
+	zk.Delete(ctx, SeedLockPath, client.AnyVersion)
+	c.Assert(<-done, Equals, false)
+	c.Assert(zk.Data("/config/app"), Equals, clienttest.NoData)
+
+	// Gives up waiting with the context
+	zk.Create(ctx, SeedLockPath, []byte("zk-1"), client.FlagEphemeral, client.OpenACL)
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = applySeed(timeout, zk, tree, "digest-2", "zk-2")
+	c.Assert(err, ErrorMatches, "err-seed-failed:waiting for the seed lock: context deadline exceeded")
+}
+
+func (suite *TestSuiteSeed) TestValidate(c *C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "seed.yml")
+	c.Assert(ioutil.WriteFile(file, []byte(`nodes: {/a: {acl: ["world:anyone:rx"]}}`), 0644), IsNil)
+
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.1")
+	config.Seed = "file://" + file
+	c.Assert(messages(config.Validate(), SeverityError), DeepEquals,
+		[]string{`err-bad-seed:bad permission 'x' in acl "world:anyone:rx".  Use cdrwa`})
+
+	config.Seed = "file://" + filepath.Join(dir, "missing.yml")
+	c.Assert(messages(config.Validate(), SeverityError), HasLen, 1)
+
+	c.Assert(ioutil.WriteFile(file, []byte(seedYaml), 0644), IsNil)
+	config.Seed = "file://" + file
+	c.Assert(messages(config.Validate(), SeverityError), HasLen, 0)
+	_, digest, err := config.fetchSeed()
+	c.Assert(err, IsNil)
+	c.Assert(digest, HasLen, 64)
+}
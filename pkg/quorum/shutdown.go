@@ -0,0 +1,65 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultShutdownGracePeriod = 30 * time.Second
+)
+
+type shutdownStep struct {
+	name string
+	run  func() error
+}
+
+// Returns true once Shutdown has been called.
+func (this *Config) ShuttingDown() bool {
+	return atomic.LoadInt32(&this.draining) == 1
+}
+
+// Ordered shutdown of this ensemble member.  Each step is logged and attempted even if an
+// earlier one failed; the first error is returned so the caller can set the exit code.
+func (this *Config) Shutdown() error {
+	steps := []shutdownStep{
+		{"stop accepting new client connections", this.drain},
+		{"stop ZooKeeper", this.stopChild},
+		{"stop myid watcher", this.Close},
+		{"flush logs", flushLogs},
+	}
+	var failed error
+	for i, step := range steps {
+		log.Info("Shutdown step ", i+1, "/", len(steps), ": ", step.name)
+		if err := step.run(); err != nil {
+			log.Warn("Shutdown step ", i+1, " failed: ", err)
+			if failed == nil {
+				failed = err
+			}
+		}
+	}
+	return failed
+}
+
+// ZooKeeper 3.4 cannot refuse new sessions on its own, so draining means no longer starting
+// the child and reporting not ready to anything probing this member.
+func (this *Config) drain() error {
+	atomic.StoreInt32(&this.draining, 1)
+	return nil
+}
+
+func (this *Config) stopChild() error {
+	if !this.Supervisor.Started() {
+		log.Info("Child process not started.")
+		return nil
+	}
+	return this.Supervisor.StopWithin(this.ShutdownGracePeriod)
+}
+
+func flushLogs() error {
+	os.Stdout.Sync()
+	os.Stderr.Sync()
+	return nil
+}
@@ -0,0 +1,66 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// Waits for the started child to serve clients.  In exhibitor mode the config is applied as
+// soon as Exhibitor answers.  Returns as soon as ReadyTimeout elapses, the config is rejected
+// or the child stops, with an error saying which.  Returns nil if shutting down.
+func (this *Config) WaitStarted(ctx context.Context, config []byte) error {
+	if this.Mode != ModeNative {
+		log.Info("Waiting for Exhibitor to come up.")
+		if err := this.Exhibitor.WaitReady(ctx); err != nil {
+			return this.startupError(err)
+		}
+		if !this.Supervisor.Alive() {
+			return this.startupError(newError(ErrNotRunning, "%s stopped", this.Supervisor.Name))
+		}
+		log.Info("Applying config")
+		if err := this.Exhibitor.ApplyConfig("", config); err != nil {
+			return this.startupError(this.applyError(err))
+		}
+	}
+	log.Info("Waiting for ZooKeeper to join the quorum.")
+	if err := this.WaitZkRunning(ctx); err != nil {
+		return this.startupError(err)
+	}
+	log.Info("Zookeeper running.")
+	return nil
+}
+
+// Replaces the error of monitoring stopping with the reason the child stopped.  Any error is
+// dropped when shutting down.
+func (this *Config) startupError(err error) error {
+	if this.ShuttingDown() {
+		return nil
+	}
+	if Cause(err) != ErrNotRunning {
+		return err
+	}
+	if childErr := this.Supervisor.Err(); childErr != nil {
+		return childErr
+	}
+	return newError(ErrNotRunning, "%s exited before serving clients", this.Supervisor.Name)
+}
+
+// Gives an error applying the config at startup a kind.  Exhibitor not answering usually means
+// it is going down, so this waits up to a poll interval for the supervisor to say why.
+func (this *Config) applyError(err error) error {
+	switch Cause(err) {
+	case ErrConfigRejected, ErrExhibitorTimeout:
+		return err
+	}
+	wait := this.Exhibitor.ReadyPollInterval.Duration
+	if wait <= 0 {
+		wait = time.Second
+	}
+	select {
+	case <-this.Supervisor.Done:
+		return newError(ErrNotRunning, "%s stopped: %v", this.Supervisor.Name, err)
+	case <-time.After(wait):
+	}
+	return newError(ErrExhibitorTimeout, "%s stopped answering: %v", this.Supervisor.Name, err)
+}
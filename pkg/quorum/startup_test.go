@@ -0,0 +1,136 @@
+package quorum
+
+import (
+	"github.com/conductant/gohm/pkg/encoding"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TestSuiteStartup struct {
+}
+
+var _ = Suite(&TestSuiteStartup{})
+
+func (suite *TestSuiteStartup) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteStartup) TearDownSuite(c *C) {
+}
+
+// Native config running the shell script as ZooKeeper on a port nothing listens on.
+func (suite *TestSuiteStartup) scripted(c *C, script string) *Config {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "zk.sh")
+	c.Assert(ioutil.WriteFile(path, []byte(script), 0755), IsNil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	config := &Config{
+		Mode:     ModeNative,
+		Hostname: "127.0.0.1",
+		Servers:  []HostPort{HostPort("127.0.0.1:" + strconv.Itoa(port))},
+		Native: ZooKeeper{
+			ReadyTimeout:      encoding.Duration{Duration: 200 * time.Millisecond},
+			ReadyPollInterval: encoding.Duration{Duration: 10 * time.Millisecond},
+			StartCommand:      "/bin/sh " + path,
+			ConfigPath:        filepath.Join(dir, "zoo.cfg"),
+		},
+		Supervisor: Supervisor{
+			RestartBackoff:  10 * time.Millisecond,
+			MaxRestarts:     1,
+			CrashLoopWindow: time.Minute,
+			LogTailLines:    3,
+		},
+		ShutdownGracePeriod: time.Second,
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	return config
+}
+
+func (suite *TestSuiteStartup) TestCrashLoop(c *C) {
+	config := suite.scripted(c, "echo starting >&2\necho bad config >&2\nexit 3\n")
+	c.Assert(config.Start(), IsNil)
+
+	err := config.WaitStarted(context.Background(), nil)
+	c.Assert(Cause(err), Equals, ErrCrashLoop)
+	c.Assert(config.Supervisor.LogTail(), DeepEquals, []string{"bad config", "starting", "bad config"})
+}
+
+func (suite *TestSuiteStartup) TestTimeout(c *C) {
+	config := suite.scripted(c, "echo waiting\nexec sleep 10\n")
+	c.Assert(config.Start(), IsNil)
+	defer config.Shutdown()
+
+	start := time.Now()
+	err := config.WaitStarted(context.Background(), nil)
+	c.Assert(Cause(err), Equals, ErrZkTimeout)
+	c.Assert(err, ErrorMatches, "err-zk-timeout:ZooKeeper never answered after 200ms: .*connection refused")
+	c.Assert(time.Since(start) < 2*time.Second, Equals, true)
+	c.Assert(config.Supervisor.LogTail(), DeepEquals, []string{"waiting"})
+}
+
+func (suite *TestSuiteStartup) TestShutdown(c *C) {
+	config := suite.scripted(c, "exec sleep 10\n")
+	config.Native.ReadyTimeout.Duration = time.Minute
+	c.Assert(config.Start(), IsNil)
+
+	done := make(chan error)
+	go func() {
+		done <- config.WaitStarted(context.Background(), nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	config.Shutdown()
+	c.Assert(<-done, IsNil)
+}
+
+// Exhibitor mode config running the shell script as Exhibitor.  Exhibitor is seen as up from the
+// start, but its endpoint is a port nothing listens on.
+func (suite *TestSuiteStartup) exhibitor(c *C, script string) *Config {
+	config := suite.scripted(c, script)
+	config.Mode = ModeExhibitor
+	config.Exhibitor.Endpoint = "http://" + string(config.Servers[0])
+	config.Exhibitor.ReadyPollInterval.Duration = 2 * time.Second
+	config.Supervisor.Name = "Exhibitor"
+	config.Supervisor.Command = strings.Fields(config.Native.StartCommand)
+	c.Assert(config.Supervisor.Start(), IsNil)
+
+	probe := &scriptedProbe{states: []State{StateExhibitorUp}}
+	config.Exhibitor.supervisor = &config.Supervisor
+	config.Exhibitor.monitor, config.Exhibitor.stopMonitor = startMonitor("Exhibitor", probe.probe,
+		10*time.Millisecond, 10*time.Millisecond, &config.Supervisor)
+	return config
+}
+
+func (suite *TestSuiteStartup) TestExhibitorExits(c *C) {
+	config := suite.exhibitor(c, "echo going down >&2\nsleep 0.1\nexit 3\n")
+	defer config.Exhibitor.stopMonitor()
+
+	err := config.WaitStarted(context.Background(), []byte("{}"))
+	c.Assert(Cause(err), Equals, ErrCrashLoop)
+	c.Assert(config.Supervisor.LogTail(), DeepEquals, []string{"going down", "going down"})
+}
+
+func (suite *TestSuiteStartup) TestExhibitorShutdown(c *C) {
+	config := suite.exhibitor(c, "exec sleep 10\n")
+	defer config.Exhibitor.stopMonitor()
+
+	c.Assert(config.Shutdown(), IsNil)
+	c.Assert(config.WaitStarted(context.Background(), []byte("{}")), IsNil)
+}
+
+func (suite *TestSuiteStartup) TestLogTail(c *C) {
+	tail := newLogTail(2)
+	tail.Write([]byte("one\ntw"))
+	c.Assert(tail.get(), DeepEquals, []string{"one", "tw"})
+	tail.Write([]byte("o\r\nthree\nfour"))
+	c.Assert(tail.get(), DeepEquals, []string{"three", "four"})
+}
@@ -0,0 +1,118 @@
+package quorum
+
+import (
+	"fmt"
+	"github.com/conductant/zk/pkg/exhibitor"
+	"github.com/conductant/zk/pkg/fourletter"
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+// Health of one member as seen by probing it.
+type MemberStatus struct {
+	Id               int                `json:"id"`
+	Host             string             `json:"host"`
+	Addr             string             `json:"addr"`
+	Observer         bool               `json:"observer"`
+	Mode             string             `json:"mode,omitempty"`
+	Zxid             int64              `json:"zxid"`
+	Latency          fourletter.Latency `json:"latency"`
+	Connections      int64              `json:"connections"`
+	Outstanding      int64              `json:"outstanding"`
+	ExhibitorRunning *bool              `json:"exhibitor_running,omitempty"`
+	Error            string             `json:"error,omitempty"`
+}
+
+// Health of the whole ensemble.
+type EnsembleStatus struct {
+	Members       []*MemberStatus `json:"members"`
+	Voters        int             `json:"voters"`
+	ServingVoters int             `json:"serving_voters"`
+	Leader        string          `json:"leader,omitempty"`
+	Quorum        bool            `json:"quorum"`
+}
+
+// Probes every member of the ensemble in parallel with the srvr four letter word.  If
+// exhibitorPort is set, each member's Exhibitor is asked for its state as well.
+func (this *Config) Probe(timeout time.Duration, exhibitorPort int) *EnsembleStatus {
+	status := &EnsembleStatus{Members: make([]*MemberStatus, len(this.ensemble))}
+
+	var wait sync.WaitGroup
+	for i, s := range this.ensemble {
+		member := &MemberStatus{
+			Id:       s.Id,
+			Host:     s.Ip,
+			Addr:     s.ClientAddr(),
+			Observer: s.Observer,
+		}
+		status.Members[i] = member
+
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			probeMember(member, timeout, exhibitorPort)
+		}()
+	}
+	wait.Wait()
+
+	for _, member := range status.Members {
+		if member.Observer {
+			continue
+		}
+		status.Voters++
+		switch member.Mode {
+		case fourletter.ModeLeader, fourletter.ModeStandalone:
+			status.Leader = member.Host
+			status.ServingVoters++
+		case fourletter.ModeFollower:
+			status.ServingVoters++
+		}
+	}
+	status.Quorum = status.Voters > 0 && status.Leader != "" && status.ServingVoters >= status.Voters/2+1
+	return status
+}
+
+// Returns an error of kind ErrNoQuorum if the ensemble has no quorum.
+func (this *EnsembleStatus) Err() error {
+	if this.Quorum {
+		return nil
+	}
+	if this.Leader == "" {
+		return newError(ErrNoQuorum, "%d/%d voters serving, no leader", this.ServingVoters, this.Voters)
+	}
+	return newError(ErrNoQuorum, "%d/%d voters serving", this.ServingVoters, this.Voters)
+}
+
+func probeMember(member *MemberStatus, timeout time.Duration, exhibitorPort int) {
+	client := fourletter.NewClient(member.Addr)
+	client.Timeout = timeout
+	if stat, err := client.Srvr(); err == nil {
+		member.Mode = stat.Mode
+		member.Zxid = stat.Zxid
+		member.Latency = stat.Latency
+		member.Connections = stat.Connections
+		member.Outstanding = stat.Outstanding
+	} else {
+		member.Error = err.Error()
+	}
+
+	if exhibitorPort == 0 {
+		return
+	}
+	ex, err := exhibitor.NewClient(fmt.Sprintf("http://%s:%d", member.Host, exhibitorPort))
+	if err != nil {
+		member.Error = err.Error()
+		return
+	}
+	ex.Timeout = timeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	running := false
+	if state, err := ex.GetState(ctx); err == nil {
+		running = state.Running
+	} else if member.Error == "" {
+		member.Error = err.Error()
+	}
+	member.ExhibitorRunning = &running
+}
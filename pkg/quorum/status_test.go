@@ -0,0 +1,97 @@
+package quorum
+
+import (
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net"
+	"time"
+)
+
+type TestSuiteStatus struct {
+	listeners []net.Listener
+}
+
+var _ = Suite(&TestSuiteStatus{})
+
+func (suite *TestSuiteStatus) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteStatus) TearDownTest(c *C) {
+	for _, l := range suite.listeners {
+		l.Close()
+	}
+	suite.listeners = nil
+}
+
+// Starts a fake ZooKeeper that answers srvr in the given mode.
+func (suite *TestSuiteStatus) fakeZk(c *C, ip, mode string) HostPort {
+	listener, err := net.Listen("tcp", ip+":0")
+	c.Assert(err, IsNil)
+	suite.listeners = append(suite.listeners, listener)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 4))
+			fmt.Fprintf(conn, "Zookeeper version: 3.4.6\nLatency min/avg/max: 0/1/2\n"+
+				"Received: 1\nSent: 1\nConnections: 3\nOutstanding: 0\nZxid: 0x100000005\nMode: %s\nNode count: 4\n", mode)
+			conn.Close()
+		}
+	}()
+	return HostPort(listener.Addr().String())
+}
+
+// A port nothing listens on.
+func (suite *TestSuiteStatus) deadZk(c *C, ip string) HostPort {
+	listener, err := net.Listen("tcp", ip+":0")
+	c.Assert(err, IsNil)
+	addr := listener.Addr().String()
+	listener.Close()
+	return HostPort(addr)
+}
+
+func (suite *TestSuiteStatus) TestProbeQuorum(c *C) {
+	config := &Config{
+		Servers: []HostPort{
+			suite.fakeZk(c, "127.0.0.1", "leader"),
+			suite.fakeZk(c, "127.0.0.2", "follower"),
+			suite.deadZk(c, "127.0.0.3"),
+		},
+		Observers: []HostPort{
+			suite.fakeZk(c, "127.0.0.4", "observer"),
+		},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+
+	status := config.Probe(time.Second, 0)
+	c.Assert(status.Members, HasLen, 4)
+	c.Assert(status.Voters, Equals, 3)
+	c.Assert(status.ServingVoters, Equals, 2)
+	c.Assert(status.Leader, Equals, "127.0.0.1")
+	c.Assert(status.Quorum, Equals, true)
+
+	c.Assert(status.Members[1].Mode, Equals, "follower")
+	c.Assert(status.Members[1].Zxid, Equals, int64(0x100000005))
+	c.Assert(status.Members[1].Connections, Equals, int64(3))
+	c.Assert(status.Members[2].Error, Not(Equals), "")
+	c.Assert(status.Members[3].Observer, Equals, true)
+	c.Assert(status.Err(), IsNil)
+}
+
+func (suite *TestSuiteStatus) TestProbeNoQuorum(c *C) {
+	config := &Config{
+		Servers: []HostPort{
+			suite.fakeZk(c, "127.0.0.1", "follower"),
+			suite.deadZk(c, "127.0.0.2"),
+			suite.deadZk(c, "127.0.0.3"),
+		},
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+
+	status := config.Probe(time.Second, 0)
+	c.Assert(status.ServingVoters, Equals, 1)
+	c.Assert(status.Quorum, Equals, false)
+	c.Assert(Cause(status.Err()), Equals, ErrNoQuorum)
+}
@@ -0,0 +1,312 @@
+package quorum
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRestartBackoff    = 1 * time.Second
+	DefaultRestartBackoffMax = 1 * time.Minute
+	DefaultMaxRestarts       = 5
+	DefaultCrashLoopWindow   = 10 * time.Minute
+)
+
+// Supervises the child process (Exhibitor or ZooKeeper).  The child is waited on and
+// restarted with exponential backoff whenever it exits unexpectedly.  If it keeps crashing
+// without staying up for CrashLoopWindow, the supervisor gives up after MaxRestarts and
+// closes Done with an error.
+type Supervisor struct {
+	RestartBackoff    time.Duration `json:"restart_backoff" yaml:"restart_backoff" flag:"restart_backoff, Initial delay before restarting the child process"`
+	RestartBackoffMax time.Duration `json:"restart_backoff_max" yaml:"restart_backoff_max" flag:"restart_backoff_max, Maximum delay before restarting the child process"`
+	MaxRestarts       int           `json:"max_restarts" yaml:"max_restarts" flag:"max_restarts, Restarts allowed within the crash loop window before giving up"`
+	CrashLoopWindow   time.Duration `json:"crash_loop_window" yaml:"crash_loop_window" flag:"crash_loop_window, Uptime after which the child is considered healthy again"`
+	LogTailLines      int           `json:"log_tail_lines" yaml:"log_tail_lines" flag:"log_tail, Lines of the child's output to report when it fails to start"`
+
+	Name    string    `json:"-" yaml:"-"`
+	Command []string  `json:"-" yaml:"-"`
+	Stdout  io.Writer `json:"-" yaml:"-"`
+	Stderr  io.Writer `json:"-" yaml:"-"`
+
+	// Closed when the supervisor is done, either because the child was stopped or
+	// because the supervisor gave up.  See Err.
+	Done <-chan interface{} `json:"-" yaml:"-"`
+
+	cmd      *exec.Cmd
+	stop     chan interface{}
+	stopping bool
+	restarts int
+	err      error
+	tail     *logTail
+	lock     sync.Mutex
+}
+
+// Starts the child process and the supervising goroutine.  An error is returned only if
+// the first attempt to start the child fails.
+func (this *Supervisor) Start() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.stop != nil {
+		return newError(ErrAlreadyStarted, "%s", this.Name)
+	}
+	if len(this.Command) == 0 {
+		return newError(ErrNoCommand, "%s", this.Name)
+	}
+	if this.RestartBackoff <= 0 {
+		this.RestartBackoff = DefaultRestartBackoff
+	}
+	if this.RestartBackoffMax < this.RestartBackoff {
+		this.RestartBackoffMax = this.RestartBackoff
+	}
+	this.tail = newLogTail(this.LogTailLines)
+
+	cmd, err := this.start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan interface{})
+	this.cmd = cmd
+	this.stop = make(chan interface{})
+	this.Done = done
+
+	go this.run(cmd, done)
+	return nil
+}
+
+// Forwards a signal to the child process and the processes it started, such as the ZooKeeper
+// that Exhibitor runs.  SIGTERM and SIGINT are considered requests to stop, so the child won't be
+// restarted after it exits.  A child that has already exited, as while waiting to restart it or
+// after giving up, is left as is.
+func (this *Supervisor) Signal(sig os.Signal) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.cmd == nil || this.cmd.Process == nil {
+		return newError(ErrNotRunning, "%s", this.Name)
+	}
+	if sig == syscall.SIGTERM || sig == os.Interrupt {
+		this.requestStop()
+	}
+	log.Info("Sending ", sig, " to ", this.Name, " pid=", this.cmd.Process.Pid)
+	if err := signalGroup(this.cmd.Process.Pid, sig); err != syscall.ESRCH {
+		return err
+	}
+	log.Info(this.Name, " pid=", this.cmd.Process.Pid, " has already exited")
+	return nil
+}
+
+// Stops the child with SIGTERM and blocks until it has exited.
+func (this *Supervisor) Stop() error {
+	if err := this.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	<-this.Done
+	return this.Err()
+}
+
+// Stops the child with SIGTERM and waits up to grace for it and the processes it started to exit
+// before sending SIGKILL.
+func (this *Supervisor) StopWithin(grace time.Duration) error {
+	deadline := time.Now().Add(grace)
+	if err := this.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	this.lock.Lock()
+	pgid := this.cmd.Process.Pid
+	this.lock.Unlock()
+
+	select {
+	case <-this.Done:
+		if waitGroup(pgid, deadline) {
+			return this.Err()
+		}
+		log.Warn("Processes started by ", this.Name, " did not exit within ", grace, ".  Killing.")
+		signalGroup(pgid, syscall.SIGKILL)
+		waitGroup(pgid, time.Now().Add(grace))
+	case <-time.After(deadline.Sub(time.Now())):
+		log.Warn(this.Name, " did not exit within ", grace, ".  Killing.")
+		if err := this.Signal(syscall.SIGKILL); err != nil {
+			return err
+		}
+		<-this.Done
+	}
+	return newError(ErrKilled, "%s", this.Name)
+}
+
+// Returns the reason the supervisor finished.  This is nil while running or if the
+// child was stopped on request.
+func (this *Supervisor) Err() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.err
+}
+
+// Returns true if the child has been started.
+func (this *Supervisor) Started() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.stop != nil
+}
+
+// True if the child was started and the supervisor is still looking after it.
+func (this *Supervisor) Alive() bool {
+	this.lock.Lock()
+	done := this.Done
+	this.lock.Unlock()
+	if done == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Last lines of the child's stdout and stderr, oldest first.
+func (this *Supervisor) LogTail() []string {
+	this.lock.Lock()
+	tail := this.tail
+	this.lock.Unlock()
+	if tail == nil {
+		return nil
+	}
+	return tail.get()
+}
+
+// Number of times the child has been restarted.
+func (this *Supervisor) Restarts() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.restarts
+}
+
+func (this *Supervisor) requestStop() {
+	if !this.stopping {
+		this.stopping = true
+		close(this.stop)
+	}
+}
+
+func (this *Supervisor) start() (*exec.Cmd, error) {
+	cmd := exec.Command(this.Command[0], this.Command[1:]...)
+	// In its own process group, so that what it starts can be signalled with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = this.Stdout
+	cmd.Stderr = this.Stderr
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, this.tail)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, this.tail)
+	log.Info("Starting ", this.Name, ":", cmd.Path, " ", strings.Join(cmd.Args, " "))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (this *Supervisor) run(cmd *exec.Cmd, done chan<- interface{}) {
+	defer close(done)
+
+	backoff := this.RestartBackoff
+	crashes := 0
+	for {
+		started := time.Now()
+		err := cmd.Wait()
+		log.Warn(this.Name, " exited: pid=", cmd.Process.Pid, ",state=", cmd.ProcessState, ",err=", err)
+
+		this.lock.Lock()
+		stopping := this.stopping
+		this.lock.Unlock()
+		if stopping {
+			if err != nil && !cmd.ProcessState.Success() {
+				log.Info(this.Name, " stopped: ", err)
+			}
+			return
+		}
+
+		if time.Since(started) > this.CrashLoopWindow {
+			crashes = 0
+			backoff = this.RestartBackoff
+		}
+
+		for {
+			crashes++
+			if crashes > this.MaxRestarts {
+				this.lock.Lock()
+				this.err = newError(ErrCrashLoop, "%s exited %d times, last error: %v", this.Name, crashes, err)
+				this.lock.Unlock()
+				log.Error("Giving up on ", this.Name, ": ", this.err)
+				return
+			}
+
+			log.Info("Restarting ", this.Name, " in ", backoff, " (attempt ", crashes, " of ", this.MaxRestarts, ")")
+			select {
+			case <-time.After(backoff):
+			case <-this.stop:
+				return
+			}
+			if backoff *= 2; backoff > this.RestartBackoffMax {
+				backoff = this.RestartBackoffMax
+			}
+
+			this.lock.Lock()
+			if this.stopping {
+				this.lock.Unlock()
+				return
+			}
+			next, startErr := this.start()
+			if startErr == nil {
+				this.cmd = next
+				this.restarts++
+			}
+			this.lock.Unlock()
+
+			if startErr == nil {
+				cmd = next
+				break
+			}
+			log.Warn("Cannot start ", this.Name, ": ", startErr)
+			err = startErr
+		}
+	}
+}
+
+// Sends the signal to the process group led by the child.
+func signalGroup(pgid int, sig os.Signal) error {
+	return syscall.Kill(-pgid, sig.(syscall.Signal))
+}
+
+// Waits until no process is left in the group, or until the deadline.  Returns true if none is
+// left.  Processes that were orphaned to this one, as when it runs as pid 1 in a container, are
+// reaped.
+func waitGroup(pgid int, deadline time.Time) bool {
+	for {
+		var status syscall.WaitStatus
+		for {
+			if pid, _ := syscall.Wait4(-pgid, &status, syscall.WNOHANG, nil); pid <= 0 {
+				break
+			}
+		}
+		if syscall.Kill(-pgid, 0) == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,186 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type TestSuiteSupervisor struct {
+}
+
+var _ = Suite(&TestSuiteSupervisor{})
+
+func (suite *TestSuiteSupervisor) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteSupervisor) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteSupervisor) TestGiveUpOnCrashLoop(c *C) {
+	supervisor := &Supervisor{
+		Name:              "crasher",
+		Command:           []string{"sh", "-c", "exit 1"},
+		RestartBackoff:    10 * time.Millisecond,
+		RestartBackoffMax: 40 * time.Millisecond,
+		MaxRestarts:       3,
+		CrashLoopWindow:   time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+
+	select {
+	case <-supervisor.Done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("supervisor did not give up")
+	}
+	c.Assert(supervisor.Err(), NotNil)
+	c.Assert(supervisor.Restarts(), Equals, 3)
+}
+
+func (suite *TestSuiteSupervisor) TestStop(c *C) {
+	supervisor := &Supervisor{
+		Name:            "sleeper",
+		Command:         []string{"sleep", "60"},
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	c.Assert(supervisor.Stop(), IsNil)
+	c.Assert(supervisor.Restarts(), Equals, 0)
+}
+
+func (suite *TestSuiteSupervisor) TestStartFailure(c *C) {
+	supervisor := &Supervisor{
+		Name:    "missing",
+		Command: []string{"/no/such/command"},
+	}
+	c.Assert(supervisor.Start(), NotNil)
+}
+
+func (suite *TestSuiteSupervisor) TestStopWithinKills(c *C) {
+	supervisor := &Supervisor{
+		Name:            "stubborn",
+		Command:         []string{"sh", "-c", "trap '' TERM; while true; do sleep 0.1; done"},
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	err := supervisor.StopWithin(200 * time.Millisecond)
+	c.Assert(err, NotNil)
+	c.Assert(supervisor.Restarts(), Equals, 0)
+}
+
+func (suite *TestSuiteSupervisor) TestStopWithinStopsGroup(c *C) {
+	// Like Exhibitor, starts a process in the background that outlives it unless signalled.
+	pidFile := filepath.Join(c.MkDir(), "pid")
+	supervisor := &Supervisor{
+		Name:            "starter",
+		Command:         []string{"sh", "-c", "sleep 60 & echo $! > " + pidFile + "; trap 'exit 0' TERM; wait"},
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	pid := waitPid(c, pidFile)
+
+	c.Assert(supervisor.StopWithin(5*time.Second), IsNil)
+	c.Assert(exited(pid), Equals, true)
+}
+
+func (suite *TestSuiteSupervisor) TestStopWithinKillsGroup(c *C) {
+	pidFile := filepath.Join(c.MkDir(), "pid")
+	supervisor := &Supervisor{
+		Name:            "starter",
+		Command:         []string{"sh", "-c", "(trap '' TERM; sleep 60) & echo $! > " + pidFile + "; trap 'exit 0' TERM; wait"},
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	pid := waitPid(c, pidFile)
+	time.Sleep(100 * time.Millisecond)
+
+	c.Assert(Cause(supervisor.StopWithin(200*time.Millisecond)), Equals, ErrKilled)
+	c.Assert(exited(pid), Equals, true)
+}
+
+func (suite *TestSuiteSupervisor) TestStopWithinBackoff(c *C) {
+	supervisor := &Supervisor{
+		Name:            "crasher",
+		Command:         []string{"sh", "-c", "exit 1"},
+		RestartBackoff:  time.Minute,
+		MaxRestarts:     3,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	c.Assert(supervisor.StopWithin(5*time.Second), IsNil)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+	c.Assert(supervisor.Restarts(), Equals, 0)
+}
+
+func (suite *TestSuiteSupervisor) TestStopWithinGaveUp(c *C) {
+	supervisor := &Supervisor{
+		Name:            "crasher",
+		Command:         []string{"sh", "-c", "exit 1"},
+		RestartBackoff:  10 * time.Millisecond,
+		MaxRestarts:     1,
+		CrashLoopWindow: time.Minute,
+	}
+	c.Assert(supervisor.Start(), IsNil)
+	<-supervisor.Done
+
+	c.Assert(Cause(supervisor.StopWithin(5*time.Second)), Equals, ErrCrashLoop)
+}
+
+// Waits for the child to write the pid of the process it started.
+func waitPid(c *C, path string) int {
+	for i := 0; i < 50; i++ {
+		if buff, err := ioutil.ReadFile(path); err == nil && strings.HasSuffix(string(buff), "\n") {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(buff)))
+			c.Assert(err, IsNil)
+			return pid
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Fatal("no pid written")
+	return 0
+}
+
+// True once the process is gone or is a zombie waiting for init to reap it.  A killed process
+// can take a moment to get there.
+func exited(pid int) bool {
+	for i := 0; i < 20; i++ {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			return true
+		}
+		buff, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err == nil && strings.Contains(string(buff), ") Z ") {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func (suite *TestSuiteSupervisor) TestShutdown(c *C) {
+	config := &Config{
+		Supervisor: Supervisor{
+			Name:            "sleeper",
+			Command:         []string{"sleep", "60"},
+			MaxRestarts:     3,
+			CrashLoopWindow: time.Minute,
+		},
+		ShutdownGracePeriod: 5 * time.Second,
+	}
+	c.Assert(config.Supervisor.Start(), IsNil)
+	c.Assert(config.Shutdown(), IsNil)
+	c.Assert(config.ShuttingDown(), Equals, true)
+	c.Assert(config.Start(), NotNil)
+}
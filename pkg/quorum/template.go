@@ -8,14 +8,14 @@ const (
     "logIndexDirectory":"",
     "autoManageInstancesSettlingPeriodMs":"180000",
     "autoManageInstancesFixedEnsembleSize":"0",
-    "autoManageInstancesApplyAllAtOnce":"1",
+    "autoManageInstancesApplyAllAtOnce":"{{ apply_all_at_once }}",
     "observerThreshold":"999",
     "serversSpec":"{{ zk_servers_spec }}",
     "javaEnvironment":"",
     "log4jProperties":"",
-    "clientPort":"2181",
-    "connectPort":"2888",
-    "electionPort":"3888",
+    "clientPort":"{{ client_port }}",
+    "connectPort":"{{ quorum_port }}",
+    "electionPort":"{{ election_port }}",
     "checkMs":"30000",
     "cleanupPeriodMs":"43200000",
     "cleanupMaxFiles":"3",
@@ -30,5 +30,15 @@ const (
     "backupExtra":{},
     "serverId":{{server_id}}
 }
+`
+
+	DefaultZooCfgTemplate = `# Generated by zk bootstrap
+tickTime={{.Native.TickTime}}
+initLimit={{.Native.InitLimit}}
+syncLimit={{.Native.SyncLimit}}
+dataDir={{.Native.DataDirectory}}
+clientPort={{ client_port }}
+peerType={{ peer_type }}
+{{ zk_servers }}
 `
 )
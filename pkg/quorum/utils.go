@@ -1,26 +1,108 @@
 package quorum
 
 import (
+	"bytes"
+	"fmt"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
 )
 
+// A flag value that can't be parsed as a server.
+type BadHostPortError struct {
+	Flag   string
+	Value  HostPort
+	Reason string
+}
+
+func (this *BadHostPortError) Error() string {
+	if this.Flag == "" {
+		return fmt.Sprintf("err-bad-host-port:%s: %s", this.Value, this.Reason)
+	}
+	return fmt.Sprintf("err-bad-host-port:-%s %s: %s", this.Flag, this.Value, this.Reason)
+}
+
+// Parses [<id>@]<host>[:<client port>[:<quorum port>:<election port>]].  Ports left empty take
+// the defaults.  IPv6 addresses with ports go in brackets, e.g. [fd00::1]:2181.
 func (this HostPort) toServer() (*Server, error) {
-	s := strings.Split(string(this), ":")
-	server := &Server{Ip: s[0]}
+	bad := func(reason string) (*Server, error) {
+		return nil, &BadHostPortError{Value: this, Reason: reason}
+	}
 
-	if len(s) > 1 {
-		p, err := strconv.Atoi(s[1])
-		if err != nil {
-			return nil, err
-		} else {
-			server.Port = p
+	hp := string(this)
+	id := 0
+	if i := strings.Index(hp, "@"); i >= 0 {
+		v, err := strconv.Atoi(hp[:i])
+		if err != nil || v < 1 || v > 255 {
+			return bad("server id must be between 1 and 255")
 		}
+		id, hp = v, hp[i+1:]
+	}
+
+	host, ports := hp, ""
+	switch {
+	case strings.HasPrefix(hp, "["):
+		i := strings.Index(hp, "]")
+		if i < 0 {
+			return bad("missing ]")
+		}
+		host, ports = hp[1:i], hp[i+1:]
+		if ports != "" && !strings.HasPrefix(ports, ":") {
+			return bad("expecting : after ]")
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return bad("not an IPv6 address: " + host)
+		}
+	case strings.Contains(hp, ":") && net.ParseIP(hp) != nil:
+		// IPv6 address without ports
+	case strings.Count(hp, ":") > 3:
+		return bad("IPv6 addresses with ports go in brackets")
+	default:
+		if i := strings.Index(hp, ":"); i >= 0 {
+			host, ports = hp[:i], hp[i:]
+		}
+	}
+	if host == "" {
+		return bad("missing host")
+	}
+
+	server := &Server{Id: id, Ip: canonicalHost(host)}
+	if ports == "" {
+		return server, nil
+	}
+	list := strings.Split(ports[1:], ":")
+	if len(list) != 1 && len(list) != 3 {
+		return bad("expecting <host>:<client port> or <host>:<client port>:<quorum port>:<election port>")
+	}
+	names := []string{"client", "quorum", "election"}
+	fields := []*int{&server.Port, &server.QuorumPort, &server.ElectionPort}
+	for i, p := range list {
+		if p == "" {
+			continue
+		}
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 1 || v > 65535 {
+			return bad(fmt.Sprintf("bad %s port %s", names[i], p))
+		}
+		*fields[i] = v
 	}
 	return server, nil
 }
 
+func isIPv6(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// Spells IPv6 addresses one way so they can be compared as strings.
+func canonicalHost(host string) string {
+	if isIPv6(host) {
+		return net.ParseIP(host).String()
+	}
+	return host
+}
+
 type serverSorter struct {
 	servers []*Server
 }
@@ -48,6 +130,11 @@ func (s *serverSorter) Swap(i, j int) {
 
 // Less is part of sort.Interface. It is implemented by calling the "by" closure in the sorter.
 func (s *serverSorter) Less(i, j int) bool {
+	// IPv6 addresses are compared numerically since the same address has many spellings.
+	// Everything else is compared as strings, which ids by position depend on.
+	if a, b := s.servers[i].Ip, s.servers[j].Ip; a != b && isIPv6(a) && isIPv6(b) {
+		return bytes.Compare(net.ParseIP(a), net.ParseIP(b)) < 0
+	}
 	if s.servers[i].Ip == s.servers[j].Ip {
 		return s.servers[i].Port < s.servers[j].Port
 	} else {
@@ -55,6 +142,13 @@ func (s *serverSorter) Less(i, j int) bool {
 	}
 }
 
+// Orders servers by id.
+type byId []*Server
+
+func (s byId) Len() int           { return len(s) }
+func (s byId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byId) Less(i, j int) bool { return s[i].Id < s[j].Id }
+
 func dedupAndSort(a []HostPort, b ...[]HostPort) ([]*Server, error) {
 	seen := map[string]interface{}{}
 	out := []*Server{}
@@ -0,0 +1,128 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"strings"
+)
+
+type TestSuiteHostPort struct {
+}
+
+var _ = Suite(&TestSuiteHostPort{})
+
+func (suite *TestSuiteHostPort) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteHostPort) TearDownSuite(c *C) {
+}
+
+func (suite *TestSuiteHostPort) TestToServer(c *C) {
+	for _, t := range []struct {
+		hp     HostPort
+		server Server
+	}{
+		{"10.0.0.1", Server{Ip: "10.0.0.1"}},
+		{"10.0.0.1:2182", Server{Ip: "10.0.0.1", Port: 2182}},
+		{"10.0.0.1:2182:2889:3889", Server{Ip: "10.0.0.1", Port: 2182, QuorumPort: 2889, ElectionPort: 3889}},
+		{"10.0.0.1::2889:3889", Server{Ip: "10.0.0.1", QuorumPort: 2889, ElectionPort: 3889}},
+		{"3@zk-1.example.com:2182:2889:3889", Server{Id: 3, Ip: "zk-1.example.com", Port: 2182, QuorumPort: 2889, ElectionPort: 3889}},
+		{"fd00::1", Server{Ip: "fd00::1"}},
+		{"[fd00::1]", Server{Ip: "fd00::1"}},
+		{"[fd00::1]:2182", Server{Ip: "fd00::1", Port: 2182}},
+		{"2@[fd00::1]:2182:2889:3889", Server{Id: 2, Ip: "fd00::1", Port: 2182, QuorumPort: 2889, ElectionPort: 3889}},
+	} {
+		server, err := t.hp.toServer()
+		c.Assert(err, IsNil, Commentf("%s", t.hp))
+		c.Assert(*server, DeepEquals, t.server, Commentf("%s", t.hp))
+	}
+}
+
+func (suite *TestSuiteHostPort) TestToServerErrors(c *C) {
+	for _, t := range []struct {
+		hp     HostPort
+		reason string
+	}{
+		{"", "missing host"},
+		{":2181", "missing host"},
+		{"10.0.0.1:x", "bad client port x"},
+		{"10.0.0.1:2181:2888", "expecting .*"},
+		{"10.0.0.1:2181:70000:3888", "bad quorum port 70000"},
+		{"10.0.0.1:2181:2888:0", "bad election port 0"},
+		{"[fd00::1", "missing ]"},
+		{"[fd00::1]2181", "expecting : after ]"},
+		{"[10.0.0.1]:2181", "not an IPv6 address: 10.0.0.1"},
+		{"fd00::1:2181:2888:x", "IPv6 addresses with ports go in brackets"},
+		{"0@10.0.0.1", "server id must be between 1 and 255"},
+	} {
+		_, err := t.hp.toServer()
+		c.Assert(err, NotNil, Commentf("%s", t.hp))
+		c.Assert(err.(*BadHostPortError).Reason, Matches, t.reason, Commentf("%s", t.hp))
+	}
+}
+
+func (suite *TestSuiteHostPort) TestFlagInError(c *C) {
+	config := &Config{
+		Servers:   []HostPort{"10.0.0.1"},
+		Observers: []HostPort{"10.0.0.2:21x81"},
+	}
+	err := config.InitEnsemble()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "err-bad-host-port:-O 10.0.0.2:21x81: bad client port 21x81")
+}
+
+func (suite *TestSuiteHostPort) TestPorts(c *C) {
+	config := &Config{
+		Servers:  []HostPort{"10.0.0.1:2182:2889:3889", "10.0.0.2:2182:2889:3889", "10.0.0.3:2183:2890:3890"},
+		Hostname: "10.0.0.2",
+	}
+	c.Assert(config.InitEnsemble(), IsNil)
+	c.Assert(config.GetClientPort(), Equals, 2182)
+	c.Assert(config.GetZkServers(), Equals, strings.Join([]string{
+		"server.1=10.0.0.1:2889:3889",
+		"server.2=0.0.0.0:2889:3889",
+		"server.3=10.0.0.3:2890:3890",
+	}, "\n"))
+	c.Assert(config.GetZkHosts(), Equals, "10.0.0.1:2182,10.0.0.2:2182,10.0.0.3:2183")
+
+	buff, err := config.GenerateConfig()
+	c.Assert(err, IsNil)
+	c.Assert(string(buff), Matches, `(?s).*"clientPort":"2182",\s*"connectPort":"2889",\s*"electionPort":"3889".*`)
+}
+
+func (suite *TestSuiteHostPort) TestIPv6(c *C) {
+	for _, t := range []struct {
+		servers []HostPort
+		self    string
+		zkHosts string
+		zkLocal string
+	}{
+		{
+			servers: []HostPort{"[fd00::a]", "fd00::9", "[fd00:0:0::10]:2182"},
+			self:    "fd00::9",
+			zkHosts: "[fd00::9]:2181,[fd00::a]:2181,[fd00::10]:2182",
+			zkLocal: "[::1]:2181",
+		},
+		{
+			// Same address spelled differently
+			servers: []HostPort{"[2001:db8::2]:2182:2889:3889", "2001:db8::1"},
+			self:    "2001:0db8:0000::0002",
+			zkHosts: "[2001:db8::1]:2181,[2001:db8::2]:2182",
+			zkLocal: "[::1]:2182",
+		},
+		{
+			// IPv4 keeps sorting as strings
+			servers: []HostPort{"10.0.0.9", "10.0.0.10", "[fd00::1]"},
+			self:    "10.0.0.9",
+			zkHosts: "10.0.0.10:2181,10.0.0.9:2181,[fd00::1]:2181",
+			zkLocal: "127.0.0.1:2181",
+		},
+	} {
+		config := &Config{Servers: t.servers, Hostname: t.self}
+		c.Assert(config.InitEnsemble(), IsNil)
+		c.Assert(config.GetZkHosts(), Equals, t.zkHosts, Commentf("%v", t.servers))
+		c.Assert(config.LocalZkAddr(), Equals, t.zkLocal, Commentf("%v", t.servers))
+		// ZooKeeper 3.4 can't take IPv6 addresses in the server lists, so Validate rejects them.
+		// This host binds to the wildcard that the JVM also listens on for IPv6.
+		c.Assert(config.specHost(config.selfServer()), Equals, "0.0.0.0", Commentf("%v", t.servers))
+	}
+}
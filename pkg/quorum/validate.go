@@ -0,0 +1,331 @@
+package quorum
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/conductant/zk/pkg/datadir"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+
+	// More voters than this slow down writes without adding much availability.
+	MaxRecommendedVoters = 7
+)
+
+// Something wrong with the settings, found by Validate.  Check names what was checked, e.g.
+// voters or ports.
+type Problem struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+type Problems []Problem
+
+func (this *Problems) add(severity, check, format string, args ...interface{}) {
+	*this = append(*this, Problem{Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// Number of problems of the severity.
+func (this Problems) Count(severity string) int {
+	count := 0
+	for _, p := range this {
+		if p.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns an error of kind ErrInvalidConfig listing the errors, or nil if there are only warnings.
+func (this Problems) Err() error {
+	list := this.errors()
+	if len(list) == 0 {
+		return nil
+	}
+	return newError(ErrInvalidConfig, "%s", strings.Join(list, "; "))
+}
+
+// Messages of the errors.
+func (this Problems) errors() []string {
+	list := []string{}
+	for _, p := range this {
+		if p.Severity == SeverityError {
+			list = append(list, p.Message)
+		}
+	}
+	return list
+}
+
+func (this Problems) Log() {
+	for _, p := range this {
+		if p.Severity == SeverityError {
+			log.Error("Invalid config (", p.Check, "): ", p.Message)
+		} else {
+			log.Warn("Config (", p.Check, "): ", p.Message)
+		}
+	}
+}
+
+// Checks the settings without touching this host's data directory, reporting all problems
+// instead of stopping at the first.  This host isn't detected, so its membership is only
+// checked if Hostname is set.
+func (this *Config) Validate() Problems {
+	problems := this.checkMembers()
+	// The ensemble is built even if -ip matches no member, which is reported below.
+	if err := this.prepare(false); err != nil && Cause(err) != ErrSelfNotInEnsemble {
+		problems.add(SeverityError, "init", "%v", err)
+		return problems
+	}
+	if this.Hostname == "" {
+		problems.add(SeverityWarning, "self", "-ip is not set, so this host's membership is not checked")
+	} else if this.selfServer() == nil {
+		problems.add(SeverityError, "self", "%s is not a member of the ensemble", this.Hostname)
+	}
+	problems = append(problems, this.checkEnsemble()...)
+	problems = append(problems, this.checkEndpoint()...)
+	return append(problems, this.checkSeed()...)
+}
+
+// Checks made by Init once the ensemble is built.
+func (this *Config) check() Problems {
+	problems := append(this.checkMembers(), this.checkEnsemble()...)
+	problems = append(problems, this.checkEndpoint()...)
+	return append(problems, this.checkSeed()...)
+}
+
+// Checks the members as listed, before duplicates are merged.
+func (this *Config) checkMembers() Problems {
+	problems := Problems{}
+	seen := map[string]HostPort{}
+	flags := map[string]string{}
+	check := func(flag string, list []HostPort) {
+		for _, hp := range list {
+			s, err := hp.toServer()
+			if err != nil {
+				continue // Reported by InitEnsemble
+			}
+			prev, has := seen[s.Ip]
+			switch {
+			case !has:
+			case flags[s.Ip] != flag:
+				problems.add(SeverityError, "duplicates", "%s is both a server (-S) and an observer (-O)", s.Ip)
+			case prev != hp:
+				problems.add(SeverityError, "duplicates", "%s is listed as both %s and %s", s.Ip, prev, hp)
+			default:
+				problems.add(SeverityWarning, "duplicates", "%s is listed more than once", s.Ip)
+			}
+			seen[s.Ip] = hp
+			flags[s.Ip] = flag
+		}
+	}
+	check("O", this.Observers)
+	check("S", this.Servers)
+	return problems
+}
+
+// Checks the ensemble and the configs generated from it.
+func (this *Config) checkEnsemble() Problems {
+	problems := Problems{}
+
+	voters := 0
+	for _, s := range this.ensemble {
+		if !s.Observer {
+			voters++
+		}
+	}
+	switch {
+	case voters == 0:
+		problems.add(SeverityError, "voters", "there are no voting members.  Add servers with -S")
+	case voters == 1:
+		problems.add(SeverityWarning, "voters", "a single voter tolerates no failures")
+	case voters == 2:
+		problems.add(SeverityError, "voters", "2 voters tolerate no failures and lose quorum if either fails.  Use 3")
+	case voters%2 == 0:
+		problems.add(SeverityWarning, "voters", "%d voters tolerate %d failures, the same as %d.  Use an odd number",
+			voters, FaultTolerance(voters), voters-1)
+	case voters > MaxRecommendedVoters:
+		problems.add(SeverityWarning, "voters", "%d voters slow down writes.  Consider observers", voters)
+	}
+
+	for _, s := range this.ensemble {
+		port := orDefault(s.Port, DefaultZkClientPort)
+		if s == this.selfServer() {
+			port = this.GetClientPort()
+		}
+		if port == s.GetQuorumPort() || port == s.GetElectionPort() || s.GetQuorumPort() == s.GetElectionPort() {
+			problems.add(SeverityError, "ports", "%s uses port %d for clients, %d for quorum and %d for election",
+				s.Ip, port, s.GetQuorumPort(), s.GetElectionPort())
+		}
+	}
+
+	// ZooKeeper 3.4 splits server.N entries on ':', so it can't parse IPv6 addresses with or without
+	// brackets.  Exhibitor writes the same entries.  This host binds to 0.0.0.0 but the others
+	// write its address.
+	for _, s := range this.ensemble {
+		if host := this.configHost(s); isIPv6(host) {
+			problems.add(SeverityError, "ipv6", "%s would be written to zoo.cfg as the IPv6 address %s, "+
+				"which ZooKeeper 3.4 can't parse.  Use a host name", s.Ip, host)
+		}
+	}
+
+	// Generating the configs needs this host's id.
+	if this.selfServer() != nil {
+		problems = append(problems, this.checkTemplate()...)
+	}
+	return problems
+}
+
+// Number of voters that can fail without losing quorum.
+func FaultTolerance(voters int) int {
+	if voters < 1 {
+		return 0
+	}
+	return (voters - 1) / 2
+}
+
+// Settings that must be in a generated config, by mode.
+var requiredSettings = map[string][]string{
+	ModeNative:    {"tickTime", "initLimit", "syncLimit", "dataDir", "clientPort"},
+	ModeExhibitor: {"serversSpec", "serverId", "clientPort", "connectPort", "electionPort", "zookeeperDataDirectory"},
+}
+
+// Generates the config of the mode and checks it has the required keys and sane limits.
+func (this *Config) checkTemplate() Problems {
+	problems := Problems{}
+	settings := map[string]string{}
+	limits := map[string]string{}
+
+	if this.Mode == ModeNative {
+		buff, err := this.GenerateZooCfg()
+		if err != nil {
+			problems.add(SeverityError, "template", "cannot generate zoo.cfg: %v", err)
+			return problems
+		}
+		var bad []string
+		settings, bad = parseZooCfg(buff)
+		for _, line := range bad {
+			problems.add(SeverityError, "template", "zoo.cfg line is not key=value: %s", line)
+		}
+		servers := 0
+		for key := range settings {
+			if strings.HasPrefix(key, "server.") {
+				servers++
+			}
+		}
+		if servers != len(this.ensemble) {
+			problems.add(SeverityError, "template", "zoo.cfg has %d server entries but the ensemble has %d members",
+				servers, len(this.ensemble))
+		}
+		if dir := settings["dataDir"]; dir != "" && filepath.Join(dir, datadir.MyIdFile) != filepath.Clean(this.MyIdPath) {
+			problems.add(SeverityError, "myid", "ZooKeeper reads myid from %s but -myid_path is %s",
+				filepath.Join(dir, datadir.MyIdFile), this.MyIdPath)
+		}
+		limits = settings
+	} else {
+		buff, err := this.GenerateConfig()
+		if err != nil {
+			problems.add(SeverityError, "template", "cannot generate the Exhibitor config: %v", err)
+			return problems
+		}
+		config := map[string]interface{}{}
+		if err := json.Unmarshal(buff, &config); err != nil {
+			problems.add(SeverityError, "template", "the Exhibitor config is not JSON: %v", err)
+			return problems
+		}
+		for k, v := range config {
+			settings[k] = fmt.Sprint(v)
+		}
+		if extra, is := config["zooCfgExtra"].(map[string]interface{}); is {
+			for k, v := range extra {
+				limits[k] = fmt.Sprint(v)
+			}
+		}
+	}
+
+	for _, key := range requiredSettings[this.Mode] {
+		if strings.TrimSpace(settings[key]) == "" {
+			problems.add(SeverityError, "template", "the %s config has no %s", this.Mode, key)
+		}
+	}
+	return append(problems, checkLimits(limits)...)
+}
+
+// Settings of a zoo.cfg, and the lines that aren't key=value.
+func parseZooCfg(buff []byte) (map[string]string, []string) {
+	settings := map[string]string{}
+	bad := []string{}
+	for _, line := range strings.Split(string(buff), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			bad = append(bad, line)
+			continue
+		}
+		settings[kv[0]] = kv[1]
+	}
+	return settings, bad
+}
+
+// Checks tickTime, initLimit and syncLimit of zoo.cfg.  Missing ones are ZooKeeper's defaults.
+func checkLimits(settings map[string]string) Problems {
+	problems := Problems{}
+	values := map[string]int{}
+	for _, key := range []string{"tickTime", "initLimit", "syncLimit"} {
+		s, has := settings[key]
+		if !has {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || v < 1 {
+			problems.add(SeverityError, "limits", "%s must be a positive number, not %q", key, s)
+			continue
+		}
+		values[key] = v
+	}
+	tick, init, sync := values["tickTime"], values["initLimit"], values["syncLimit"]
+	if tick > 0 && tick < 100 {
+		problems.add(SeverityWarning, "limits", "tickTime of %dms makes session timeouts and heartbeats very short", tick)
+	}
+	if init > 0 && sync > init {
+		problems.add(SeverityWarning, "limits", "syncLimit %d is larger than initLimit %d", sync, init)
+	}
+	if tick > 0 && sync > 0 && tick*sync > 60000 {
+		problems.add(SeverityWarning, "limits", "followers may lag the leader for %dms (tickTime * syncLimit) before being dropped",
+			tick*sync)
+	}
+	return problems
+}
+
+// Checks the urls of the Exhibitor server.
+func (this *Config) checkEndpoint() Problems {
+	problems := Problems{}
+	if this.Mode != ModeExhibitor {
+		return problems
+	}
+	if _, err := this.Exhibitor.endpoint(); err != nil {
+		problems.add(SeverityError, "endpoint", "%v", err)
+	}
+	return problems
+}
+
+// Checks that the seed tree can be fetched and parsed.
+func (this *Config) checkSeed() Problems {
+	problems := Problems{}
+	if this.Seed == "" {
+		return problems
+	}
+	if _, _, err := this.fetchSeed(); err != nil {
+		problems.add(SeverityError, "seed", "%v", err)
+	}
+	return problems
+}
@@ -0,0 +1,198 @@
+package quorum
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type TestSuiteValidate struct {
+}
+
+var _ = Suite(&TestSuiteValidate{})
+
+func (suite *TestSuiteValidate) SetUpSuite(c *C) {
+}
+
+func (suite *TestSuiteValidate) TearDownSuite(c *C) {
+}
+
+func nativeConfig(servers, observers []HostPort, self string) *Config {
+	return &Config{
+		Servers:    servers,
+		Observers:  observers,
+		Hostname:   self,
+		Mode:       ModeNative,
+		Native:     ZooKeeper{DataDirectory: "/var/zookeeper", TickTime: 2000, InitLimit: 10, SyncLimit: 5},
+		resolver:   newResolver(),
+		localAddrs: noLocalAddrs,
+	}
+}
+
+func messages(problems Problems, severity string) []string {
+	list := []string{}
+	for _, p := range problems {
+		if p.Severity == severity {
+			list = append(list, p.Message)
+		}
+	}
+	return list
+}
+
+func (suite *TestSuiteValidate) TestValid(c *C) {
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, []HostPort{"10.0.0.4"}, "10.0.0.2")
+	problems := config.Validate()
+	c.Assert(problems, HasLen, 0)
+	c.Assert(problems.Err(), IsNil)
+}
+
+func (suite *TestSuiteValidate) TestAllProblems(c *C) {
+	config := nativeConfig(
+		[]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.2", "10.0.0.3:2181:2181:3888"},
+		[]HostPort{"10.0.0.1"},
+		"10.0.0.9")
+	problems := config.Validate()
+	c.Assert(messages(problems, SeverityError), DeepEquals, []string{
+		"10.0.0.1 is both a server (-S) and an observer (-O)",
+		"10.0.0.9 is not a member of the ensemble",
+		"10.0.0.3 uses port 2181 for clients, 2181 for quorum and 3888 for election",
+	})
+	c.Assert(messages(problems, SeverityWarning), DeepEquals, []string{
+		"10.0.0.2 is listed more than once",
+	})
+	c.Assert(Cause(problems.Err()), Equals, ErrInvalidConfig)
+}
+
+func (suite *TestSuiteValidate) TestIPv6(c *C) {
+	for _, mode := range []string{ModeNative, ModeExhibitor} {
+		config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "[fd00::3]:2181"}, nil, "10.0.0.2")
+		config.Mode = mode
+		c.Assert(messages(config.Validate(), SeverityError), DeepEquals, []string{
+			"fd00::3 would be written to zoo.cfg as the IPv6 address fd00::3, which ZooKeeper 3.4 can't parse.  Use a host name",
+		})
+
+		// This host binds to 0.0.0.0, but the others would write its address.
+		config = nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "fd00::3"}, nil, "fd00::3")
+		config.Mode = mode
+		c.Assert(messages(config.Validate(), SeverityError), DeepEquals, []string{
+			"fd00::3 would be written to zoo.cfg as the IPv6 address fd00::3, which ZooKeeper 3.4 can't parse.  Use a host name",
+		})
+	}
+}
+
+func (suite *TestSuiteValidate) TestMyIdPath(c *C) {
+	// Follows the data directory unless it is set.
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.2")
+	config.MyIdPath = MyIdFilePath
+	config.Native.DataDirectory = "/data"
+	c.Assert(config.Validate(), HasLen, 0)
+	c.Assert(config.MyIdPath, Equals, "/data/myid")
+
+	config = nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.2")
+	config.MyIdPath = "/var/lib/zk/myid"
+	c.Assert(messages(config.Validate(), SeverityError), DeepEquals, []string{
+		"ZooKeeper reads myid from /var/zookeeper/myid but -myid_path is /var/lib/zk/myid",
+	})
+}
+
+func (suite *TestSuiteValidate) TestEndpoint(c *C) {
+	for _, t := range []struct {
+		config, status, endpoint string
+	}{
+		{"", "", ZkLocalExhibitorEndpoint},
+		{"file:///tmp/config", "", ZkLocalExhibitorEndpoint},
+		{"http://zk:8080/exhibitor/v1/config/set", "", "http://zk:8080"},
+		{"", "http://zk:8080/exhibitor/v1/config/get-state", "http://zk:8080"},
+		{"http://zk:8080/exhibitor/v1/config/set", "http://zk:8080/exhibitor/v1/config/get-state", "http://zk:8080"},
+		{"http://zk:8080/config", "", ""},
+		{"", "file:///tmp/state", ""},
+		{"http://zk:8080/exhibitor/v1/config/set", "http://other:8080/exhibitor/v1/config/get-state", ""},
+	} {
+		e := &Exhibitor{Endpoint: ZkLocalExhibitorEndpoint, ConfigEndpoint: t.config, StatusEndpoint: t.status}
+		endpoint, err := e.endpoint()
+		if t.endpoint == "" {
+			c.Assert(Cause(err), Equals, ErrBadEndpoint, Commentf("%v", t))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("%v", t))
+		c.Assert(endpoint, Equals, t.endpoint)
+	}
+
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.2")
+	config.Mode = ModeExhibitor
+	config.Exhibitor.StatusEndpoint = "http://zk:8080/status"
+	c.Assert(messages(config.Validate(), SeverityError), DeepEquals, []string{
+		"err-bad-endpoint:status_endpoint http://zk:8080/status is not the url of /exhibitor/v1/config/get-state",
+	})
+}
+
+func (suite *TestSuiteValidate) TestVoters(c *C) {
+	for _, t := range []struct {
+		servers   []HostPort
+		observers []HostPort
+		severity  string
+		message   string
+	}{
+		{nil, []HostPort{"10.0.0.1", "10.0.0.2"}, SeverityError,
+			"there are no voting members.  Add servers with -S"},
+		{[]HostPort{"10.0.0.1"}, nil, SeverityWarning,
+			"a single voter tolerates no failures"},
+		{[]HostPort{"10.0.0.1", "10.0.0.2"}, nil, SeverityError,
+			"2 voters tolerate no failures and lose quorum if either fails.  Use 3"},
+		{[]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, nil, SeverityWarning,
+			"4 voters tolerate 1 failures, the same as 3.  Use an odd number"},
+		{[]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7",
+			"10.0.0.8", "10.0.0.9"}, nil, SeverityWarning,
+			"9 voters slow down writes.  Consider observers"},
+	} {
+		config := nativeConfig(t.servers, t.observers, "10.0.0.1")
+		c.Assert(messages(config.Validate(), t.severity), DeepEquals, []string{t.message})
+	}
+	c.Assert(FaultTolerance(5), Equals, 2)
+}
+
+func (suite *TestSuiteValidate) TestLimits(c *C) {
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.1")
+	config.Native.TickTime = 0
+	config.Native.InitLimit = 5
+	config.Native.SyncLimit = 10
+	problems := config.Validate()
+	c.Assert(messages(problems, SeverityError), DeepEquals, []string{
+		`tickTime must be a positive number, not "0"`,
+	})
+	c.Assert(messages(problems, SeverityWarning), DeepEquals, []string{
+		"syncLimit 10 is larger than initLimit 5",
+	})
+
+	c.Assert(messages(checkLimits(map[string]string{"tickTime": "10000", "initLimit": "10", "syncLimit": "10"}),
+		SeverityWarning), DeepEquals, []string{
+		"followers may lag the leader for 100000ms (tickTime * syncLimit) before being dropped",
+	})
+}
+
+func (suite *TestSuiteValidate) TestExhibitorTemplate(c *C) {
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, "10.0.0.1")
+	config.Mode = ModeExhibitor
+	c.Assert(config.Validate(), HasLen, 0)
+
+	path := filepath.Join(c.MkDir(), "exhibitor.json")
+	c.Assert(ioutil.WriteFile(path, []byte(`{"serversSpec":"{{ zk_servers_spec }}","zooCfgExtra":{"tickTime":"x"}}`), 0644), IsNil)
+	config.ConfigTemplateUrl = "file://" + path
+	c.Assert(messages(config.Validate(), SeverityError), DeepEquals, []string{
+		"the exhibitor config has no serverId",
+		"the exhibitor config has no clientPort",
+		"the exhibitor config has no connectPort",
+		"the exhibitor config has no electionPort",
+		"the exhibitor config has no zookeeperDataDirectory",
+		`tickTime must be a positive number, not "x"`,
+	})
+}
+
+func (suite *TestSuiteValidate) TestInitRejects(c *C) {
+	config := nativeConfig([]HostPort{"10.0.0.1", "10.0.0.2"}, []HostPort{"10.0.0.2"}, "10.0.0.1")
+	config.Native.DataDirectory = c.MkDir()
+	err := config.Init()
+	c.Assert(Cause(err), Equals, ErrInvalidConfig)
+	c.Assert(err.Error(), Equals, "err-invalid-config:10.0.0.2 is both a server (-S) and an observer (-O); "+
+		"2 voters tolerate no failures and lose quorum if either fails.  Use 3")
+}
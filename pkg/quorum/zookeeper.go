@@ -0,0 +1,116 @@
+package quorum
+
+import (
+	"github.com/conductant/gohm/pkg/encoding"
+	"github.com/conductant/gohm/pkg/resource"
+	"github.com/conductant/gohm/pkg/template"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ZkLocalConfigPath    = "/usr/local/zookeeper/conf/zoo.cfg"
+	ZkLocalDataDirectory = "/var/zookeeper"
+	ZkLocalStartCommand  = "/usr/local/zookeeper/bin/zkServer.sh start-foreground"
+
+	DefaultZkClientPort   = 2181
+	DefaultZkQuorumPort   = 2888
+	DefaultZkElectionPort = 3888
+)
+
+// Runs ZooKeeper directly, without Exhibitor.  The zoo.cfg is rendered from a template
+// and written to the conf volume before the server is started in the foreground.
+type ZooKeeper struct {
+	ReadyTimeout         encoding.Duration `json:"zk_ready_timeout" yaml:"zk_ready_timeout"`
+	ReadyPollInterval    encoding.Duration `json:"zk_ready_poll_interval" yaml:"zk_ready_poll_interval"`
+	ReadyPollIntervalMax time.Duration     `json:"zk_ready_poll_interval_max" yaml:"zk_ready_poll_interval_max" flag:"zk_ready_poll_max, Maximum time between readiness checks in native mode.  The interval doubles while nothing changes"`
+	ConfigTemplateUrl    string            `json:"zoo_cfg_url" yaml:"zoo_cfg_url" flag:"zoo_cfg_template, Url of zoo.cfg template."`
+	ConfigPath           string            `json:"zoo_cfg_path" yaml:"zoo_cfg_path" flag:"zoo_cfg, Location of the generated zoo.cfg"`
+	DataDirectory        string            `json:"data_dir" yaml:"data_dir" flag:"data_dir, ZooKeeper data directory"`
+	ClientPort           int               `json:"client_port" yaml:"client_port" flag:"client_port, ZooKeeper client port"`
+	TickTime             int               `json:"tick_time" yaml:"tick_time" flag:"tick_time, ZooKeeper tickTime in milliseconds"`
+	InitLimit            int               `json:"init_limit" yaml:"init_limit" flag:"init_limit, ZooKeeper initLimit in ticks"`
+	SyncLimit            int               `json:"sync_limit" yaml:"sync_limit" flag:"sync_limit, ZooKeeper syncLimit in ticks"`
+	StartCommand         string            `json:"start_command" yaml:"start_command"`
+
+	supervisor  *Supervisor
+	monitor     *monitor
+	stopMonitor context.CancelFunc
+	zkAddr      string
+}
+
+func (this *ZooKeeper) GenerateConfig(data interface{}, funcs map[string]interface{}) ([]byte, error) {
+	tpl, err := resource.Fetch(context.Background(), this.ConfigTemplateUrl)
+	if err != nil {
+		tpl = []byte(DefaultZooCfgTemplate)
+	}
+	return template.Apply(tpl, data, funcs)
+}
+
+// Writes the generated zoo.cfg to the configured path.
+func (this *ZooKeeper) WriteConfig(config []byte) error {
+	if err := os.MkdirAll(filepath.Dir(this.ConfigPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(this.ConfigPath, config, 0644)
+}
+
+// Starts ZooKeeper in the foreground under the given supervisor.
+func (this *ZooKeeper) Start(supervisor *Supervisor) error {
+	supervisor.Name = "ZooKeeper"
+	supervisor.Command = append(strings.Split(this.StartCommand, " "), this.ConfigPath)
+	if err := supervisor.Start(); err != nil {
+		return err
+	}
+	this.supervisor = supervisor
+	this.monitor, this.stopMonitor = startMonitor("ZooKeeper", this.probe,
+		this.ReadyPollInterval.Duration, this.ReadyPollIntervalMax, supervisor)
+	return nil
+}
+
+func (this *ZooKeeper) Stop() error {
+	if this.supervisor == nil {
+		return ErrNotRunning
+	}
+	defer this.stopMonitor()
+	return this.supervisor.Stop()
+}
+
+// Returns true once the local ZooKeeper is serving as leader, follower or observer.
+func (this *ZooKeeper) Running() (bool, error) {
+	state, err := this.probe(context.Background())
+	return state == StateInQuorum, err
+}
+
+func (this *ZooKeeper) probe(ctx context.Context) (State, error) {
+	return probeZk(this.zkAddr, this.ReadyPollInterval.Duration, StateStarting)
+}
+
+// Blocks until ZooKeeper serves clients.  Returns an error of kind ErrZkTimeout if it doesn't
+// within ReadyTimeout of starting, or ErrNotRunning if it stops first.
+func (this *ZooKeeper) WaitZkRunning(ctx context.Context) error {
+	if this.monitor == nil {
+		return ErrNotRunning
+	}
+	return this.monitor.wait(ctx, zkInQuorum, this.ReadyTimeout.Duration, ErrZkTimeout)
+}
+
+// State changes until the context is done or ZooKeeper stops.
+func (this *ZooKeeper) Events(ctx context.Context) <-chan StateChange {
+	if this.monitor == nil {
+		return closedEvents()
+	}
+	return this.monitor.events(ctx)
+}
+
+// Current state and the last probe error.
+func (this *ZooKeeper) State() (State, error) {
+	if this.monitor == nil {
+		return StateStopped, nil
+	}
+	return this.monitor.get()
+}